@@ -0,0 +1,177 @@
+package claudeagent
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"claudeagent/message"
+	"claudeagent/session"
+)
+
+const checkpointPreviewLen = 80
+
+// Checkpoint is a point in the conversation files can be rewound to: the
+// state of the files just before a prompt was sent.
+type Checkpoint struct {
+	// ID is the UUID of the user message, as passed to RewindFiles.
+	ID string
+	// Prompt is the start of the prompt's text, on one line.
+	Prompt string
+	Sent   time.Time
+
+	// resumeAt is the last assistant message before the prompt, where the
+	// conversation resumes after a rewind. Empty for the first prompt.
+	resumeAt string
+}
+
+// checkpointTimeline records the prompts sent while file checkpointing is
+// on, oldest first.
+type checkpointTimeline struct {
+	mu            sync.Mutex
+	checkpoints   []Checkpoint
+	lastAssistant string
+}
+
+// newCheckpointTimeline returns nil unless file checkpointing is enabled.
+func newCheckpointTimeline(o *Options) *checkpointTimeline {
+	if !o.EnableFileCheckpointing {
+		return nil
+	}
+	return &checkpointTimeline{}
+}
+
+// add records a prompt about to be sent and returns its user message UUID:
+// id if set, otherwise a new one.
+func (tl *checkpointTimeline) add(id string, content any) string {
+	if tl == nil {
+		return id
+	}
+	if id == "" {
+		id = newUUID()
+	}
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.checkpoints = append(tl.checkpoints, Checkpoint{
+		ID:       id,
+		Prompt:   promptPreview(content),
+		Sent:     time.Now(),
+		resumeAt: tl.lastAssistant,
+	})
+	return id
+}
+
+// observe tracks the last assistant message of the main conversation.
+func (tl *checkpointTimeline) observe(msg message.Message) {
+	m, ok := msg.(*message.AssistantMessage)
+	if tl == nil || !ok || m.ParentToolUseID != nil || m.UUID == "" {
+		return
+	}
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.lastAssistant = m.UUID
+}
+
+func (tl *checkpointTimeline) list() []Checkpoint {
+	if tl == nil {
+		return nil
+	}
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	return append([]Checkpoint(nil), tl.checkpoints...)
+}
+
+func (tl *checkpointTimeline) find(id string) (Checkpoint, bool) {
+	for _, cp := range tl.list() {
+		if cp.ID == id {
+			return cp, true
+		}
+	}
+	return Checkpoint{}, false
+}
+
+// rewind drops the checkpoint id and everything after it, as the
+// conversation resumes from just before it.
+func (tl *checkpointTimeline) rewind(id string) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	for i, cp := range tl.checkpoints {
+		if cp.ID == id {
+			tl.checkpoints = tl.checkpoints[:i]
+			tl.lastAssistant = cp.resumeAt
+			return
+		}
+	}
+}
+
+// transcriptResumePoint returns the last assistant message before the
+// prompt checkpointID in the session transcript, or "" if the client started
+// a new conversation. It fails for a resumed session whose transcript does
+// not have the prompt, rather than resume the turns being rewound.
+func (c *clientImpl) transcriptResumePoint(checkpointID string) (string, error) {
+	c.mu.RLock()
+	started, configDir, sessionID := c.started, c.configDir, c.sessionID
+	c.mu.RUnlock()
+
+	if started.Resume == nil && !started.Continue {
+		return "", nil
+	}
+	cliDir := ""
+	if configDir != nil {
+		cliDir = configDir.cliDir
+	} else {
+		dir, err := session.CLIDir()
+		if err != nil {
+			return "", err
+		}
+		cliDir = dir
+	}
+	cwd := ""
+	if started.Cwd != nil {
+		cwd = *started.Cwd
+	}
+	msgs, err := session.LoadByIDIn(cliDir, cwd, sessionID)
+	if err != nil {
+		return "", fmt.Errorf("find the resume point of checkpoint %s: %w", checkpointID, err)
+	}
+	last := ""
+	for _, msg := range msgs {
+		switch msg := msg.(type) {
+		case *message.AssistantMessage:
+			last = msg.UUID
+		case *message.UserMessage:
+			if msg.UUID == checkpointID && last != "" {
+				return last, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("find the resume point of checkpoint %s: no assistant message before it in session %s", checkpointID, sessionID)
+}
+
+// promptPreview returns the start of a prompt's text on one line.
+func promptPreview(content any) string {
+	var parts []string
+	for _, block := range (message.UserContent{Content: content}).Blocks() {
+		if tb, ok := block.(*message.TextBlock); ok {
+			parts = append(parts, tb.Text)
+		}
+	}
+	text := strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+	if utf8.RuneCountInString(text) <= checkpointPreviewLen {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:checkpointPreviewLen-1]) + "…"
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
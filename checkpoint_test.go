@@ -0,0 +1,124 @@
+package claudeagent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"claudeagent/message"
+)
+
+func TestCheckpointTimeline(t *testing.T) {
+	tl := newCheckpointTimeline(applyOptions([]Option{WithEnableFileCheckpointing()}))
+
+	first := tl.add("", "Refactor   the\nparser")
+	tl.observe(&message.AssistantMessage{UUID: "a1"})
+	// Subagent messages are not resume points.
+	parent := "toolu_1"
+	tl.observe(&message.AssistantMessage{UUID: "sub", ParentToolUseID: &parent})
+	second := tl.add("user-chosen", []any{
+		map[string]any{"type": "text", "text": "Now add"},
+		map[string]any{"type": "image", "source": map[string]any{"type": "base64"}},
+		map[string]any{"type": "text", "text": "tests"},
+	})
+	tl.observe(&message.AssistantMessage{UUID: "a2"})
+	third := tl.add("", strings.Repeat("x", 200))
+
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(first) {
+		t.Errorf("not a UUID: %s", first)
+	}
+	if second != "user-chosen" {
+		t.Errorf("expected the caller's UUID to be kept, got %s", second)
+	}
+
+	cps := tl.list()
+	if len(cps) != 3 || cps[0].ID != first || cps[2].ID != third {
+		t.Fatalf("unexpected checkpoints: %+v", cps)
+	}
+	if cps[0].Prompt != "Refactor the parser" || cps[1].Prompt != "Now add tests" {
+		t.Errorf("unexpected previews: %q, %q", cps[0].Prompt, cps[1].Prompt)
+	}
+	if n := len([]rune(cps[2].Prompt)); n != checkpointPreviewLen || !strings.HasSuffix(cps[2].Prompt, "…") {
+		t.Errorf("expected a truncated preview, got %q", cps[2].Prompt)
+	}
+	if cps[0].resumeAt != "" || cps[1].resumeAt != "a1" || cps[2].resumeAt != "a2" {
+		t.Errorf("unexpected resume points: %+v", cps)
+	}
+
+	tl.rewind(second)
+	if cps := tl.list(); len(cps) != 1 || cps[0].ID != first {
+		t.Errorf("expected only the first checkpoint after rewind, got %+v", cps)
+	}
+	// The next prompt follows the resume point.
+	tl.add("", "again")
+	if cps := tl.list(); cps[1].resumeAt != "a1" {
+		t.Errorf("resume point after rewind = %q, want a1", cps[1].resumeAt)
+	}
+}
+
+func TestCheckpointTimeline_Disabled(t *testing.T) {
+	tl := newCheckpointTimeline(applyOptions(nil))
+	if tl != nil {
+		t.Fatal("expected no timeline without file checkpointing")
+	}
+	if id := tl.add("", "hi"); id != "" {
+		t.Errorf("expected no UUID, got %s", id)
+	}
+	tl.observe(&message.AssistantMessage{UUID: "a1"})
+	if tl.list() != nil {
+		t.Error("expected no checkpoints")
+	}
+}
+
+func TestRewindToCheckpoint_Unknown(t *testing.T) {
+	client, err := NewClient(WithCLIPath("/bin/true"), WithEnableFileCheckpointing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.RewindToCheckpoint(context.Background(), "nope", RewindFilesOptions{DryRun: true}); !errors.Is(err, ErrUnknownCheckpoint) {
+		t.Errorf("expected ErrUnknownCheckpoint, got %v", err)
+	}
+	if cps := client.Checkpoints(); len(cps) != 0 {
+		t.Errorf("expected no checkpoints, got %+v", cps)
+	}
+}
+
+func TestTranscriptResumePoint(t *testing.T) {
+	cliDir, cwd := t.TempDir(), t.TempDir()
+	projectDir := filepath.Join(cliDir, "projects", strings.ReplaceAll(cwd, string(filepath.Separator), "-"))
+	if err := os.MkdirAll(projectDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	transcript := `{"type":"user","message":{"role":"user","content":"hi"},"uuid":"u1","sessionId":"s1"}
+{"type":"assistant","message":{"id":"m1","role":"assistant","content":[]},"uuid":"a1","sessionId":"s1"}
+{"type":"user","message":{"role":"user","content":"next"},"uuid":"cp","sessionId":"s1"}
+`
+	if err := os.WriteFile(filepath.Join(projectDir, "s1.jsonl"), []byte(transcript), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	resume := "s1"
+	c := &clientImpl{
+		configDir: &preparedConfigDir{cliDir: cliDir},
+		started:   &Options{Resume: &resume, Cwd: &cwd},
+		sessionID: "s1",
+	}
+	if at, err := c.transcriptResumePoint("cp"); err != nil || at != "a1" {
+		t.Errorf("expected a1, got %q, %v", at, err)
+	}
+	// A prompt the transcript does not have is an error, not a rewind to the
+	// end of the resumed conversation.
+	if _, err := c.transcriptResumePoint("u1"); err == nil {
+		t.Error("expected an error for a prompt without a resume point")
+	}
+
+	// New conversations start over.
+	c.started = &Options{Cwd: &cwd}
+	if at, err := c.transcriptResumePoint("cp"); err != nil || at != "" {
+		t.Errorf("expected no resume point, got %q, %v", at, err)
+	}
+}
@@ -3,6 +3,7 @@ package claudeagent
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 
 	"claudeagent/control"
@@ -28,6 +29,24 @@ type Client interface {
 	SetModel(ctx context.Context, model string) error
 	RewindFiles(ctx context.Context, userMessageID string) error
 	RewindFilesWithOptions(ctx context.Context, userMessageID string, opts RewindFilesOptions) (*RewindFilesResult, error)
+	// Checkpoints lists the prompts sent since Connect while file
+	// checkpointing is enabled, oldest first.
+	Checkpoints() []Checkpoint
+	// RewindToCheckpoint restores files to their state before the
+	// checkpoint's prompt and restarts the CLI with the conversation resumed
+	// from that point, dropping the checkpoint and later ones. With
+	// opts.DryRun it only previews the rewind. Channels from Messages and
+	// Errors close on restart; call them again. In a resumed session, the
+	// first checkpoint resumes from the transcript's last assistant message
+	// before it; if the transcript has none, nothing is rewound.
+	RewindToCheckpoint(ctx context.Context, checkpointID string, opts RewindFilesOptions) (*RewindFilesResult, error)
+	// Compact asks the CLI to compact the conversation, with optional
+	// instructions for the summary, and waits for the compact boundary. The
+	// boundary arrives through Messages, which must be read meanwhile. If the
+	// compaction's turn ends without one, Compact returns the turn's error.
+	// The compaction is not a checkpoint and its turn is not reported to
+	// WithWorkspaceSnapshots.
+	Compact(ctx context.Context, instructions string) (*message.CompactMetadata, error)
 
 	SetMcpServers(ctx context.Context, servers map[string]mcp.ServerConfig) (*mcp.SetServersResult, error)
 	McpServerStatus(ctx context.Context) ([]mcp.ServerStatus, error)
@@ -40,6 +59,19 @@ type Client interface {
 	AccountInfo(ctx context.Context) (*AccountInfo, error)
 
 	SessionID() string
+	Diagnostics() Diagnostics
+	// ConfigDir returns the isolated CLI config directory set up by
+	// WithConfigDir, or "" if the client uses the user's own.
+	ConfigDir() string
+}
+
+// Diagnostics describes the state of the CLI process behind a client. It stays
+// available after Disconnect and after a failed Connect.
+type Diagnostics struct {
+	Stderr   []string
+	ExitCode *int
+	// Detected is a recognised CLI failure in the stderr tail, if any.
+	Detected *CLIError
 }
 
 type RewindFilesOptions struct {
@@ -56,11 +88,20 @@ type RewindFilesResult struct {
 
 type clientImpl struct {
 	transport    *transport.SubprocessTransport
+	last         *transport.SubprocessTransport
+	configDir    *preparedConfigDir
 	options      *Options
 	cliPath      string
 	sessionID    string
 	initResponse *initResponse
-	mu           sync.RWMutex
+	snapshots    *turnSnapshots
+	worktree     *sessionWorktree
+	checkpoints  *checkpointTimeline
+	compactions  *compactWaiters
+	// started holds the options of the last Connect, after per-connection
+	// changes such as the worktree directory.
+	started *Options
+	mu      sync.RWMutex
 }
 
 type initResponse struct {
@@ -71,6 +112,9 @@ type initResponse struct {
 
 func NewClient(opts ...Option) (Client, error) {
 	options := applyOptions(opts)
+	if err := validateOptions(options); err != nil {
+		return nil, err
+	}
 
 	cliPath, err := resolveCLIPath(options)
 	if err != nil {
@@ -105,20 +149,61 @@ func (c *clientImpl) Connect(ctx context.Context) error {
 		return fmt.Errorf("client already connected")
 	}
 
-	cmdOpts := buildCommandOptions(c.options)
-	var opts []transport.SubprocessOption
-	if c.options.Env != nil {
-		opts = append(opts, transport.WithEnv(c.options.Env))
+	wt, options, err := prepareWorktree(ctx, c.options)
+	if err != nil {
+		return err
+	}
+	c.worktree = wt
+	c.started = options
+	c.checkpoints = newCheckpointTimeline(options)
+	if err := c.start(ctx, options); err != nil {
+		c.releaseConfigDir()
+		c.releaseWorktree()
+		return err
+	}
+	return nil
+}
+
+// start launches and initializes the CLI. Callers must hold c.mu.
+func (c *clientImpl) start(ctx context.Context, options *Options) error {
+	c.snapshots = newTurnSnapshots(options)
+	c.compactions = &compactWaiters{}
+
+	cmdOpts := buildCommandOptions(options)
+	if err := applyLandlock(cmdOpts, options, c.cliPath); err != nil {
+		return err
 	}
-	if c.options.Stderr != nil {
-		opts = append(opts, transport.WithStderrCallback(c.options.Stderr))
+
+	if c.options.ConfigDir != nil && c.configDir == nil {
+		configDir, err := prepareConfigDir(c.options.ConfigDir)
+		if err != nil {
+			return err
+		}
+		c.configDir = configDir
 	}
 
-	t := transport.NewSubprocessTransport(c.cliPath, cmdOpts, opts...)
+	opts := buildTransportOptions(c.options, c.configDir)
+
+	var t *transport.SubprocessTransport
+	opts = append(opts, transport.WithRestartHook(func(ctx context.Context) error {
+		resp, err := c.initialize(ctx, t)
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.initResponse = resp
+		c.mu.Unlock()
+		return nil
+	}))
+
+	t = transport.NewSubprocessTransport(c.cliPath, cmdOpts, opts...)
 
 	if c.options.CanUseTool != nil {
 		t.Control().SetCanUseTool(c.options.CanUseTool)
 	}
+	if c.options.CallbackTimeout > 0 {
+		t.Control().SetCallbackTimeout(c.options.CallbackTimeout)
+	}
 
 	if c.options.Hooks != nil {
 		hookMatchers := make(map[control.HookEvent][]control.HookCallbackMatcher)
@@ -128,12 +213,27 @@ func (c *clientImpl) Connect(ctx context.Context) error {
 		t.Control().SetHooks(hookMatchers)
 	}
 
+	c.last = t
 	if err := t.Connect(ctx); err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
+		return newConnectionError("failed to connect", t.RedactError(err), t.StderrTail())
 	}
 
 	c.transport = t
 
+	resp, err := c.initialize(ctx, t)
+	if err != nil {
+		t.Close()
+		c.transport = nil
+		return newConnectionError("failed to initialize", t.RedactError(err), t.StderrTail())
+	}
+	c.initResponse = resp
+
+	return nil
+}
+
+// initialize runs the control protocol handshake. It is also used to
+// re-initialize a process restarted by the stall watchdog.
+func (c *clientImpl) initialize(ctx context.Context, t *transport.SubprocessTransport) (*initResponse, error) {
 	var jsonSchema map[string]any
 	if c.options.OutputFormat != nil {
 		jsonSchema = c.options.OutputFormat.Schema
@@ -147,14 +247,12 @@ func (c *clientImpl) Connect(ctx context.Context) error {
 		}
 	}
 
-	initResp, err := t.Control().Initialize(ctx, nil, nil, jsonSchema, nil, nil, agents)
+	initResp, err := t.Control().Initialize(ctx, t.Control().HookMatchers(), nil, jsonSchema, nil, nil, agents)
 	if err != nil {
-		t.Close()
-		c.transport = nil
-		return fmt.Errorf("failed to initialize: %w", err)
+		return nil, err
 	}
 
-	c.initResponse = &initResponse{
+	resp := &initResponse{
 		commands: make([]SlashCommand, len(initResp.Commands)),
 		models:   make([]ModelInfo, len(initResp.Models)),
 		account: AccountInfo{
@@ -167,7 +265,7 @@ func (c *clientImpl) Connect(ctx context.Context) error {
 	}
 
 	for i, cmd := range initResp.Commands {
-		c.initResponse.commands[i] = SlashCommand{
+		resp.commands[i] = SlashCommand{
 			Name:         cmd.Name,
 			Description:  cmd.Description,
 			ArgumentHint: cmd.ArgumentHint,
@@ -175,14 +273,14 @@ func (c *clientImpl) Connect(ctx context.Context) error {
 	}
 
 	for i, model := range initResp.Models {
-		c.initResponse.models[i] = ModelInfo{
+		resp.models[i] = ModelInfo{
 			Value:       model.Value,
 			DisplayName: model.DisplayName,
 			Description: model.Description,
 		}
 	}
 
-	return nil
+	return resp, nil
 }
 
 func (c *clientImpl) Disconnect() error {
@@ -195,9 +293,33 @@ func (c *clientImpl) Disconnect() error {
 
 	err := c.transport.Close()
 	c.transport = nil
+	if cleanupErr := c.releaseConfigDir(); err == nil {
+		err = cleanupErr
+	}
+	if cleanupErr := c.releaseWorktree(); err == nil {
+		err = cleanupErr
+	}
 	return err
 }
 
+// releaseWorktree finishes the session worktree. Callers must hold c.mu.
+func (c *clientImpl) releaseWorktree() error {
+	wt := c.worktree
+	c.worktree = nil
+	return wt.finish()
+}
+
+// releaseConfigDir removes a config directory marked for cleanup. Callers
+// must hold c.mu.
+func (c *clientImpl) releaseConfigDir() error {
+	configDir := c.configDir
+	if configDir == nil || !configDir.remove {
+		return nil
+	}
+	c.configDir = nil
+	return configDir.cleanup()
+}
+
 func (c *clientImpl) IsConnected() bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -210,7 +332,7 @@ func (c *clientImpl) Query(ctx context.Context, prompt string) error {
 
 func (c *clientImpl) QueryWithSession(ctx context.Context, prompt string, sessionID string) error {
 	c.mu.RLock()
-	t := c.transport
+	t, snapshots, wt, checkpoints, compactions := c.transport, c.snapshots, c.worktree, c.checkpoints, c.compactions
 	c.mu.RUnlock()
 
 	if t == nil || !t.IsConnected() {
@@ -224,14 +346,18 @@ func (c *clientImpl) QueryWithSession(ctx context.Context, prompt string, sessio
 			Content: prompt,
 		},
 		SessionID: sessionID,
+		UUID:      checkpoints.add("", prompt),
 	}
 
+	snapshots.begin()
+	wt.begin()
+	compactions.begin()
 	return t.SendMessage(ctx, msg)
 }
 
 func (c *clientImpl) Messages(ctx context.Context) <-chan message.Message {
 	c.mu.RLock()
-	t := c.transport
+	t, snapshots, wt, checkpoints, compactions := c.transport, c.snapshots, c.worktree, c.checkpoints, c.compactions
 	c.mu.RUnlock()
 
 	if t == nil {
@@ -253,6 +379,10 @@ func (c *clientImpl) Messages(ctx context.Context) <-chan message.Message {
 				}
 				c.mu.Unlock()
 			}
+			snapshots.observe(msg)
+			wt.observe(msg)
+			checkpoints.observe(msg)
+			compactions.observe(msg)
 			select {
 			case out <- msg:
 			case <-ctx.Done():
@@ -275,7 +405,7 @@ func (c *clientImpl) Errors(ctx context.Context) <-chan error {
 	}
 
 	_, errChan := t.ReceiveMessages(ctx)
-	return errChan
+	return translateErrors(errChan)
 }
 
 func (c *clientImpl) Interrupt(ctx context.Context) error {
@@ -398,9 +528,36 @@ func (c *clientImpl) SessionID() string {
 	return c.sessionID
 }
 
+func (c *clientImpl) ConfigDir() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.configDir == nil {
+		return ""
+	}
+	return c.configDir.cliDir
+}
+
+func (c *clientImpl) Diagnostics() Diagnostics {
+	c.mu.RLock()
+	t := c.last
+	c.mu.RUnlock()
+
+	if t == nil {
+		return Diagnostics{}
+	}
+
+	stderr := t.StderrTail()
+	exitCode := t.ExitCode()
+	return Diagnostics{
+		Stderr:   stderr,
+		ExitCode: exitCode,
+		Detected: classifyStderr(stderr, exitCode),
+	}
+}
+
 func (c *clientImpl) StreamInput(ctx context.Context, input <-chan message.UserMessage) error {
 	c.mu.RLock()
-	t := c.transport
+	t, snapshots, wt, checkpoints, compactions := c.transport, c.snapshots, c.worktree, c.checkpoints, c.compactions
 	c.mu.RUnlock()
 
 	if t == nil || !t.IsConnected() {
@@ -416,7 +573,11 @@ func (c *clientImpl) StreamInput(ctx context.Context, input <-chan message.UserM
 					Content: msg.Message.Content,
 				},
 				SessionID: msg.SessionID,
+				UUID:      checkpoints.add(msg.UUID, msg.Message.Content),
 			}
+			snapshots.begin()
+			wt.begin()
+			compactions.begin()
 			if err := t.SendMessage(ctx, streamMsg); err != nil {
 				return
 			}
@@ -448,6 +609,110 @@ func (c *clientImpl) RewindFilesWithOptions(ctx context.Context, userMessageID s
 	}, nil
 }
 
+func (c *clientImpl) Checkpoints() []Checkpoint {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.checkpoints.list()
+}
+
+func (c *clientImpl) RewindToCheckpoint(ctx context.Context, checkpointID string, opts RewindFilesOptions) (*RewindFilesResult, error) {
+	c.mu.RLock()
+	checkpoints := c.checkpoints
+	c.mu.RUnlock()
+
+	cp, ok := checkpoints.find(checkpointID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCheckpoint, checkpointID)
+	}
+	if cp.resumeAt == "" && !opts.DryRun {
+		// Before the first prompt of a resumed session, the conversation
+		// ends with the resumed transcript. Look up its resume point before
+		// touching any files.
+		at, err := c.transcriptResumePoint(checkpointID)
+		if err != nil {
+			return nil, err
+		}
+		cp.resumeAt = at
+	}
+	result, err := c.RewindFilesWithOptions(ctx, checkpointID, opts)
+	if err != nil || opts.DryRun || !result.CanRewind {
+		return result, err
+	}
+	if err := c.resumeAt(ctx, cp.resumeAt); err != nil {
+		return result, err
+	}
+	checkpoints.rewind(checkpointID)
+	return result, nil
+}
+
+// resumeAt restarts the CLI with the conversation resumed at the assistant
+// message messageID, or as it was at Connect if messageID is empty.
+func (c *clientImpl) resumeAt(ctx context.Context, messageID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.transport == nil {
+		return ErrNotConnected
+	}
+	c.transport.Close()
+	c.transport = nil
+
+	options := c.started
+	if messageID != "" && c.sessionID != "" {
+		o := *c.started
+		sessionID := c.sessionID
+		o.Resume = &sessionID
+		o.ResumeSessionAt = &messageID
+		o.Continue = false
+		o.ForkSession = false
+		options = &o
+	} else {
+		// The CLI may start a new session, e.g. when forking.
+		c.sessionID = ""
+	}
+	if err := c.start(ctx, options); err != nil {
+		c.releaseConfigDir()
+		c.releaseWorktree()
+		return err
+	}
+	return nil
+}
+
+func (c *clientImpl) Compact(ctx context.Context, instructions string) (*message.CompactMetadata, error) {
+	c.mu.RLock()
+	t, snapshots, wt, compactions := c.transport, c.snapshots, c.worktree, c.compactions
+	c.mu.RUnlock()
+
+	if t == nil || !t.IsConnected() {
+		return nil, ErrNotConnected
+	}
+
+	// The compaction is a turn of its own, but not a checkpoint to rewind
+	// to or a turn whose workspace changes are reported.
+	msg := transport.StreamMessage{
+		Type: "user",
+		Message: message.UserContent{
+			Role:    "user",
+			Content: strings.TrimSpace("/compact " + instructions),
+		},
+		SessionID: "default",
+	}
+	waiter := compactions.add()
+	snapshots.skip()
+	wt.begin()
+	if err := t.SendMessage(ctx, msg); err != nil {
+		compactions.remove(waiter, true)
+		return nil, err
+	}
+	select {
+	case outcome := <-waiter.done:
+		return outcome.meta, outcome.err
+	case <-ctx.Done():
+		compactions.remove(waiter, false)
+		return nil, ctx.Err()
+	}
+}
+
 func (c *clientImpl) ReconnectMcpServer(ctx context.Context, serverName string) error {
 	c.mu.RLock()
 	t := c.transport
@@ -0,0 +1,122 @@
+package claudeagent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"claudeagent/message"
+)
+
+// compactWaiters hands the outcome of a compaction to the Compact call
+// waiting for it. Results arrive in the order turns were sent, so it counts
+// the turns in flight to tell which result ends the compaction's turn.
+type compactWaiters struct {
+	mu sync.Mutex
+	// pending counts the turns sent but not finished.
+	pending int
+	waiters []*compactWaiter
+}
+
+type compactWaiter struct {
+	done chan compactOutcome
+	// ahead counts the turns sent before the compaction that have not
+	// finished.
+	ahead int
+}
+
+type compactOutcome struct {
+	meta *message.CompactMetadata
+	err  error
+}
+
+// begin counts a turn about to be sent.
+func (w *compactWaiters) begin() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending++
+}
+
+// add counts the compaction's turn, about to be sent, and returns its waiter.
+func (w *compactWaiters) add() *compactWaiter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	waiter := &compactWaiter{done: make(chan compactOutcome, 1), ahead: w.pending}
+	w.pending++
+	w.waiters = append(w.waiters, waiter)
+	return waiter
+}
+
+// remove stops waiting; unsent also uncounts the compaction's turn.
+func (w *compactWaiters) remove(waiter *compactWaiter, unsent bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if unsent && w.pending > 0 {
+		w.pending--
+	}
+	for i, other := range w.waiters {
+		if other == waiter {
+			w.waiters = append(w.waiters[:i], w.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// observe wakes a waiter when msg is the compact boundary or result of its
+// turn. A result without a boundary is reported as an error.
+func (w *compactWaiters) observe(msg message.Message) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if meta, ok := message.CompactBoundary(msg); ok {
+		if meta == nil {
+			meta = &message.CompactMetadata{}
+		}
+		w.wake(compactOutcome{meta: meta})
+		return
+	}
+	result, ok := msg.(*message.ResultMessage)
+	if !ok {
+		return
+	}
+	if w.pending > 0 {
+		w.pending--
+	}
+	w.wake(compactOutcome{err: compactError(result)})
+	for _, waiter := range w.waiters {
+		waiter.ahead--
+	}
+}
+
+// wake hands outcome to the waiters whose turn is running. Callers must hold
+// w.mu.
+func (w *compactWaiters) wake(outcome compactOutcome) {
+	waiting := w.waiters[:0]
+	for _, waiter := range w.waiters {
+		if waiter.ahead <= 0 {
+			waiter.done <- outcome
+		} else {
+			waiting = append(waiting, waiter)
+		}
+	}
+	w.waiters = waiting
+}
+
+// compactError describes a compaction turn that ended without a compact
+// boundary.
+func compactError(result *message.ResultMessage) error {
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("compaction failed: %s", strings.Join(result.Errors, "; "))
+	}
+	if result.IsError {
+		return fmt.Errorf("compaction failed: %s", result.Subtype)
+	}
+	return errors.New("compaction finished without a compact boundary")
+}
@@ -0,0 +1,65 @@
+package claudeagent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"claudeagent/message"
+)
+
+func TestCompactWaiters(t *testing.T) {
+	w := &compactWaiters{}
+	boundary := func(pre int) message.Message {
+		return &message.SystemMessage{Subtype: "compact_boundary", CompactMetadata: &message.CompactMetadata{Trigger: "manual", PreTokens: pre}}
+	}
+
+	// A prompt is in flight when the compaction is sent; its automatic
+	// compaction and result are not the compaction's.
+	w.begin()
+	first := w.add()
+	removed := w.add()
+	w.remove(removed, true)
+	w.observe(boundary(900))
+	w.observe(&message.ResultMessage{Subtype: "success"})
+	select {
+	case outcome := <-first.done:
+		t.Fatalf("woken by the earlier turn: %+v", outcome)
+	default:
+	}
+
+	w.observe(&message.AssistantMessage{})
+	w.observe(boundary(1200))
+	outcome := <-first.done
+	if outcome.err != nil || outcome.meta.Trigger != "manual" || outcome.meta.PreTokens != 1200 {
+		t.Errorf("unexpected outcome: %+v", outcome)
+	}
+	select {
+	case <-removed.done:
+		t.Error("removed waiter was woken")
+	default:
+	}
+	w.observe(&message.ResultMessage{Subtype: "success"})
+
+	// A compaction that fails ends with its result, and nobody waits for it
+	// afterwards.
+	second := w.add()
+	w.observe(&message.ResultMessage{Subtype: "error_during_execution", IsError: true, Errors: []string{"conversation too short"}})
+	if outcome := <-second.done; outcome.err == nil || !strings.Contains(outcome.err.Error(), "conversation too short") {
+		t.Errorf("expected the result's error, got %+v", outcome)
+	}
+	if len(w.waiters) != 0 || w.pending != 0 {
+		t.Errorf("expected no waiters or turns left, got %d, %d", len(w.waiters), w.pending)
+	}
+}
+
+func TestCompact_NotConnected(t *testing.T) {
+	client, err := NewClient(WithCLIPath("/bin/true"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Compact(context.Background(), "keep the API notes"); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("expected ErrNotConnected, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package claudeagent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"claudeagent/session"
+)
+
+// ConfigDir gives a client its own CLI configuration home, so settings,
+// session transcripts and project memory are not shared with other clients
+// on the same host.
+type ConfigDir struct {
+	// Path is the config directory. If empty, a temporary directory is created.
+	Path string
+	// Template is a directory whose contents are copied into the config
+	// directory before the CLI starts.
+	Template string
+	// CopyFromUser lists entries, relative to the user's own CLI directory
+	// (usually ~/.claude), to copy in, e.g. "settings.json" or ".credentials.json".
+	CopyFromUser []string
+	// OverrideHome sets HOME instead of CLAUDE_CONFIG_DIR. The config
+	// directory is then HOME/.claude, which also isolates ~/.claude.json.
+	OverrideHome bool
+	// Cleanup removes the directory after Disconnect, or when a Query
+	// iterator is closed.
+	Cleanup bool
+}
+
+// WithConfigDir isolates the CLI configuration home for this client.
+func WithConfigDir(cfg ConfigDir) Option {
+	return func(o *Options) {
+		o.ConfigDir = &cfg
+	}
+}
+
+// preparedConfigDir is a config directory ready for one CLI process.
+type preparedConfigDir struct {
+	root   string
+	cliDir string
+	env    map[string]string
+	remove bool
+}
+
+func prepareConfigDir(cfg *ConfigDir) (*preparedConfigDir, error) {
+	root := cfg.Path
+	created := false
+	if root == "" {
+		dir, err := os.MkdirTemp("", "claude-config-*")
+		if err != nil {
+			return nil, fmt.Errorf("create config dir: %w", err)
+		}
+		root = dir
+		created = true
+	}
+
+	p := &preparedConfigDir{root: root, cliDir: session.CLIDirIn(root, cfg.OverrideHome), remove: cfg.Cleanup}
+	if cfg.OverrideHome {
+		p.env = map[string]string{"HOME": root, "USERPROFILE": root}
+	} else {
+		p.env = map[string]string{"CLAUDE_CONFIG_DIR": root}
+	}
+
+	if err := p.populate(cfg); err != nil {
+		if created || cfg.Cleanup {
+			_ = os.RemoveAll(root)
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *preparedConfigDir) populate(cfg *ConfigDir) error {
+	if err := os.MkdirAll(p.cliDir, 0o700); err != nil {
+		return fmt.Errorf("create config dir: %w", err)
+	}
+
+	if cfg.Template != "" {
+		if err := copyTree(cfg.Template, p.cliDir); err != nil {
+			return fmt.Errorf("copy config template: %w", err)
+		}
+	}
+
+	if len(cfg.CopyFromUser) == 0 {
+		return nil
+	}
+	userDir, err := session.CLIDir()
+	if err != nil {
+		return err
+	}
+	for _, name := range cfg.CopyFromUser {
+		if filepath.IsAbs(name) || !filepath.IsLocal(name) {
+			return fmt.Errorf("copy from user config: %q must be a relative path inside the CLI directory", name)
+		}
+		src := filepath.Join(userDir, name)
+		if _, err := os.Stat(src); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err := copyTree(src, filepath.Join(p.cliDir, name)); err != nil {
+			return fmt.Errorf("copy %s from user config: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (p *preparedConfigDir) cleanup() error {
+	if p == nil || !p.remove {
+		return nil
+	}
+	return os.RemoveAll(p.root)
+}
+
+// copyTree copies a file or directory, preserving permission bits.
+// Symlinks are skipped rather than followed out of the source tree.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0o700)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		default:
+			return nil
+		}
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,106 @@
+package claudeagent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrepareConfigDir_Template(t *testing.T) {
+	template := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(template, "agents"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(template, "settings.json"), []byte(`{"model":"x"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(template, "agents", "a.md"), []byte("agent"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := prepareConfigDir(&ConfigDir{Template: template, Cleanup: true})
+	if err != nil {
+		t.Fatalf("prepareConfigDir failed: %v", err)
+	}
+	if p.env["CLAUDE_CONFIG_DIR"] != p.cliDir {
+		t.Errorf("CLAUDE_CONFIG_DIR = %q, want %q", p.env["CLAUDE_CONFIG_DIR"], p.cliDir)
+	}
+	data, err := os.ReadFile(filepath.Join(p.cliDir, "agents", "a.md"))
+	if err != nil || string(data) != "agent" {
+		t.Errorf("template file not copied: %q, %v", data, err)
+	}
+
+	if err := p.cleanup(); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	if _, err := os.Stat(p.root); !os.IsNotExist(err) {
+		t.Errorf("config dir still exists after cleanup: %v", err)
+	}
+}
+
+func TestPrepareConfigDir_CopyFromUser(t *testing.T) {
+	userDir := t.TempDir()
+	t.Setenv("CLAUDE_CONFIG_DIR", userDir)
+	if err := os.WriteFile(filepath.Join(userDir, ".credentials.json"), []byte("creds"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	root := filepath.Join(t.TempDir(), "home")
+	p, err := prepareConfigDir(&ConfigDir{
+		Path:         root,
+		CopyFromUser: []string{".credentials.json", "missing.json"},
+		OverrideHome: true,
+	})
+	if err != nil {
+		t.Fatalf("prepareConfigDir failed: %v", err)
+	}
+	if p.cliDir != filepath.Join(root, ".claude") {
+		t.Errorf("cliDir = %q", p.cliDir)
+	}
+	if p.env["HOME"] != root {
+		t.Errorf("HOME = %q, want %q", p.env["HOME"], root)
+	}
+	if _, ok := p.env["CLAUDE_CONFIG_DIR"]; ok {
+		t.Error("CLAUDE_CONFIG_DIR should not be set with OverrideHome")
+	}
+	info, err := os.Stat(filepath.Join(p.cliDir, ".credentials.json"))
+	if err != nil {
+		t.Fatalf("credentials not copied: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("credentials mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// Without Cleanup the directory is left in place.
+	if err := p.cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Errorf("config dir removed without Cleanup: %v", err)
+	}
+}
+
+func TestPrepareConfigDir_RejectsEscapingPaths(t *testing.T) {
+	t.Setenv("CLAUDE_CONFIG_DIR", t.TempDir())
+
+	for _, name := range []string{"../secrets", "/etc/passwd"} {
+		t.Run(name, func(t *testing.T) {
+			_, err := prepareConfigDir(&ConfigDir{Path: t.TempDir(), CopyFromUser: []string{name}})
+			if err == nil {
+				t.Errorf("expected error for %q", name)
+			}
+		})
+	}
+}
+
+func TestBuildEnv_ConfigDir(t *testing.T) {
+	opts := applyOptions([]Option{WithEnv(map[string]string{"HOME": "/explicit"})})
+	env := buildEnv(opts, map[string]string{"HOME": "/isolated", "CLAUDE_CONFIG_DIR": "/isolated/.claude"})
+
+	if env["CLAUDE_CONFIG_DIR"] != "/isolated/.claude" {
+		t.Errorf("CLAUDE_CONFIG_DIR = %q", env["CLAUDE_CONFIG_DIR"])
+	}
+	if env["HOME"] != "/explicit" {
+		t.Errorf("explicit env should win, HOME = %q", env["HOME"])
+	}
+}
@@ -0,0 +1,192 @@
+// Package contextwindow estimates how full the model's context window is
+// from the token usage the CLI reports, and warns as it fills up.
+//
+// The estimate comes from the last response of the main conversation: the
+// tokens it read, as input and cache tokens, plus the tokens it wrote:
+//
+//	mon := contextwindow.NewMonitor(
+//	    contextwindow.WithThreshold(0.8, func(u contextwindow.Usage) {
+//	        log.Printf("context %.0f%% full", 100*u.Fraction())
+//	    }),
+//	)
+//	for msg := range client.Messages(ctx) {
+//	    mon.Observe(msg)
+//	}
+package contextwindow
+
+import (
+	"sort"
+	"sync"
+
+	"claudeagent/message"
+)
+
+// DefaultWindow is the context window assumed until a result message
+// reports the model's.
+const DefaultWindow = 200_000
+
+// Usage is an estimate of the context in use.
+type Usage struct {
+	// Tokens is the estimated context size. It is 0 after a compaction until
+	// the next response.
+	Tokens int
+	Window int
+	Model  string
+	// Turn counts the turns finished so far.
+	Turn int
+	// Compactions counts the compactions seen so far.
+	Compactions int
+}
+
+// Fraction returns the share of the window in use.
+func (u Usage) Fraction() float64 {
+	if u.Window <= 0 {
+		return 0
+	}
+	return float64(u.Tokens) / float64(u.Window)
+}
+
+// Remaining returns the tokens left in the window.
+func (u Usage) Remaining() int {
+	return max(u.Window-u.Tokens, 0)
+}
+
+type threshold struct {
+	fraction float64
+	fn       func(Usage)
+	// fired is set while usage is at or above the threshold.
+	fired bool
+}
+
+// Option configures a Monitor.
+type Option func(*Monitor)
+
+// WithWindow sets the context window assumed until a result message reports
+// the model's. The default is DefaultWindow.
+func WithWindow(tokens int) Option {
+	return func(m *Monitor) {
+		m.defaultWindow = tokens
+	}
+}
+
+// WithThreshold calls fn when usage reaches fraction of the window, e.g. 0.8.
+// It fires again only after usage has dropped below the threshold, as it
+// does after a compaction.
+func WithThreshold(fraction float64, fn func(Usage)) Option {
+	return func(m *Monitor) {
+		m.thresholds = append(m.thresholds, &threshold{fraction: fraction, fn: fn})
+	}
+}
+
+// Monitor estimates context usage from the messages it observes. Only the
+// main conversation counts; subagents have their own contexts.
+type Monitor struct {
+	defaultWindow int
+	thresholds    []*threshold
+
+	mu      sync.Mutex
+	usage   Usage
+	windows map[string]int
+	// lastID is the API message the usage was last taken from; assistant
+	// messages split into content blocks repeat it.
+	lastID string
+	turns  []Usage
+}
+
+// NewMonitor creates a Monitor.
+func NewMonitor(opts ...Option) *Monitor {
+	m := &Monitor{defaultWindow: DefaultWindow, windows: make(map[string]int)}
+	for _, opt := range opts {
+		opt(m)
+	}
+	sort.Slice(m.thresholds, func(i, j int) bool { return m.thresholds[i].fraction < m.thresholds[j].fraction })
+	m.usage.Window = m.defaultWindow
+	return m
+}
+
+// Observe updates the estimate from a message and fires the thresholds it
+// crosses.
+func (m *Monitor) Observe(msg message.Message) {
+	m.mu.Lock()
+	switch msg := msg.(type) {
+	case *message.AssistantMessage:
+		u := msg.Message.Usage
+		if msg.ParentToolUseID != nil || u == nil || (msg.Message.ID != "" && msg.Message.ID == m.lastID) {
+			m.mu.Unlock()
+			return
+		}
+		m.lastID = msg.Message.ID
+		m.usage.Tokens = u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens + u.OutputTokens
+		if msg.Message.Model != "" {
+			m.usage.Model = msg.Message.Model
+		}
+		m.usage.Window = m.window(m.usage.Model)
+	case *message.ResultMessage:
+		for model, u := range msg.ModelUsage {
+			if u.ContextWindow > 0 {
+				m.windows[model] = u.ContextWindow
+			}
+		}
+		m.usage.Window = m.window(m.usage.Model)
+		m.usage.Turn++
+		m.turns = append(m.turns, m.usage)
+	default:
+		if _, ok := message.CompactBoundary(msg); !ok {
+			m.mu.Unlock()
+			return
+		}
+		m.usage.Tokens = 0
+		m.usage.Compactions++
+	}
+	usage := m.usage
+	fire := m.crossed(usage)
+	m.mu.Unlock()
+
+	for _, fn := range fire {
+		fn(usage)
+	}
+}
+
+// window returns the context window reported for model, or the largest one
+// reported if model is unknown, as the main model has the largest context.
+func (m *Monitor) window(model string) int {
+	if w, ok := m.windows[model]; ok {
+		return w
+	}
+	largest := 0
+	for _, w := range m.windows {
+		largest = max(largest, w)
+	}
+	if largest == 0 {
+		return m.defaultWindow
+	}
+	return largest
+}
+
+// crossed returns the callbacks of thresholds usage has newly reached and
+// re-arms the ones it is below. Callers must hold m.mu.
+func (m *Monitor) crossed(usage Usage) []func(Usage) {
+	var fire []func(Usage)
+	for _, t := range m.thresholds {
+		above := usage.Window > 0 && usage.Fraction() >= t.fraction
+		if above && !t.fired {
+			fire = append(fire, t.fn)
+		}
+		t.fired = above
+	}
+	return fire
+}
+
+// Usage returns the current estimate.
+func (m *Monitor) Usage() Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
+
+// Turns returns the estimate at the end of each finished turn, oldest first.
+func (m *Monitor) Turns() []Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Usage(nil), m.turns...)
+}
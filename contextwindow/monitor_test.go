@@ -0,0 +1,81 @@
+package contextwindow
+
+import (
+	"testing"
+
+	"claudeagent/message"
+)
+
+func mustParse(t *testing.T, data string) message.Message {
+	t.Helper()
+	msg, err := message.ParseMessage([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func assistant(id string, input, cacheRead, output int) message.Message {
+	return &message.AssistantMessage{Message: message.APIMessage{
+		ID:    id,
+		Model: "claude-sonnet-4-5",
+		Usage: &message.Usage{InputTokens: input, CacheReadInputTokens: cacheRead, OutputTokens: output},
+	}}
+}
+
+func TestMonitor(t *testing.T) {
+	var fired []Usage
+	mon := NewMonitor(
+		WithWindow(1000),
+		WithThreshold(0.5, func(u Usage) { fired = append(fired, u) }),
+	)
+
+	mon.Observe(assistant("m1", 100, 300, 50))
+	if u := mon.Usage(); u.Tokens != 450 || u.Window != 1000 || u.Model != "claude-sonnet-4-5" || len(fired) != 0 {
+		t.Fatalf("unexpected usage: %+v, fired %v", u, fired)
+	}
+
+	// The result reports the real window, which halves the headroom.
+	mon.Observe(mustParse(t, `{"type":"result","subtype":"success","modelUsage":{"claude-sonnet-4-5":{"contextWindow":800}}}`))
+	if u := mon.Usage(); u.Window != 800 || u.Turn != 1 || len(fired) != 1 || fired[0].Tokens != 450 {
+		t.Fatalf("expected the threshold to fire at the end of the turn: %+v, fired %v", u, fired)
+	}
+
+	// Repeated API messages, subagent messages and growth above the
+	// threshold do not fire again.
+	mon.Observe(assistant("m2", 100, 500, 10))
+	mon.Observe(assistant("m2", 0, 0, 0))
+	parent := "toolu_1"
+	sub := assistant("s1", 10, 0, 0).(*message.AssistantMessage)
+	sub.ParentToolUseID = &parent
+	mon.Observe(sub)
+	if u := mon.Usage(); u.Tokens != 610 || len(fired) != 1 {
+		t.Errorf("unexpected usage: %+v, fired %v", u, fired)
+	}
+
+	// Compaction re-arms the threshold.
+	mon.Observe(mustParse(t, `{"type":"system","subtype":"compact_boundary","compact_metadata":{"trigger":"auto","pre_tokens":610}}`))
+	if u := mon.Usage(); u.Tokens != 0 || u.Compactions != 1 {
+		t.Errorf("unexpected usage after compaction: %+v", u)
+	}
+	mon.Observe(assistant("m3", 500, 0, 0))
+	if len(fired) != 2 {
+		t.Errorf("expected the threshold to fire again after compaction, fired %v", fired)
+	}
+
+	mon.Observe(mustParse(t, `{"type":"result","subtype":"success"}`))
+	turns := mon.Turns()
+	if len(turns) != 2 || turns[0].Tokens != 450 || turns[1].Tokens != 500 || turns[1].Turn != 2 {
+		t.Errorf("unexpected turns: %+v", turns)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	u := Usage{Tokens: 150, Window: 100}
+	if u.Fraction() != 1.5 || u.Remaining() != 0 {
+		t.Errorf("unexpected overfull usage: %v, %d", u.Fraction(), u.Remaining())
+	}
+	if (Usage{Tokens: 10}).Fraction() != 0 {
+		t.Error("expected no fraction without a window")
+	}
+}
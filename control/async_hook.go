@@ -0,0 +1,132 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultAsyncHookTimeout applies to async hooks created without a timeout.
+const DefaultAsyncHookTimeout = 60 * time.Second
+
+// ErrAsyncHookTimeout is the result of an async hook that was not completed
+// within its timeout.
+var ErrAsyncHookTimeout = errors.New("async hook timed out")
+
+// AsyncHook is a hook result that is completed after the callback returns,
+// for hooks that wait on something slow such as an external review. The
+// callback returns Output right away and calls Complete or Fail later from
+// any goroutine:
+//
+//	func(ctx context.Context, input control.HookInput, _ *string) (control.HookOutput, error) {
+//	    hook := control.NewAsyncHook(5 * time.Minute)
+//	    go func() {
+//	        verdict, err := review.Submit(hook.Context(), input)
+//	        if err != nil {
+//	            hook.Fail(err)
+//	            return
+//	        }
+//	        hook.Complete(verdict.HookOutput())
+//	    }()
+//	    return hook.Output(), nil
+//	}
+//
+// The SDK holds the CLI's hook request open until the hook completes, then
+// answers it with the final output; the CLI waits for the answer as it does
+// for any hook, so this frees the callback, not the turn. A hook not
+// completed within its timeout is answered with ErrAsyncHookTimeout, which
+// the CLI treats as a non-blocking hook failure. The hook matcher's Timeout
+// and the client's callback timeout bound the wait as well, as does
+// AsyncTimeout if set on the output the callback returns.
+type AsyncHook struct {
+	deadline time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	once   sync.Once
+	done   chan struct{}
+	output HookOutput
+	err    error
+}
+
+// NewAsyncHook creates a pending hook result. The timeout runs from creation;
+// zero or negative uses DefaultAsyncHookTimeout.
+func NewAsyncHook(timeout time.Duration) *AsyncHook {
+	if timeout <= 0 {
+		timeout = DefaultAsyncHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	h := &AsyncHook{
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	h.deadline, _ = ctx.Deadline()
+	return h
+}
+
+// Output is what the callback returns. It only carries the pending hook:
+// nothing is sent to the CLI until the hook completes, fails or times out.
+func (h *AsyncHook) Output() HookOutput {
+	return HookOutput{Pending: h}
+}
+
+// Context is canceled when the hook completes, times out or its session ends.
+// Work done on behalf of the hook should use it.
+func (h *AsyncHook) Context() context.Context {
+	return h.ctx
+}
+
+// Deadline is when the hook times out.
+func (h *AsyncHook) Deadline() time.Time {
+	return h.deadline
+}
+
+// Done is closed once the hook has a result.
+func (h *AsyncHook) Done() <-chan struct{} {
+	return h.done
+}
+
+// Complete finishes the hook with output. It reports false if the hook had
+// already been completed, failed or timed out.
+func (h *AsyncHook) Complete(output HookOutput) bool {
+	output.Pending = nil
+	return h.finish(output, nil)
+}
+
+// Fail finishes the hook with an error. It reports false if the hook had
+// already been completed, failed or timed out.
+func (h *AsyncHook) Fail(err error) bool {
+	if err == nil {
+		err = errors.New("async hook failed")
+	}
+	return h.finish(HookOutput{}, err)
+}
+
+// Wait blocks until the hook has a result, and returns ErrAsyncHookTimeout
+// once the timeout passes. If ctx is done first, the hook is failed with the
+// context's error.
+func (h *AsyncHook) Wait(ctx context.Context) (HookOutput, error) {
+	select {
+	case <-h.done:
+	case <-h.ctx.Done():
+		h.finish(HookOutput{}, ErrAsyncHookTimeout)
+	case <-ctx.Done():
+		h.finish(HookOutput{}, ctx.Err())
+	}
+	<-h.done
+	return h.output, h.err
+}
+
+func (h *AsyncHook) finish(output HookOutput, err error) bool {
+	finished := false
+	h.once.Do(func() {
+		h.output, h.err = output, err
+		finished = true
+		close(h.done)
+		h.cancel()
+	})
+	return finished
+}
@@ -0,0 +1,74 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAsyncHook_Output(t *testing.T) {
+	hook := NewAsyncHook(1500 * time.Millisecond)
+	out := hook.Output()
+	if out.Async || out.AsyncTimeout != nil || out.Pending != hook {
+		t.Errorf("unexpected output: %+v", out)
+	}
+	if d := time.Until(hook.Deadline()); d <= 0 || d > 1500*time.Millisecond {
+		t.Errorf("unexpected deadline in %v", d)
+	}
+}
+
+func TestAsyncHook_Complete(t *testing.T) {
+	hook := NewAsyncHook(time.Minute)
+	go hook.Complete(HookOutput{SystemMessage: "done", Pending: NewAsyncHook(time.Minute)})
+
+	out, err := hook.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.SystemMessage != "done" || out.Pending != nil {
+		t.Errorf("unexpected output: %+v", out)
+	}
+	if hook.Context().Err() == nil {
+		t.Error("expected the context to be canceled after completion")
+	}
+	if hook.Fail(errors.New("late")) {
+		t.Error("expected Fail after Complete to report false")
+	}
+}
+
+func TestAsyncHook_Fail(t *testing.T) {
+	hook := NewAsyncHook(time.Minute)
+	want := errors.New("review service down")
+	hook.Fail(want)
+
+	if _, err := hook.Wait(context.Background()); !errors.Is(err, want) {
+		t.Errorf("expected %v, got %v", want, err)
+	}
+}
+
+func TestAsyncHook_Timeout(t *testing.T) {
+	hook := NewAsyncHook(20 * time.Millisecond)
+
+	if _, err := hook.Wait(context.Background()); !errors.Is(err, ErrAsyncHookTimeout) {
+		t.Errorf("expected ErrAsyncHookTimeout, got %v", err)
+	}
+	if hook.Complete(HookOutput{}) {
+		t.Error("expected Complete after timeout to report false")
+	}
+}
+
+func TestAsyncHook_WaitCanceled(t *testing.T) {
+	hook := NewAsyncHook(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := hook.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	select {
+	case <-hook.Done():
+	default:
+		t.Error("expected the hook to be done")
+	}
+}
@@ -0,0 +1,148 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultCommandHookTimeout applies when neither the matcher nor the context
+// sets a deadline, as for command hooks run by the CLI itself.
+const DefaultCommandHookTimeout = 60 * time.Second
+
+// commandHookWaitDelay bounds how long output pipes held open by orphaned
+// grandchildren may delay a killed hook.
+const commandHookWaitDelay = time.Second
+
+// CommandHookError reports a hook command that failed with an exit code other
+// than 0 or 2, which the CLI treats as a non-blocking error.
+type CommandHookError struct {
+	Command  string
+	ExitCode int
+	Stderr   string
+}
+
+func (e *CommandHookError) Error() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("hook command %s exited with code %d: %s", e.Command, e.ExitCode, e.Stderr)
+	}
+	return fmt.Sprintf("hook command %s exited with code %d", e.Command, e.ExitCode)
+}
+
+// CommandHook runs an existing command hook script, following the CLI's
+// contract: the hook input is written to stdin as JSON, exit code 0 means
+// success with optional JSON output on stdout, and exit code 2 blocks with
+// stderr as the reason. The command runs in the session's working directory
+// with CLAUDE_PROJECT_DIR set. It is not run through a shell; use
+// CommandHook("sh", "-c", script) for shell syntax.
+//
+// HookCallbackMatcher.Timeout is enforced through the context deadline.
+func CommandHook(name string, args ...string) HookCallback {
+	return func(ctx context.Context, input HookInput, _ *string) (HookOutput, error) {
+		if input == nil {
+			return HookOutput{}, errors.New("hook command: unsupported hook event")
+		}
+		stdin, cwd, err := marshalHookInput(input)
+		if err != nil {
+			return HookOutput{}, err
+		}
+
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, DefaultCommandHookTimeout)
+			defer cancel()
+		}
+
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Stdin = bytes.NewReader(stdin)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		cmd.WaitDelay = commandHookWaitDelay
+		cmd.Env = os.Environ()
+		if cwd != "" {
+			cmd.Dir = cwd
+			cmd.Env = append(cmd.Env, "CLAUDE_PROJECT_DIR="+cwd)
+		}
+
+		err = cmd.Run()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return HookOutput{}, fmt.Errorf("hook command %s: %w", name, ctxErr)
+		}
+
+		var exitErr *exec.ExitError
+		switch {
+		case err == nil:
+			return parseCommandOutput(input.HookEventName(), stdout.Bytes()), nil
+		case errors.As(err, &exitErr) && exitErr.ExitCode() == 2:
+			return blockingOutput(input.HookEventName(), strings.TrimSpace(stderr.String())), nil
+		case errors.As(err, &exitErr):
+			return HookOutput{}, &CommandHookError{
+				Command:  name,
+				ExitCode: exitErr.ExitCode(),
+				Stderr:   strings.TrimSpace(stderr.String()),
+			}
+		default:
+			return HookOutput{}, fmt.Errorf("hook command %s: %w", name, err)
+		}
+	}
+}
+
+// marshalHookInput serializes the input with hook_event_name always set, even
+// for inputs built in Go rather than parsed from the CLI, and returns the
+// session's working directory.
+func marshalHookInput(input HookInput) ([]byte, string, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, "", fmt.Errorf("hook command: marshal input: %w", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, "", fmt.Errorf("hook command: marshal input: %w", err)
+	}
+	if name, _ := fields["hook_event_name"].(string); name == "" {
+		fields["hook_event_name"] = string(input.HookEventName())
+	}
+	cwd, _ := fields["cwd"].(string)
+	data, err = json.Marshal(fields)
+	return data, cwd, err
+}
+
+// parseCommandOutput reads JSON output. Plain text from UserPromptSubmit and
+// SessionStart hooks is added as context, as the CLI does; other plain text
+// is ignored.
+func parseCommandOutput(event HookEvent, stdout []byte) HookOutput {
+	trimmed := bytes.TrimSpace(stdout)
+	if len(trimmed) == 0 {
+		return HookOutput{}
+	}
+
+	if trimmed[0] == '{' {
+		var out HookOutput
+		if err := json.Unmarshal(trimmed, &out); err == nil {
+			return out
+		}
+	}
+
+	if event == HookUserPromptSubmit || event == HookSessionStart {
+		return HookOutput{HookSpecificOutput: AdditionalContextOutput{
+			HookEventName:     event,
+			AdditionalContext: string(trimmed),
+		}}
+	}
+	return HookOutput{}
+}
+
+// blockingOutput maps exit code 2 to the event's way of blocking.
+func blockingOutput(event HookEvent, reason string) HookOutput {
+	if event == HookPreToolUse {
+		return PreToolUseOutput{PermissionDecision: PermissionDeny, PermissionDecisionReason: reason}.ToHookOutput()
+	}
+	return HookOutput{Decision: "block", Reason: reason}
+}
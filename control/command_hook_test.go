@@ -0,0 +1,138 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func shellHook(script string) HookCallback {
+	return CommandHook("sh", "-c", script)
+}
+
+func preToolUse(cwd string) *PreToolUseHookInput {
+	return &PreToolUseHookInput{
+		BaseHookInput: BaseHookInput{SessionID: "s1", Cwd: cwd},
+		ToolName:      "Bash",
+		ToolInput:     map[string]any{"command": "rm -rf /"},
+		ToolUseID:     "tu1",
+	}
+}
+
+func TestCommandHook_Stdin(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "input.json")
+	hook := shellHook(`cat > input.json; echo "$CLAUDE_PROJECT_DIR" > project_dir`)
+
+	if _, err := hook(context.Background(), preToolUse(dir), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["hook_event_name"] != "PreToolUse" || got["tool_name"] != "Bash" || got["session_id"] != "s1" || got["cwd"] != dir {
+		t.Errorf("hook input = %v", got)
+	}
+	projectDir, _ := os.ReadFile(filepath.Join(dir, "project_dir"))
+	if strings.TrimSpace(string(projectDir)) != dir {
+		t.Errorf("CLAUDE_PROJECT_DIR = %q, want %q", projectDir, dir)
+	}
+}
+
+func TestCommandHook_JSONOutput(t *testing.T) {
+	hook := shellHook(`echo '{"continue": false, "stopReason": "done", "hookSpecificOutput": {"hookEventName": "PreToolUse", "permissionDecision": "allow"}}'`)
+
+	out, err := hook(context.Background(), preToolUse(""), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Continue == nil || *out.Continue || out.StopReason != "done" {
+		t.Errorf("output = %+v", out)
+	}
+	want := map[string]any{"hookEventName": "PreToolUse", "permissionDecision": "allow"}
+	if !reflect.DeepEqual(out.HookSpecificOutput, want) {
+		t.Errorf("hookSpecificOutput = %v, want %v", out.HookSpecificOutput, want)
+	}
+}
+
+func TestCommandHook_PlainOutput(t *testing.T) {
+	hook := shellHook(`echo "remember the tests"`)
+
+	out, err := hook(context.Background(), &UserPromptSubmitHookInput{Prompt: "hi"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := AdditionalContextOutput{HookEventName: HookUserPromptSubmit, AdditionalContext: "remember the tests"}
+	if out.HookSpecificOutput != want {
+		t.Errorf("hookSpecificOutput = %+v, want %+v", out.HookSpecificOutput, want)
+	}
+
+	out, err = hook(context.Background(), preToolUse(""), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, HookOutput{}) {
+		t.Errorf("plain PreToolUse output = %+v, want empty", out)
+	}
+}
+
+func TestCommandHook_ExitCode2Blocks(t *testing.T) {
+	hook := shellHook(`echo "dangerous command" >&2; exit 2`)
+
+	out, err := hook(context.Background(), preToolUse(""), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PreToolUseSpecificOutput{HookEventName: HookPreToolUse, PermissionDecision: PermissionDeny, PermissionDecisionReason: "dangerous command"}
+	if !reflect.DeepEqual(out.HookSpecificOutput, want) {
+		t.Errorf("PreToolUse output = %+v, want %+v", out.HookSpecificOutput, want)
+	}
+
+	out, err = hook(context.Background(), &StopHookInput{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Decision != "block" || out.Reason != "dangerous command" {
+		t.Errorf("Stop output = %+v", out)
+	}
+}
+
+func TestCommandHook_NonBlockingError(t *testing.T) {
+	hook := shellHook(`echo "oops" >&2; exit 1`)
+
+	_, err := hook(context.Background(), preToolUse(""), nil)
+	var hookErr *CommandHookError
+	if !errors.As(err, &hookErr) {
+		t.Fatalf("error = %v, want *CommandHookError", err)
+	}
+	if hookErr.ExitCode != 1 || hookErr.Stderr != "oops" {
+		t.Errorf("error = %+v", hookErr)
+	}
+}
+
+func TestCommandHook_Timeout(t *testing.T) {
+	hook := shellHook(`sleep 10`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := hook(ctx, preToolUse(""), nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("hook took %v after its deadline", elapsed)
+	}
+}
@@ -0,0 +1,196 @@
+package control
+
+// HookControl holds the output fields every hook event accepts.
+type HookControl struct {
+	// Continue set to false stops the session after the hook.
+	Continue       *bool
+	SuppressOutput *bool
+	// StopReason is shown to the user when Continue is false.
+	StopReason string
+	// SystemMessage is shown to the user.
+	SystemMessage string
+}
+
+func (c HookControl) hookOutput() HookOutput {
+	return HookOutput{
+		Continue:       c.Continue,
+		SuppressOutput: c.SuppressOutput,
+		StopReason:     c.StopReason,
+		SystemMessage:  c.SystemMessage,
+	}
+}
+
+// ToHookOutput converts the common fields alone, for events without
+// event-specific output.
+func (c HookControl) ToHookOutput() HookOutput {
+	return c.hookOutput()
+}
+
+// PreToolUseSpecificOutput is the hookSpecificOutput of a PreToolUse hook.
+type PreToolUseSpecificOutput struct {
+	HookEventName            HookEvent          `json:"hookEventName"`
+	PermissionDecision       PermissionBehavior `json:"permissionDecision,omitempty"`
+	PermissionDecisionReason string             `json:"permissionDecisionReason,omitempty"`
+	UpdatedInput             map[string]any     `json:"updatedInput,omitempty"`
+	AdditionalContext        string             `json:"additionalContext,omitempty"`
+}
+
+// PostToolUseSpecificOutput is the hookSpecificOutput of a PostToolUse hook.
+type PostToolUseSpecificOutput struct {
+	HookEventName        HookEvent `json:"hookEventName"`
+	AdditionalContext    string    `json:"additionalContext,omitempty"`
+	UpdatedMCPToolOutput any       `json:"updatedMCPToolOutput,omitempty"`
+}
+
+// AdditionalContextOutput is the hookSpecificOutput of events that can only
+// add context for the model: UserPromptSubmit, SessionStart, SubagentStart,
+// PostToolUseFailure, Notification and Setup.
+type AdditionalContextOutput struct {
+	HookEventName     HookEvent `json:"hookEventName"`
+	AdditionalContext string    `json:"additionalContext,omitempty"`
+}
+
+// PermissionRequestSpecificOutput is the hookSpecificOutput of a
+// PermissionRequest hook.
+type PermissionRequestSpecificOutput struct {
+	HookEventName HookEvent                 `json:"hookEventName"`
+	Decision      PermissionRequestDecision `json:"decision"`
+}
+
+// PermissionRequestDecision answers a permission dialog on the user's behalf.
+type PermissionRequestDecision struct {
+	Behavior           PermissionBehavior `json:"behavior"`
+	UpdatedInput       map[string]any     `json:"updatedInput,omitempty"`
+	UpdatedPermissions []PermissionUpdate `json:"updatedPermissions,omitempty"`
+	Message            string             `json:"message,omitempty"`
+	Interrupt          bool               `json:"interrupt,omitempty"`
+}
+
+// PreToolUseOutput is the typed result of a PreToolUse hook.
+type PreToolUseOutput struct {
+	HookControl
+	// PermissionDecision allows, denies or asks about the call, bypassing
+	// the permission rules. Empty leaves the decision to the CLI.
+	PermissionDecision       PermissionBehavior
+	PermissionDecisionReason string
+	// UpdatedInput replaces the tool input.
+	UpdatedInput      map[string]any
+	AdditionalContext string
+}
+
+func (o PreToolUseOutput) ToHookOutput() HookOutput {
+	out := o.hookOutput()
+	if o.PermissionDecision != "" || o.PermissionDecisionReason != "" || o.UpdatedInput != nil || o.AdditionalContext != "" {
+		out.HookSpecificOutput = PreToolUseSpecificOutput{
+			HookEventName:            HookPreToolUse,
+			PermissionDecision:       o.PermissionDecision,
+			PermissionDecisionReason: o.PermissionDecisionReason,
+			UpdatedInput:             o.UpdatedInput,
+			AdditionalContext:        o.AdditionalContext,
+		}
+	}
+	return out
+}
+
+// PostToolUseOutput is the typed result of a PostToolUse hook.
+type PostToolUseOutput struct {
+	HookControl
+	// Block feeds Reason back to the model as if the tool had failed.
+	Block  bool
+	Reason string
+	// AdditionalContext is added to the tool result for the model.
+	AdditionalContext string
+	// UpdatedMCPToolOutput replaces the output of an MCP tool.
+	UpdatedMCPToolOutput any
+}
+
+func (o PostToolUseOutput) ToHookOutput() HookOutput {
+	out := o.hookOutput()
+	if o.Block {
+		out.Decision = "block"
+	}
+	out.Reason = o.Reason
+	if o.AdditionalContext != "" || o.UpdatedMCPToolOutput != nil {
+		out.HookSpecificOutput = PostToolUseSpecificOutput{
+			HookEventName:        HookPostToolUse,
+			AdditionalContext:    o.AdditionalContext,
+			UpdatedMCPToolOutput: o.UpdatedMCPToolOutput,
+		}
+	}
+	return out
+}
+
+// UserPromptSubmitOutput is the typed result of a UserPromptSubmit hook.
+type UserPromptSubmitOutput struct {
+	HookControl
+	// Block rejects the prompt; Reason is shown to the user.
+	Block             bool
+	Reason            string
+	AdditionalContext string
+}
+
+func (o UserPromptSubmitOutput) ToHookOutput() HookOutput {
+	out := o.hookOutput()
+	if o.Block {
+		out.Decision = "block"
+	}
+	out.Reason = o.Reason
+	out.HookSpecificOutput = additionalContext(HookUserPromptSubmit, o.AdditionalContext)
+	return out
+}
+
+// ContextOutput is the typed result of hooks that can add context for the
+// model: SessionStart, SubagentStart, PostToolUseFailure, Notification and Setup.
+type ContextOutput struct {
+	HookControl
+	AdditionalContext string
+}
+
+// ToEventOutput converts the output for the given event.
+func (o ContextOutput) ToEventOutput(event HookEvent) HookOutput {
+	out := o.hookOutput()
+	out.HookSpecificOutput = additionalContext(event, o.AdditionalContext)
+	return out
+}
+
+// StopOutput is the typed result of a Stop or SubagentStop hook.
+type StopOutput struct {
+	HookControl
+	// Block keeps the agent going; Reason tells it what is left to do.
+	Block  bool
+	Reason string
+}
+
+func (o StopOutput) ToHookOutput() HookOutput {
+	out := o.hookOutput()
+	if o.Block {
+		out.Decision = "block"
+	}
+	out.Reason = o.Reason
+	return out
+}
+
+// PermissionRequestOutput is the typed result of a PermissionRequest hook.
+// A nil Decision leaves the dialog to the regular permission flow.
+type PermissionRequestOutput struct {
+	HookControl
+	Decision *PermissionRequestDecision
+}
+
+func (o PermissionRequestOutput) ToHookOutput() HookOutput {
+	out := o.hookOutput()
+	if o.Decision != nil {
+		out.HookSpecificOutput = PermissionRequestSpecificOutput{
+			HookEventName: HookPermissionRequest,
+			Decision:      *o.Decision,
+		}
+	}
+	return out
+}
+
+func additionalContext(event HookEvent, context string) any {
+	if context == "" {
+		return nil
+	}
+	return AdditionalContextOutput{HookEventName: event, AdditionalContext: context}
+}
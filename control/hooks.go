@@ -29,6 +29,8 @@ type HookCallback func(
 type HookCallbackMatcher struct {
 	Matcher *string
 	Hooks   []HookCallback
+	// Timeout is the callback deadline in seconds, applied to the context
+	// passed to each hook.
 	Timeout *int
 }
 
@@ -176,4 +178,9 @@ type HookOutput struct {
 	SystemMessage      string `json:"systemMessage,omitempty"`
 	Reason             string `json:"reason,omitempty"`
 	HookSpecificOutput any    `json:"hookSpecificOutput,omitempty"`
+
+	// Pending is set by AsyncHook.Output. The SDK then answers the hook
+	// request with the async hook's final output once it completes, waiting
+	// at most AsyncTimeout seconds if set.
+	Pending *AsyncHook `json:"-"`
 }
@@ -0,0 +1,197 @@
+package claudeagent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"claudeagent/internal/transport"
+)
+
+// EnvMode controls which variables of the SDK process are passed to the CLI
+// and, through it, to every tool and MCP server the CLI starts.
+type EnvMode string
+
+const (
+	// EnvModeInherit passes the full environment of the SDK process (default).
+	EnvModeInherit EnvMode = "inherit"
+	// EnvModeAllowlist passes only allowlisted variables plus the few the CLI
+	// needs to run at all (PATH, HOME, TMPDIR, locale and terminal settings).
+	EnvModeAllowlist EnvMode = "allowlist"
+	// EnvModeClean passes nothing but explicit values from WithEnv and
+	// WithCredentials. PATH must be supplied explicitly if the CLI needs it.
+	EnvModeClean EnvMode = "clean"
+)
+
+// WithEnvMode sets the environment mode. For EnvModeAllowlist, entries match
+// variable names exactly, or by prefix when they end in "*" (e.g. "AWS_*").
+func WithEnvMode(mode EnvMode, allowlist ...string) Option {
+	return func(o *Options) {
+		o.EnvMode = mode
+		o.EnvAllowlist = allowlist
+	}
+}
+
+// ProviderCredentials configure how the CLI authenticates with the model
+// provider. Values are passed as environment variables and redacted from
+// stderr, diagnostics and errors surfaced by the SDK.
+type ProviderCredentials interface {
+	Validate() error
+	Env() map[string]string
+}
+
+// APIKeyCredentials authenticate directly against the Anthropic API.
+type APIKeyCredentials struct {
+	APIKey string
+}
+
+func (c APIKeyCredentials) Validate() error {
+	if c.APIKey == "" {
+		return errors.New("anthropic API key is empty")
+	}
+	if strings.TrimSpace(c.APIKey) != c.APIKey || strings.ContainsAny(c.APIKey, " \t\r\n") {
+		return errors.New("anthropic API key contains whitespace")
+	}
+	return nil
+}
+
+func (c APIKeyCredentials) Env() map[string]string {
+	return map[string]string{"ANTHROPIC_API_KEY": c.APIKey}
+}
+
+// BedrockCredentials route requests through Amazon Bedrock. Either static
+// keys or a named profile must be given.
+type BedrockCredentials struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Profile         string
+}
+
+func (c BedrockCredentials) Validate() error {
+	if c.Region == "" {
+		return errors.New("bedrock: region is required")
+	}
+	if (c.AccessKeyID == "") != (c.SecretAccessKey == "") {
+		return errors.New("bedrock: access key ID and secret access key must be set together")
+	}
+	if c.SessionToken != "" && c.AccessKeyID == "" {
+		return errors.New("bedrock: session token requires static access keys")
+	}
+	if c.AccessKeyID == "" && c.Profile == "" {
+		return errors.New("bedrock: either static access keys or a profile is required")
+	}
+	return nil
+}
+
+func (c BedrockCredentials) Env() map[string]string {
+	env := map[string]string{
+		"CLAUDE_CODE_USE_BEDROCK": "1",
+		"AWS_REGION":              c.Region,
+	}
+	setIfNotEmpty(env, "AWS_ACCESS_KEY_ID", c.AccessKeyID)
+	setIfNotEmpty(env, "AWS_SECRET_ACCESS_KEY", c.SecretAccessKey)
+	setIfNotEmpty(env, "AWS_SESSION_TOKEN", c.SessionToken)
+	setIfNotEmpty(env, "AWS_PROFILE", c.Profile)
+	return env
+}
+
+// VertexCredentials route requests through Google Vertex AI. CredentialsFile
+// is optional when application default credentials are available.
+type VertexCredentials struct {
+	ProjectID       string
+	Region          string
+	CredentialsFile string
+}
+
+func (c VertexCredentials) Validate() error {
+	if c.ProjectID == "" {
+		return errors.New("vertex: project ID is required")
+	}
+	if c.Region == "" {
+		return errors.New("vertex: region is required")
+	}
+	if c.CredentialsFile != "" {
+		if _, err := os.Stat(c.CredentialsFile); err != nil {
+			return fmt.Errorf("vertex: credentials file: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c VertexCredentials) Env() map[string]string {
+	env := map[string]string{
+		"CLAUDE_CODE_USE_VERTEX":      "1",
+		"ANTHROPIC_VERTEX_PROJECT_ID": c.ProjectID,
+		"CLOUD_ML_REGION":             c.Region,
+	}
+	setIfNotEmpty(env, "GOOGLE_APPLICATION_CREDENTIALS", c.CredentialsFile)
+	return env
+}
+
+func setIfNotEmpty(env map[string]string, key, value string) {
+	if value != "" {
+		env[key] = value
+	}
+}
+
+// WithCredentials sets the provider credentials for the CLI. They are
+// validated when the client or query is created.
+func WithCredentials(creds ProviderCredentials) Option {
+	return func(o *Options) {
+		o.Credentials = append(o.Credentials, creds)
+	}
+}
+
+// WithAPIKey is shorthand for WithCredentials(APIKeyCredentials{APIKey: key}).
+func WithAPIKey(key string) Option {
+	return WithCredentials(APIKeyCredentials{APIKey: key})
+}
+
+func validateCredentials(creds []ProviderCredentials) error {
+	if len(creds) > 1 {
+		return fmt.Errorf("invalid credentials: %d providers configured, expected at most one", len(creds))
+	}
+	for _, c := range creds {
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("invalid credentials: %w", err)
+		}
+	}
+	return nil
+}
+
+// buildEnv merges credentials, SDK-managed variables and explicit values.
+// Explicit WithEnv values take precedence over everything else.
+func buildEnv(options *Options, extra map[string]string) map[string]string {
+	if len(options.Credentials) == 0 && len(extra) == 0 {
+		return options.Env
+	}
+	env := make(map[string]string)
+	for _, c := range options.Credentials {
+		for k, v := range c.Env() {
+			env[k] = v
+		}
+	}
+	for k, v := range extra {
+		env[k] = v
+	}
+	for k, v := range options.Env {
+		env[k] = v
+	}
+	return env
+}
+
+func envModeToTransport(mode EnvMode) (transport.EnvMode, error) {
+	switch mode {
+	case "", EnvModeInherit:
+		return transport.EnvInherit, nil
+	case EnvModeAllowlist:
+		return transport.EnvAllowlist, nil
+	case EnvModeClean:
+		return transport.EnvClean, nil
+	default:
+		return transport.EnvInherit, fmt.Errorf("unknown env mode %q", mode)
+	}
+}
@@ -0,0 +1,83 @@
+package claudeagent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWithAPIKey(t *testing.T) {
+	opts := applyOptions([]Option{WithAPIKey("sk-ant-test")})
+	if err := validateOptions(opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	env := buildEnv(opts, nil)
+	if env["ANTHROPIC_API_KEY"] != "sk-ant-test" {
+		t.Errorf("expected API key in env, got %v", env)
+	}
+}
+
+func TestCredentials_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		creds   ProviderCredentials
+		wantErr string
+	}{
+		{"empty key", APIKeyCredentials{}, "empty"},
+		{"key with newline", APIKeyCredentials{APIKey: "sk-ant\n"}, "whitespace"},
+		{"bedrock no region", BedrockCredentials{Profile: "p"}, "region"},
+		{"bedrock half keys", BedrockCredentials{Region: "us-east-1", AccessKeyID: "id"}, "together"},
+		{"bedrock no auth", BedrockCredentials{Region: "us-east-1"}, "profile"},
+		{"bedrock profile", BedrockCredentials{Region: "us-east-1", Profile: "p"}, ""},
+		{"vertex no project", VertexCredentials{Region: "us-east5"}, "project"},
+		{"vertex missing file", VertexCredentials{ProjectID: "p", Region: "us-east5", CredentialsFile: "/nonexistent.json"}, "credentials file"},
+		{"vertex ok", VertexCredentials{ProjectID: "p", Region: "us-east5"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.creds.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateOptions_MultipleProviders(t *testing.T) {
+	opts := applyOptions([]Option{
+		WithAPIKey("sk-ant-test"),
+		WithCredentials(VertexCredentials{ProjectID: "p", Region: "r"}),
+	})
+	if err := validateOptions(opts); err == nil {
+		t.Error("expected error for multiple providers")
+	}
+}
+
+func TestValidateOptions_UnknownEnvMode(t *testing.T) {
+	opts := applyOptions([]Option{WithEnvMode("bogus")})
+	if err := validateOptions(opts); err == nil {
+		t.Error("expected error for unknown env mode")
+	}
+}
+
+func TestBuildEnv_ExplicitOverridesCredentials(t *testing.T) {
+	opts := applyOptions([]Option{
+		WithCredentials(BedrockCredentials{Region: "us-east-1", Profile: "p"}),
+		WithEnvVar("AWS_REGION", "eu-west-1"),
+	})
+
+	env := buildEnv(opts, nil)
+	if env["AWS_REGION"] != "eu-west-1" {
+		t.Errorf("expected explicit region to win, got %q", env["AWS_REGION"])
+	}
+	if env["CLAUDE_CODE_USE_BEDROCK"] != "1" {
+		t.Errorf("expected bedrock flag, got %v", env)
+	}
+}
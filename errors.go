@@ -3,6 +3,11 @@ package claudeagent
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
+
+	"claudeagent/internal/protocol"
+	"claudeagent/internal/transport"
 )
 
 var (
@@ -10,6 +15,12 @@ var (
 	ErrNotConnected  = errors.New("client not connected")
 	ErrAlreadyClosed = errors.New("client already closed")
 	ErrAborted       = errors.New("operation aborted")
+	// ErrUnknownCheckpoint is returned for a checkpoint not in Checkpoints.
+	ErrUnknownCheckpoint = errors.New("unknown checkpoint")
+
+	ErrCLIAuth        = errors.New("claude CLI authentication failed")
+	ErrCLIInvalidFlag = errors.New("claude CLI rejected a command-line flag")
+	ErrCLIRuntime     = errors.New("claude CLI runtime error")
 )
 
 type AbortError struct {
@@ -38,6 +49,7 @@ func (e *CLINotFoundError) Error() string {
 type ConnectionError struct {
 	Message string
 	Cause   error
+	Stderr  []string
 }
 
 func (e *ConnectionError) Error() string {
@@ -61,6 +73,39 @@ func (e *ProcessError) Error() string {
 	return fmt.Sprintf("process error (exit %d): %s", e.ExitCode, e.Message)
 }
 
+type CLIErrorKind string
+
+const (
+	CLIErrorAuth        CLIErrorKind = "auth"
+	CLIErrorInvalidFlag CLIErrorKind = "invalid_flag"
+	CLIErrorRuntime     CLIErrorKind = "runtime"
+)
+
+// CLIError is a CLI failure recognised from its stderr output, such as an
+// authentication problem, a rejected flag or a broken Node.js runtime.
+type CLIError struct {
+	Kind     CLIErrorKind
+	Message  string
+	ExitCode *int
+	Stderr   []string
+}
+
+func (e *CLIError) Error() string {
+	return fmt.Sprintf("claude CLI %s error: %s", e.Kind, e.Message)
+}
+
+func (e *CLIError) Is(target error) bool {
+	switch e.Kind {
+	case CLIErrorAuth:
+		return target == ErrCLIAuth
+	case CLIErrorInvalidFlag:
+		return target == ErrCLIInvalidFlag
+	case CLIErrorRuntime:
+		return target == ErrCLIRuntime
+	}
+	return false
+}
+
 type JSONDecodeError struct {
 	Line  string
 	Cause error
@@ -101,6 +146,141 @@ func (e *TimeoutError) Error() string {
 	return fmt.Sprintf("timeout: %s", e.Operation)
 }
 
+// CallbackPanicError reports a permission or hook callback that panicked.
+// The CLI was sent an error response for the request and the session
+// continues.
+type CallbackPanicError struct {
+	Callback string
+	Value    any
+	Stack    []byte
+}
+
+func (e *CallbackPanicError) Error() string {
+	return fmt.Sprintf("%s panicked: %v", e.Callback, e.Value)
+}
+
+type StallAction string
+
+const (
+	StallActionNone      StallAction = "none"
+	StallActionInterrupt StallAction = "interrupt"
+	StallActionRestart   StallAction = "restart"
+)
+
+// StallEvent describes a turn during which the CLI produced no output for
+// longer than the configured stall timeout.
+type StallEvent struct {
+	Idle            time.Duration
+	LastActivity    time.Time
+	LastMessageType string
+	Action          StallAction
+}
+
+type StallError struct {
+	StallEvent
+}
+
+func (e *StallError) Error() string {
+	return fmt.Sprintf("CLI stalled: no output for %s (last message: %s, action: %s)",
+		e.Idle.Round(time.Millisecond), e.LastMessageType, e.Action)
+}
+
+// translateError maps internal transport errors onto the public error types.
+func translateError(err error) error {
+	var stall *transport.StallError
+	if errors.As(err, &stall) {
+		return &StallError{StallEvent: stallEventFromTransport(stall.Event)}
+	}
+	var panicErr *protocol.CallbackPanicError
+	if errors.As(err, &panicErr) {
+		return &CallbackPanicError{Callback: panicErr.Callback, Value: panicErr.Value, Stack: panicErr.Stack}
+	}
+	var decode *transport.DecodeError
+	if errors.As(err, &decode) {
+		return &JSONDecodeError{Line: decode.Line, Cause: decode.Err}
+	}
+	var exit *transport.ExitError
+	if errors.As(err, &exit) {
+		if cliErr := classifyStderr(exit.Stderr, &exit.ExitCode); cliErr != nil {
+			return cliErr
+		}
+		return &ProcessError{
+			Message:  "CLI exited unexpectedly",
+			ExitCode: exit.ExitCode,
+			Stderr:   strings.Join(exit.Stderr, "\n"),
+		}
+	}
+	return err
+}
+
+func classifyStderr(lines []string, exitCode *int) *CLIError {
+	kind, line, ok := transport.ClassifyStderr(lines)
+	if !ok {
+		return nil
+	}
+	return &CLIError{
+		Kind:     CLIErrorKind(kind),
+		Message:  line,
+		ExitCode: exitCode,
+		Stderr:   lines,
+	}
+}
+
+// newConnectionError attaches the stderr tail to a failed connect, and uses a
+// recognised CLI failure as the cause when there is one.
+func newConnectionError(message string, cause error, stderr []string) *ConnectionError {
+	cause = translateError(cause)
+	var cliErr *CLIError
+	if !errors.As(cause, &cliErr) {
+		if classified := classifyStderr(stderr, nil); classified != nil {
+			cause = fmt.Errorf("%w: %w", classified, cause)
+		}
+	}
+	return &ConnectionError{Message: message, Cause: cause, Stderr: stderr}
+}
+
+func translateErrors(in <-chan error) <-chan error {
+	out := make(chan error, cap(in))
+	go func() {
+		defer close(out)
+		for err := range in {
+			out <- translateError(err)
+		}
+	}()
+	return out
+}
+
+func stallEventFromTransport(e transport.StallEvent) StallEvent {
+	return StallEvent{
+		Idle:            e.Idle,
+		LastActivity:    e.LastActivity,
+		LastMessageType: e.LastMessageType,
+		Action:          stallActionFromTransport(e.Action),
+	}
+}
+
+func stallActionFromTransport(a transport.StallAction) StallAction {
+	switch a {
+	case transport.StallActionInterrupt:
+		return StallActionInterrupt
+	case transport.StallActionRestart:
+		return StallActionRestart
+	default:
+		return StallActionNone
+	}
+}
+
+func stallActionToTransport(a StallAction) transport.StallAction {
+	switch a {
+	case StallActionInterrupt:
+		return transport.StallActionInterrupt
+	case StallActionRestart:
+		return transport.StallActionRestart
+	default:
+		return transport.StallActionNone
+	}
+}
+
 func truncate(s string, maxLen int) string {
 	if len(s) <= maxLen {
 		return s
@@ -3,6 +3,10 @@ package claudeagent
 import (
 	"errors"
 	"testing"
+	"time"
+
+	"claudeagent/internal/protocol"
+	"claudeagent/internal/transport"
 )
 
 func TestCLINotFoundError(t *testing.T) {
@@ -118,3 +122,88 @@ func TestTruncate(t *testing.T) {
 		}
 	}
 }
+
+func TestTranslateError_Stall(t *testing.T) {
+	err := translateError(&transport.StallError{Event: transport.StallEvent{
+		Idle:            2 * time.Minute,
+		LastMessageType: "assistant",
+		Action:          transport.StallActionRestart,
+	}})
+
+	var stall *StallError
+	if !errors.As(err, &stall) {
+		t.Fatalf("expected *StallError, got %T", err)
+	}
+	if stall.Action != StallActionRestart {
+		t.Errorf("expected action 'restart', got %q", stall.Action)
+	}
+	if stall.Idle != 2*time.Minute {
+		t.Errorf("expected idle 2m, got %v", stall.Idle)
+	}
+}
+
+func TestTranslateError_Passthrough(t *testing.T) {
+	orig := errors.New("other")
+	if err := translateError(orig); err != orig {
+		t.Errorf("expected error to pass through, got %v", err)
+	}
+}
+
+func TestTranslateError_ExitClassified(t *testing.T) {
+	err := translateError(&transport.ExitError{ExitCode: 1, Stderr: []string{"Invalid API key"}})
+
+	if !errors.Is(err, ErrCLIAuth) {
+		t.Errorf("expected ErrCLIAuth, got %v", err)
+	}
+	var cliErr *CLIError
+	if !errors.As(err, &cliErr) || cliErr.ExitCode == nil || *cliErr.ExitCode != 1 {
+		t.Errorf("expected *CLIError with exit code 1, got %v", err)
+	}
+}
+
+func TestTranslateError_ExitUnclassified(t *testing.T) {
+	err := translateError(&transport.ExitError{ExitCode: 3, Stderr: []string{"boom", "bang"}})
+
+	var procErr *ProcessError
+	if !errors.As(err, &procErr) {
+		t.Fatalf("expected *ProcessError, got %T", err)
+	}
+	if procErr.ExitCode != 3 || procErr.Stderr != "boom\nbang" {
+		t.Errorf("unexpected process error: %+v", procErr)
+	}
+}
+
+func TestTranslateError_Decode(t *testing.T) {
+	err := translateError(&transport.DecodeError{Line: `{"key":"[REDACTED]"`, Err: errors.New("unexpected end of JSON input")})
+
+	var decodeErr *JSONDecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("expected *JSONDecodeError, got %T", err)
+	}
+	if decodeErr.Line != `{"key":"[REDACTED]"` || decodeErr.Cause.Error() != "unexpected end of JSON input" {
+		t.Errorf("unexpected decode error: %+v", decodeErr)
+	}
+}
+
+func TestNewConnectionError_ClassifiesStderr(t *testing.T) {
+	err := newConnectionError("failed to initialize", errors.New("eof"), []string{"error: unknown option '--x'"})
+
+	if !errors.Is(err, ErrCLIInvalidFlag) {
+		t.Errorf("expected ErrCLIInvalidFlag, got %v", err)
+	}
+	if len(err.Stderr) != 1 {
+		t.Errorf("expected stderr to be attached, got %v", err.Stderr)
+	}
+}
+
+func TestTranslateError_CallbackPanic(t *testing.T) {
+	err := translateError(&protocol.CallbackPanicError{Callback: "hook callback hook_0", Value: "boom", Stack: []byte("stack")})
+
+	var panicErr *CallbackPanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("expected *CallbackPanicError, got %T", err)
+	}
+	if panicErr.Callback != "hook callback hook_0" || panicErr.Value != "boom" || string(panicErr.Stack) != "stack" {
+		t.Errorf("unexpected error: %+v", panicErr)
+	}
+}
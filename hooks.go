@@ -0,0 +1,126 @@
+package claudeagent
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"claudeagent/control"
+)
+
+// OnHook registers a typed callback for event. The matcher is a regular
+// expression on the event's match field (the tool name for tool events, the
+// source for SessionStart, ...); "" and "*" match everything. An invalid
+// matcher is reported by NewClient or Query. convert turns the typed output
+// into the wire format.
+func OnHook[I control.HookInput, O any](event control.HookEvent, matcher string, fn func(context.Context, I) (O, error), convert func(O) control.HookOutput) Option {
+	return func(o *Options) {
+		m, err := hookMatcher(matcher)
+		if err != nil {
+			o.optionErrors = append(o.optionErrors, fmt.Errorf("%s hook: %w", event, err))
+			return
+		}
+
+		callback := func(ctx context.Context, input control.HookInput, _ *string) (control.HookOutput, error) {
+			typed, ok := input.(I)
+			if !ok {
+				return control.HookOutput{}, fmt.Errorf("%s hook received unexpected input %T", event, input)
+			}
+			out, err := fn(ctx, typed)
+			if err != nil {
+				return control.HookOutput{}, err
+			}
+			return convert(out), nil
+		}
+		WithHooks(event, control.HookCallbackMatcher{Matcher: m, Hooks: []control.HookCallback{callback}})(o)
+	}
+}
+
+func hookMatcher(matcher string) (*string, error) {
+	if matcher == "" || matcher == "*" {
+		return nil, nil
+	}
+	if _, err := regexp.Compile(matcher); err != nil {
+		return nil, fmt.Errorf("invalid matcher %q: %w", matcher, err)
+	}
+	return &matcher, nil
+}
+
+func toHookOutput[O interface{ ToHookOutput() control.HookOutput }](o O) control.HookOutput {
+	return o.ToHookOutput()
+}
+
+func contextOutput(event control.HookEvent) func(control.ContextOutput) control.HookOutput {
+	return func(o control.ContextOutput) control.HookOutput {
+		return o.ToEventOutput(event)
+	}
+}
+
+// OnPreToolUse runs fn before tools matching matcher. It can allow, deny or
+// ask about the call, rewrite its input or add context.
+func OnPreToolUse(matcher string, fn func(context.Context, *control.PreToolUseHookInput) (control.PreToolUseOutput, error)) Option {
+	return OnHook(control.HookPreToolUse, matcher, fn, toHookOutput[control.PreToolUseOutput])
+}
+
+// OnPostToolUse runs fn after tools matching matcher succeed.
+func OnPostToolUse(matcher string, fn func(context.Context, *control.PostToolUseHookInput) (control.PostToolUseOutput, error)) Option {
+	return OnHook(control.HookPostToolUse, matcher, fn, toHookOutput[control.PostToolUseOutput])
+}
+
+// OnPostToolUseFailure runs fn after tools matching matcher fail.
+func OnPostToolUseFailure(matcher string, fn func(context.Context, *control.PostToolUseFailureHookInput) (control.ContextOutput, error)) Option {
+	return OnHook(control.HookPostToolUseFailure, matcher, fn, contextOutput(control.HookPostToolUseFailure))
+}
+
+// OnPermissionRequest runs fn when a permission dialog for a tool matching
+// matcher would be shown.
+func OnPermissionRequest(matcher string, fn func(context.Context, *control.PermissionRequestHookInput) (control.PermissionRequestOutput, error)) Option {
+	return OnHook(control.HookPermissionRequest, matcher, fn, toHookOutput[control.PermissionRequestOutput])
+}
+
+// OnUserPromptSubmit runs fn for every prompt before the model sees it.
+func OnUserPromptSubmit(fn func(context.Context, *control.UserPromptSubmitHookInput) (control.UserPromptSubmitOutput, error)) Option {
+	return OnHook(control.HookUserPromptSubmit, "", fn, toHookOutput[control.UserPromptSubmitOutput])
+}
+
+// OnSessionStart runs fn when a session starts; matcher matches the source
+// (startup, resume, clear or compact).
+func OnSessionStart(matcher string, fn func(context.Context, *control.SessionStartHookInput) (control.ContextOutput, error)) Option {
+	return OnHook(control.HookSessionStart, matcher, fn, contextOutput(control.HookSessionStart))
+}
+
+// OnSessionEnd runs fn when a session ends.
+func OnSessionEnd(fn func(context.Context, *control.SessionEndHookInput) (control.HookControl, error)) Option {
+	return OnHook(control.HookSessionEnd, "", fn, toHookOutput[control.HookControl])
+}
+
+// OnStop runs fn when the agent is about to finish its turn.
+func OnStop(fn func(context.Context, *control.StopHookInput) (control.StopOutput, error)) Option {
+	return OnHook(control.HookStop, "", fn, toHookOutput[control.StopOutput])
+}
+
+// OnSubagentStart runs fn when a subagent whose type matches matcher starts.
+func OnSubagentStart(matcher string, fn func(context.Context, *control.SubagentStartHookInput) (control.ContextOutput, error)) Option {
+	return OnHook(control.HookSubagentStart, matcher, fn, contextOutput(control.HookSubagentStart))
+}
+
+// OnSubagentStop runs fn when a subagent is about to finish.
+func OnSubagentStop(matcher string, fn func(context.Context, *control.SubagentStopHookInput) (control.StopOutput, error)) Option {
+	return OnHook(control.HookSubagentStop, matcher, fn, toHookOutput[control.StopOutput])
+}
+
+// OnNotification runs fn for notifications whose type matches matcher.
+func OnNotification(matcher string, fn func(context.Context, *control.NotificationHookInput) (control.ContextOutput, error)) Option {
+	return OnHook(control.HookNotification, matcher, fn, contextOutput(control.HookNotification))
+}
+
+// OnPreCompact runs fn before the conversation is compacted; matcher
+// matches the trigger (manual or auto).
+func OnPreCompact(matcher string, fn func(context.Context, *control.PreCompactHookInput) (control.HookControl, error)) Option {
+	return OnHook(control.HookPreCompact, matcher, fn, toHookOutput[control.HookControl])
+}
+
+// OnSetup runs fn when the CLI runs its setup; matcher matches the trigger.
+func OnSetup(matcher string, fn func(context.Context, *control.SetupHookInput) (control.ContextOutput, error)) Option {
+	return OnHook(control.HookSetup, matcher, fn, contextOutput(control.HookSetup))
+}
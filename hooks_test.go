@@ -0,0 +1,112 @@
+package claudeagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"claudeagent/control"
+)
+
+func TestOnPreToolUse(t *testing.T) {
+	opts := applyOptions([]Option{
+		OnPreToolUse("Bash|Write", func(ctx context.Context, in *PreToolUseHookInput) (PreToolUseOutput, error) {
+			if in.ToolName != "Bash" {
+				return PreToolUseOutput{}, errors.New("unexpected tool")
+			}
+			return PreToolUseOutput{
+				PermissionDecision:       PermissionDeny,
+				PermissionDecisionReason: "no shell",
+				UpdatedInput:             map[string]any{"command": "true"},
+			}, nil
+		}),
+	})
+	if err := validateOptions(opts); err != nil {
+		t.Fatalf("validateOptions failed: %v", err)
+	}
+
+	matchers := opts.Hooks[HookPreToolUse]
+	if len(matchers) != 1 || matchers[0].Matcher == nil || *matchers[0].Matcher != "Bash|Write" {
+		t.Fatalf("unexpected matchers: %+v", matchers)
+	}
+
+	out, err := matchers[0].Hooks[0](context.Background(), &control.PreToolUseHookInput{ToolName: "Bash"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(out)
+	var wire struct {
+		HookSpecificOutput map[string]any `json:"hookSpecificOutput"`
+	}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		t.Fatal(err)
+	}
+	specific := wire.HookSpecificOutput
+	if specific["hookEventName"] != "PreToolUse" || specific["permissionDecision"] != "deny" ||
+		specific["permissionDecisionReason"] != "no shell" {
+		t.Errorf("unexpected hookSpecificOutput: %s", data)
+	}
+	if input, _ := specific["updatedInput"].(map[string]any); input["command"] != "true" {
+		t.Errorf("updatedInput missing: %s", data)
+	}
+
+	if _, err := matchers[0].Hooks[0](context.Background(), &control.StopHookInput{}, nil); err == nil {
+		t.Error("expected error for mismatched input type")
+	}
+}
+
+func TestOnHook_InvalidMatcher(t *testing.T) {
+	noop := func(ctx context.Context, in *PostToolUseHookInput) (PostToolUseOutput, error) {
+		return PostToolUseOutput{}, nil
+	}
+	_, err := NewClient(WithCLIPath("/bin/true"), OnPostToolUse("Bash(", noop))
+	if err == nil || !strings.Contains(err.Error(), "PostToolUse hook") {
+		t.Fatalf("expected invalid matcher error, got %v", err)
+	}
+}
+
+func TestOnHook_MatchAll(t *testing.T) {
+	opts := applyOptions([]Option{
+		OnSessionStart("*", func(ctx context.Context, in *SessionStartHookInput) (ContextOutput, error) {
+			return ContextOutput{AdditionalContext: "repo uses Go 1.21"}, nil
+		}),
+	})
+	m := opts.Hooks[HookSessionStart][0]
+	if m.Matcher != nil {
+		t.Errorf("\"*\" should match everything, got %q", *m.Matcher)
+	}
+
+	out, err := m.Hooks[0](context.Background(), &control.SessionStartHookInput{Source: "startup"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	specific, ok := out.HookSpecificOutput.(control.AdditionalContextOutput)
+	if !ok || specific.HookEventName != HookSessionStart || specific.AdditionalContext != "repo uses Go 1.21" {
+		t.Errorf("unexpected output: %+v", out.HookSpecificOutput)
+	}
+}
+
+func TestTypedHookOutputs(t *testing.T) {
+	stop := StopOutput{Block: true, Reason: "tests are failing"}.ToHookOutput()
+	if stop.Decision != "block" || stop.Reason != "tests are failing" {
+		t.Errorf("unexpected stop output: %+v", stop)
+	}
+
+	empty := PreToolUseOutput{}.ToHookOutput()
+	if empty.HookSpecificOutput != nil {
+		t.Errorf("empty PreToolUse output should omit hookSpecificOutput: %+v", empty)
+	}
+
+	prompt := UserPromptSubmitOutput{AdditionalContext: "ctx"}.ToHookOutput()
+	if prompt.HookSpecificOutput == nil || prompt.Decision != "" {
+		t.Errorf("unexpected prompt output: %+v", prompt)
+	}
+
+	perm := PermissionRequestOutput{Decision: &PermissionRequestDecision{Behavior: PermissionAllow}}.ToHookOutput()
+	data, _ := json.Marshal(perm)
+	if !strings.Contains(string(data), `"decision":{"behavior":"allow"}`) {
+		t.Errorf("unexpected permission request output: %s", data)
+	}
+}
@@ -0,0 +1,49 @@
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// CallbackPanicError reports a user callback that panicked. The CLI receives
+// an error response for the request and the session continues.
+type CallbackPanicError struct {
+	Callback string
+	Value    any
+	Stack    []byte
+}
+
+func (e *CallbackPanicError) Error() string {
+	return fmt.Sprintf("%s panicked: %v", e.Callback, e.Value)
+}
+
+type callbackResult[T any] struct {
+	value T
+	err   error
+}
+
+// invokeCallback runs a user callback under recover and stops waiting for it
+// once ctx is done, so a callback that ignores its context cannot hold up the
+// response. The callback keeps running in the background in that case.
+func invokeCallback[T any](ctx context.Context, name string, fn func(context.Context) (T, error)) (T, error) {
+	done := make(chan callbackResult[T], 1)
+	go func() {
+		var res callbackResult[T]
+		defer func() {
+			if v := recover(); v != nil {
+				res = callbackResult[T]{err: &CallbackPanicError{Callback: name, Value: v, Stack: debug.Stack()}}
+			}
+			done <- res
+		}()
+		res.value, res.err = fn(ctx)
+	}()
+
+	select {
+	case res := <-done:
+		return res.value, res.err
+	case <-ctx.Done():
+		var zero T
+		return zero, fmt.Errorf("%s: %w", name, ctx.Err())
+	}
+}
@@ -3,9 +3,12 @@ package protocol
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"claudeagent/control"
 	"claudeagent/mcp"
@@ -52,18 +55,47 @@ type ControlHandler struct {
 	requestID atomic.Uint64
 	pending   map[string]chan *ResponsePayload
 	mu        sync.RWMutex
+	failed    chan struct{}
+	failErr   error
 
-	canUseTool control.CanUseToolFunc
-	hooks      map[control.HookEvent][]control.HookCallbackMatcher
-	hooksByID  map[string]control.HookCallback
+	canUseTool   control.CanUseToolFunc
+	hooks        map[control.HookEvent][]control.HookCallbackMatcher
+	hookMatchers map[control.HookEvent][]HookCallbackMatcher
+	hooksByID    map[string]control.HookCallback
+	hookTimeouts map[string]time.Duration
+
+	callbackTimeout time.Duration
+	asyncHooks      atomic.Int64
 }
 
 func NewControlHandler(sendFn func(ctx context.Context, data []byte) error) *ControlHandler {
 	return &ControlHandler{
-		sendFn:    sendFn,
-		pending:   make(map[string]chan *ResponsePayload),
-		hooksByID: make(map[string]control.HookCallback),
+		sendFn:       sendFn,
+		pending:      make(map[string]chan *ResponsePayload),
+		hooksByID:    make(map[string]control.HookCallback),
+		hookTimeouts: make(map[string]time.Duration),
+		failed:       make(chan struct{}),
+	}
+}
+
+// Fail aborts all pending and future outgoing requests with err. It is called
+// when the CLI process has gone away and no response can arrive anymore.
+func (h *ControlHandler) Fail(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.failErr != nil {
+		return
 	}
+	h.failErr = err
+	close(h.failed)
+}
+
+// SetCallbackTimeout bounds every permission and hook callback. Matcher
+// timeouts apply within it. Zero means no limit.
+func (h *ControlHandler) SetCallbackTimeout(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.callbackTimeout = d
 }
 
 func (h *ControlHandler) SetCanUseTool(fn control.CanUseToolFunc) {
@@ -72,10 +104,47 @@ func (h *ControlHandler) SetCanUseTool(fn control.CanUseToolFunc) {
 	h.canUseTool = fn
 }
 
+// SetHooks registers hook callbacks under generated IDs. HookMatchers returns
+// the matchers to send to the CLI in the initialize request.
 func (h *ControlHandler) SetHooks(hooks map[control.HookEvent][]control.HookCallbackMatcher) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	h.hooks = hooks
+	h.hookMatchers = make(map[control.HookEvent][]HookCallbackMatcher, len(hooks))
+
+	events := make([]string, 0, len(hooks))
+	for event := range hooks {
+		events = append(events, string(event))
+	}
+	sort.Strings(events)
+
+	next := 0
+	for _, name := range events {
+		event := control.HookEvent(name)
+		for _, m := range hooks[event] {
+			ids := make([]string, len(m.Hooks))
+			for i, fn := range m.Hooks {
+				ids[i] = fmt.Sprintf("hook_%d", next)
+				h.hooksByID[ids[i]] = fn
+				if m.Timeout != nil && *m.Timeout > 0 {
+					h.hookTimeouts[ids[i]] = time.Duration(*m.Timeout) * time.Second
+				}
+				next++
+			}
+			h.hookMatchers[event] = append(h.hookMatchers[event], HookCallbackMatcher{
+				Matcher:         m.Matcher,
+				HookCallbackIDs: ids,
+				Timeout:         m.Timeout,
+			})
+		}
+	}
+}
+
+// HookMatchers returns the wire form of the hooks set with SetHooks.
+func (h *ControlHandler) HookMatchers() map[control.HookEvent][]HookCallbackMatcher {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.hookMatchers
 }
 
 func (h *ControlHandler) RegisterHookCallback(id string, fn control.HookCallback) {
@@ -126,6 +195,8 @@ func (h *ControlHandler) SendRequest(ctx context.Context, subtype string, payloa
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
+	case <-h.failed:
+		return nil, fmt.Errorf("control request %s failed: %w", subtype, h.failErr)
 	case resp := <-respChan:
 		if resp.Subtype == "error" {
 			return nil, fmt.Errorf("control error: %s", resp.Error)
@@ -177,6 +248,16 @@ func (h *ControlHandler) handleRequest(ctx context.Context, data []byte) ([]byte
 
 	subtype, _ := req.Request["subtype"].(string)
 
+	base := ctx
+	h.mu.RLock()
+	timeout := h.callbackTimeout
+	h.mu.RUnlock()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	var response map[string]any
 	var respErr error
 
@@ -184,15 +265,31 @@ func (h *ControlHandler) handleRequest(ctx context.Context, data []byte) ([]byte
 	case "can_use_tool":
 		response, respErr = h.handleCanUseTool(ctx, req.Request)
 	case "hook_callback":
-		response, respErr = h.handleHookCallback(ctx, req.Request)
+		var pending *asyncWait
+		response, pending, respErr = h.handleHookCallback(ctx, req.Request)
+		if pending != nil {
+			h.asyncHooks.Add(1)
+			go h.completeAsyncHook(base, req.RequestID, pending)
+			return nil, nil
+		}
 	default:
 		respErr = fmt.Errorf("unknown request subtype: %s", subtype)
 	}
 
+	return encodeResponse(req.RequestID, response, respErr)
+}
+
+// PendingAsyncHooks returns the number of hook requests waiting on an async
+// hook.
+func (h *ControlHandler) PendingAsyncHooks() int {
+	return int(h.asyncHooks.Load())
+}
+
+func encodeResponse(requestID string, response map[string]any, respErr error) ([]byte, error) {
 	resp := ControlResponse{
 		Type: "control_response",
 		Response: ResponsePayload{
-			RequestID: req.RequestID,
+			RequestID: requestID,
 		},
 	}
 
@@ -204,7 +301,61 @@ func (h *ControlHandler) handleRequest(ctx context.Context, data []byte) ([]byte
 		resp.Response.Response = response
 	}
 
-	return json.Marshal(resp)
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	// A panic is answered like any failed callback, and also reported to the
+	// caller since it points at a bug rather than a refusal.
+	var panicErr *CallbackPanicError
+	if errors.As(respErr, &panicErr) {
+		return data, panicErr
+	}
+	return data, nil
+}
+
+// asyncWait is an async hook a request waits on, and when the wait ends.
+type asyncWait struct {
+	hook *control.AsyncHook
+	// deadline is the earliest of the matcher and callback timeouts and the
+	// output's AsyncTimeout, if any; the CLI gives up on the request then.
+	deadline time.Time
+}
+
+// completeAsyncHook answers a hook request once its async result is in, or
+// with ErrAsyncHookTimeout at the wait's deadline. The hook fails if the CLI
+// goes away first.
+func (h *ControlHandler) completeAsyncHook(ctx context.Context, requestID string, pending *asyncWait) {
+	defer h.asyncHooks.Add(-1)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-h.failed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	waitCtx := ctx
+	if !pending.deadline.IsZero() {
+		var cancelWait context.CancelFunc
+		waitCtx, cancelWait = context.WithDeadline(ctx, pending.deadline)
+		defer cancelWait()
+	}
+	output, err := pending.hook.Wait(waitCtx)
+	if ctx.Err() != nil {
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = control.ErrAsyncHookTimeout
+	}
+	var response map[string]any
+	if err == nil {
+		response = hookResponse(output)
+	}
+	data, _ := encodeResponse(requestID, response, err)
+	_ = h.sendFn(ctx, data)
 }
 
 func (h *ControlHandler) handleCanUseTool(ctx context.Context, reqData map[string]any) (map[string]any, error) {
@@ -249,7 +400,9 @@ func (h *ControlHandler) handleCanUseTool(ctx context.Context, reqData map[strin
 		AgentID:        agentID,
 	}
 
-	result, err := fn(ctx, toolName, input, opts)
+	result, err := invokeCallback(ctx, "can_use_tool callback for "+toolName, func(ctx context.Context) (control.PermissionResult, error) {
+		return fn(ctx, toolName, input, opts)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -273,15 +426,26 @@ func (h *ControlHandler) handleCanUseTool(ctx context.Context, reqData map[strin
 	return resp, nil
 }
 
-func (h *ControlHandler) handleHookCallback(ctx context.Context, reqData map[string]any) (map[string]any, error) {
+// handleHookCallback returns the async hook to wait for when the callback
+// deferred its result.
+func (h *ControlHandler) handleHookCallback(ctx context.Context, reqData map[string]any) (map[string]any, *asyncWait, error) {
 	callbackID, _ := reqData["callback_id"].(string)
 
 	h.mu.RLock()
 	fn, ok := h.hooksByID[callbackID]
+	timeout := h.hookTimeouts[callbackID]
 	h.mu.RUnlock()
 
 	if !ok {
-		return map[string]any{"continue": true}, nil
+		return map[string]any{"continue": true}, nil, nil
+	}
+
+	// The matcher timeout bounds the callback, as it bounds command hooks in
+	// the CLI.
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
 	var toolUseID *string
@@ -292,16 +456,32 @@ func (h *ControlHandler) handleHookCallback(ctx context.Context, reqData map[str
 	inputData, _ := json.Marshal(reqData["input"])
 	hookInput := parseHookInput(inputData)
 
-	output, err := fn(ctx, hookInput, toolUseID)
+	output, err := invokeCallback(ctx, "hook callback "+callbackID, func(ctx context.Context) (control.HookOutput, error) {
+		return fn(ctx, hookInput, toolUseID)
+	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if output.Pending != nil {
+		// The timeouts that bound the callback bound the wait as well.
+		wait := &asyncWait{hook: output.Pending}
+		wait.deadline, _ = ctx.Deadline()
+		if output.AsyncTimeout != nil && *output.AsyncTimeout > 0 {
+			at := time.Now().Add(time.Duration(*output.AsyncTimeout) * time.Second)
+			if wait.deadline.IsZero() || at.Before(wait.deadline) {
+				wait.deadline = at
+			}
+		}
+		return nil, wait, nil
 	}
+	return hookResponse(output), nil, nil
+}
 
+func hookResponse(output control.HookOutput) map[string]any {
 	resp := make(map[string]any)
 	data, _ := json.Marshal(output)
 	_ = json.Unmarshal(data, &resp)
-
-	return resp, nil
+	return resp
 }
 
 func parseHookInput(data []byte) control.HookInput {
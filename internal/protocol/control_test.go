@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -326,6 +328,48 @@ func TestControlHandler_HandleHookCallback(t *testing.T) {
 	}
 }
 
+func TestControlHandler_SetHooks(t *testing.T) {
+	sender := &mockSender{}
+	handler := NewControlHandler(sender.send)
+
+	var called []string
+	hook := func(name string) control.HookCallback {
+		return func(ctx context.Context, input control.HookInput, toolUseID *string) (control.HookOutput, error) {
+			called = append(called, name)
+			return control.HookOutput{}, nil
+		}
+	}
+	bash := "Bash"
+	handler.SetHooks(map[control.HookEvent][]control.HookCallbackMatcher{
+		control.HookPreToolUse: {{Matcher: &bash, Hooks: []control.HookCallback{hook("pre1"), hook("pre2")}}},
+		control.HookStop:       {{Hooks: []control.HookCallback{hook("stop")}}},
+	})
+
+	matchers := handler.HookMatchers()
+	pre := matchers[control.HookPreToolUse]
+	if len(pre) != 1 || pre[0].Matcher == nil || *pre[0].Matcher != "Bash" || len(pre[0].HookCallbackIDs) != 2 {
+		t.Fatalf("unexpected PreToolUse matchers: %+v", pre)
+	}
+	stop := matchers[control.HookStop]
+	if len(stop) != 1 || len(stop[0].HookCallbackIDs) != 1 {
+		t.Fatalf("unexpected Stop matchers: %+v", stop)
+	}
+
+	for _, id := range append(pre[0].HookCallbackIDs, stop[0].HookCallbackIDs...) {
+		req, _ := json.Marshal(ControlRequest{
+			Type:      "control_request",
+			RequestID: "req-" + id,
+			Request:   map[string]any{"subtype": "hook_callback", "callback_id": id, "input": map[string]any{}},
+		})
+		if _, err := handler.HandleIncoming(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strings.Join(called, ",") != "pre1,pre2,stop" {
+		t.Errorf("callbacks called: %v", called)
+	}
+}
+
 func TestControlHandler_HandleHookCallback_UnknownID(t *testing.T) {
 	sender := &mockSender{}
 	handler := NewControlHandler(sender.send)
@@ -649,3 +693,254 @@ func TestControlHandler_RequestIDIncrement(t *testing.T) {
 		t.Errorf("request IDs should be unique: %s, %s, %s", id1, id2, id3)
 	}
 }
+
+func TestControlHandler_Fail(t *testing.T) {
+	sender := &mockSender{}
+	handler := NewControlHandler(sender.send)
+
+	exitErr := errors.New("process exited")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		handler.Fail(exitErr)
+	}()
+
+	_, err := handler.SendRequest(context.Background(), "initialize", nil)
+	if !errors.Is(err, exitErr) {
+		t.Errorf("expected process exit error, got %v", err)
+	}
+}
+
+func TestControlHandler_HookTimeout(t *testing.T) {
+	sender := &mockSender{}
+	handler := NewControlHandler(sender.send)
+
+	var deadline time.Duration
+	timeout := 5
+	handler.SetHooks(map[control.HookEvent][]control.HookCallbackMatcher{
+		control.HookStop: {{Timeout: &timeout, Hooks: []control.HookCallback{
+			func(ctx context.Context, input control.HookInput, toolUseID *string) (control.HookOutput, error) {
+				if d, ok := ctx.Deadline(); ok {
+					deadline = time.Until(d)
+				}
+				return control.HookOutput{}, nil
+			},
+		}}},
+	})
+
+	id := handler.HookMatchers()[control.HookStop][0].HookCallbackIDs[0]
+	req, _ := json.Marshal(ControlRequest{
+		Type:      "control_request",
+		RequestID: "req-1",
+		Request:   map[string]any{"subtype": "hook_callback", "callback_id": id, "input": map[string]any{}},
+	})
+	if _, err := handler.HandleIncoming(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if deadline <= 4*time.Second || deadline > 5*time.Second {
+		t.Errorf("callback deadline = %v, want about 5s", deadline)
+	}
+}
+
+func TestControlHandler_CallbackPanic(t *testing.T) {
+	sender := &mockSender{}
+	handler := NewControlHandler(sender.send)
+	handler.SetCanUseTool(func(ctx context.Context, toolName string, input map[string]any, opts control.CanUseToolOptions) (control.PermissionResult, error) {
+		panic("boom")
+	})
+
+	req, _ := json.Marshal(ControlRequest{
+		Type:      "control_request",
+		RequestID: "req-1",
+		Request:   map[string]any{"subtype": "can_use_tool", "tool_name": "Bash", "input": map[string]any{}},
+	})
+	respBytes, err := handler.HandleIncoming(context.Background(), req)
+
+	var panicErr *CallbackPanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("expected *CallbackPanicError, got %v", err)
+	}
+	if panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+		t.Errorf("unexpected panic error: %+v", panicErr)
+	}
+
+	var resp ControlResponse
+	if err := json.Unmarshal(respBytes, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Response.Subtype != "error" || !strings.Contains(resp.Response.Error, "boom") {
+		t.Errorf("expected error response, got %+v", resp.Response)
+	}
+}
+
+func TestControlHandler_CallbackTimeout(t *testing.T) {
+	sender := &mockSender{}
+	handler := NewControlHandler(sender.send)
+	handler.SetCallbackTimeout(50 * time.Millisecond)
+
+	release := make(chan struct{})
+	defer close(release)
+	handler.SetHooks(map[control.HookEvent][]control.HookCallbackMatcher{
+		control.HookStop: {{Hooks: []control.HookCallback{
+			func(ctx context.Context, input control.HookInput, toolUseID *string) (control.HookOutput, error) {
+				<-release // ignores ctx
+				return control.HookOutput{}, nil
+			},
+		}}},
+	})
+
+	id := handler.HookMatchers()[control.HookStop][0].HookCallbackIDs[0]
+	req, _ := json.Marshal(ControlRequest{
+		Type:      "control_request",
+		RequestID: "req-1",
+		Request:   map[string]any{"subtype": "hook_callback", "callback_id": id, "input": map[string]any{}},
+	})
+
+	start := time.Now()
+	respBytes, err := handler.HandleIncoming(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("response took %v", elapsed)
+	}
+
+	var resp ControlResponse
+	if err := json.Unmarshal(respBytes, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Response.Subtype != "error" || !strings.Contains(resp.Response.Error, "deadline exceeded") {
+		t.Errorf("expected deadline error response, got %+v", resp.Response)
+	}
+}
+
+func waitForSent(t *testing.T, sender *mockSender, n int) [][]byte {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if sent := sender.getSent(); len(sent) >= n {
+			return sent
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected %d sent messages, got %d", n, len(sender.getSent()))
+	return nil
+}
+
+func TestControlHandler_AsyncHook(t *testing.T) {
+	asyncTimeout := 1
+	tests := []struct {
+		name            string
+		timeout         time.Duration
+		callbackTimeout time.Duration
+		asyncTimeout    *int
+		complete        bool
+		wantErr         string
+	}{
+		{name: "completed", timeout: time.Minute, complete: true},
+		{name: "timed out", timeout: 20 * time.Millisecond, wantErr: "async hook timed out"},
+		{name: "callback timeout", timeout: time.Minute, callbackTimeout: 20 * time.Millisecond, wantErr: "async hook timed out"},
+		{name: "output timeout", timeout: time.Minute, asyncTimeout: &asyncTimeout, wantErr: "async hook timed out"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := &mockSender{}
+			handler := NewControlHandler(sender.send)
+			handler.SetCallbackTimeout(tt.callbackTimeout)
+
+			hooks := make(chan *control.AsyncHook, 1)
+			handler.SetHooks(map[control.HookEvent][]control.HookCallbackMatcher{
+				control.HookStop: {{Hooks: []control.HookCallback{
+					func(ctx context.Context, input control.HookInput, toolUseID *string) (control.HookOutput, error) {
+						hook := control.NewAsyncHook(tt.timeout)
+						hooks <- hook
+						out := hook.Output()
+						out.AsyncTimeout = tt.asyncTimeout
+						return out, nil
+					},
+				}}},
+			})
+
+			id := handler.HookMatchers()[control.HookStop][0].HookCallbackIDs[0]
+			req, _ := json.Marshal(ControlRequest{
+				Type:      "control_request",
+				RequestID: "req-1",
+				Request:   map[string]any{"subtype": "hook_callback", "callback_id": id, "input": map[string]any{}},
+			})
+			respBytes, err := handler.HandleIncoming(context.Background(), req)
+			if err != nil || respBytes != nil {
+				t.Fatalf("expected deferred response, got %s, %v", respBytes, err)
+			}
+			if n := handler.PendingAsyncHooks(); n != 1 {
+				t.Errorf("expected 1 pending async hook, got %d", n)
+			}
+
+			if tt.complete {
+				hook := <-hooks
+				if !hook.Complete(control.HookOutput{Decision: "block", Reason: "tests failing"}) {
+					t.Fatal("expected Complete to succeed")
+				}
+				if hook.Complete(control.HookOutput{}) {
+					t.Error("expected second Complete to fail")
+				}
+			}
+
+			var resp ControlResponse
+			if err := json.Unmarshal(waitForSent(t, sender, 1)[0], &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Response.RequestID != "req-1" {
+				t.Errorf("expected request ID req-1, got %q", resp.Response.RequestID)
+			}
+			if tt.wantErr != "" {
+				if resp.Response.Subtype != "error" || resp.Response.Error != tt.wantErr {
+					t.Errorf("expected error %q, got %+v", tt.wantErr, resp.Response)
+				}
+			} else {
+				want := map[string]any{"decision": "block", "reason": "tests failing"}
+				if resp.Response.Subtype != "success" || !reflect.DeepEqual(resp.Response.Response, want) {
+					t.Errorf("expected %v, got %+v", want, resp.Response)
+				}
+			}
+
+			deadline := time.Now().Add(time.Second)
+			for handler.PendingAsyncHooks() != 0 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if n := handler.PendingAsyncHooks(); n != 0 {
+				t.Errorf("expected no pending async hooks, got %d", n)
+			}
+		})
+	}
+}
+
+func TestControlHandler_AsyncHook_Fail(t *testing.T) {
+	sender := &mockSender{}
+	handler := NewControlHandler(sender.send)
+
+	hook := control.NewAsyncHook(time.Minute)
+	handler.RegisterHookCallback("cb", func(ctx context.Context, input control.HookInput, toolUseID *string) (control.HookOutput, error) {
+		return hook.Output(), nil
+	})
+	req, _ := json.Marshal(ControlRequest{
+		Type:      "control_request",
+		RequestID: "req-1",
+		Request:   map[string]any{"subtype": "hook_callback", "callback_id": "cb", "input": map[string]any{}},
+	})
+	if _, err := handler.HandleIncoming(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	handler.Fail(errors.New("CLI process exited"))
+	select {
+	case <-hook.Context().Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the async hook to be canceled")
+	}
+	if _, err := hook.Wait(context.Background()); err == nil {
+		t.Error("expected the async hook to fail")
+	}
+	if sent := sender.getSent(); len(sent) != 0 {
+		t.Errorf("expected no response after failure, got %d", len(sent))
+	}
+}
@@ -0,0 +1,175 @@
+package transport
+
+import (
+	"errors"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+type EnvMode int
+
+const (
+	EnvInherit EnvMode = iota
+	EnvAllowlist
+	EnvClean
+)
+
+const redactedValue = "[REDACTED]"
+
+// minRedactLength keeps short values such as "1" or "us" from being
+// redacted everywhere they happen to appear.
+const minRedactLength = 6
+
+// essentialEnv is always passed through in allowlist mode; without it the
+// CLI cannot locate node or a writable home directory.
+var essentialEnv = []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TMPDIR", "TEMP", "TMP", "LANG", "LC_*", "TERM"}
+
+var essentialEnvWindows = []string{"SYSTEMROOT", "SYSTEMDRIVE", "COMSPEC", "PATHEXT", "USERPROFILE", "APPDATA", "LOCALAPPDATA", "PROGRAMDATA"}
+
+var sensitiveEnvMarkers = []string{"KEY", "TOKEN", "SECRET", "PASSWORD", "PASSWD", "CREDENTIAL", "AUTH", "COOKIE"}
+
+// WithEnvMode controls which variables of the SDK process reach the CLI.
+// Allowlist entries match exactly, or by prefix when they end in "*".
+func WithEnvMode(mode EnvMode, allowlist []string) SubprocessOption {
+	return func(t *SubprocessTransport) {
+		t.envMode = mode
+		t.envAllowlist = allowlist
+	}
+}
+
+// buildEnv assembles the child environment. Later entries win, so explicit
+// values override inherited ones.
+func buildEnv(base []string, mode EnvMode, allowlist []string, entrypoint string, explicit map[string]string) []string {
+	var env []string
+	switch mode {
+	case EnvInherit:
+		env = append(env, base...)
+	case EnvAllowlist:
+		patterns := append(append([]string(nil), essentialEnv...), allowlist...)
+		if runtime.GOOS == "windows" {
+			patterns = append(patterns, essentialEnvWindows...)
+		}
+		for _, kv := range base {
+			if matchesEnvPattern(envKey(kv), patterns) {
+				env = append(env, kv)
+			}
+		}
+	case EnvClean:
+	}
+
+	env = append(env, "CLAUDE_CODE_ENTRYPOINT="+entrypoint)
+
+	keys := make([]string, 0, len(explicit))
+	for k := range explicit {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+explicit[k])
+	}
+	return env
+}
+
+func envKey(kv string) string {
+	if i := strings.IndexByte(kv, '='); i >= 0 {
+		return kv[:i]
+	}
+	return kv
+}
+
+func matchesEnvPattern(key string, patterns []string) bool {
+	if runtime.GOOS == "windows" {
+		key = strings.ToUpper(key)
+	}
+	for _, p := range patterns {
+		if runtime.GOOS == "windows" {
+			p = strings.ToUpper(p)
+		}
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == p {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSensitiveEnv reports whether a variable name looks like it holds a secret.
+func IsSensitiveEnv(key string) bool {
+	upper := strings.ToUpper(key)
+	for _, marker := range sensitiveEnvMarkers {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redactor replaces secret values wherever the SDK surfaces CLI output.
+type Redactor struct {
+	replacer *strings.Replacer
+}
+
+// NewRedactor collects the values of sensitive variables in env.
+func NewRedactor(env []string) *Redactor {
+	var secrets []string
+	seen := make(map[string]bool)
+	for _, kv := range env {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 {
+			continue
+		}
+		key, value := kv[:i], kv[i+1:]
+		if len(value) < minRedactLength || seen[value] || !IsSensitiveEnv(key) {
+			continue
+		}
+		seen[value] = true
+		secrets = append(secrets, value)
+	}
+	if len(secrets) == 0 {
+		return &Redactor{}
+	}
+
+	// Longest first, so a secret containing another is replaced whole.
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	pairs := make([]string, 0, 2*len(secrets))
+	for _, s := range secrets {
+		pairs = append(pairs, s, redactedValue)
+	}
+	return &Redactor{replacer: strings.NewReplacer(pairs...)}
+}
+
+func (r *Redactor) Redact(s string) string {
+	if r == nil || r.replacer == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// Error returns err with secrets redacted from its message. The result
+// still matches err with errors.Is and errors.As, but does not unwrap to
+// it, so the unredacted message cannot be recovered from the chain.
+func (r *Redactor) Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if redacted := r.Redact(msg); redacted != msg {
+		return &redactedError{msg: redacted, err: err}
+	}
+	return err
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Is(target error) bool { return errors.Is(e.err, target) }
+
+func (e *redactedError) As(target any) bool { return errors.As(e.err, target) }
@@ -0,0 +1,117 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"claudeagent/message"
+)
+
+func TestBuildEnv_Inherit(t *testing.T) {
+	env := buildEnv([]string{"PATH=/bin", "SECRET=x"}, EnvInherit, nil, "sdk-go", map[string]string{"FOO": "bar"})
+
+	want := []string{"PATH=/bin", "SECRET=x", "CLAUDE_CODE_ENTRYPOINT=sdk-go", "FOO=bar"}
+	if strings.Join(env, ";") != strings.Join(want, ";") {
+		t.Errorf("expected %v, got %v", want, env)
+	}
+}
+
+func TestBuildEnv_Allowlist(t *testing.T) {
+	base := []string{"PATH=/bin", "HOME=/home/u", "AWS_REGION=us-east-1", "AWS_SECRET_ACCESS_KEY=s", "DATABASE_URL=postgres://"}
+	env := buildEnv(base, EnvAllowlist, []string{"AWS_REGION"}, "sdk-go", nil)
+
+	joined := strings.Join(env, ";")
+	for _, want := range []string{"PATH=/bin", "HOME=/home/u", "AWS_REGION=us-east-1"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("expected %q in env, got %v", want, env)
+		}
+	}
+	for _, unwanted := range []string{"AWS_SECRET_ACCESS_KEY", "DATABASE_URL"} {
+		if strings.Contains(joined, unwanted) {
+			t.Errorf("expected %q to be filtered, got %v", unwanted, env)
+		}
+	}
+}
+
+func TestBuildEnv_AllowlistPrefix(t *testing.T) {
+	env := buildEnv([]string{"AWS_REGION=r", "AWS_PROFILE=p", "GCP_X=y"}, EnvAllowlist, []string{"AWS_*"}, "sdk-go", nil)
+
+	joined := strings.Join(env, ";")
+	if !strings.Contains(joined, "AWS_REGION=r") || !strings.Contains(joined, "AWS_PROFILE=p") {
+		t.Errorf("expected AWS_* variables, got %v", env)
+	}
+	if strings.Contains(joined, "GCP_X") {
+		t.Errorf("expected GCP_X to be filtered, got %v", env)
+	}
+}
+
+func TestBuildEnv_Clean(t *testing.T) {
+	env := buildEnv([]string{"PATH=/bin"}, EnvClean, nil, "sdk-go", map[string]string{"ANTHROPIC_API_KEY": "k"})
+
+	want := []string{"CLAUDE_CODE_ENTRYPOINT=sdk-go", "ANTHROPIC_API_KEY=k"}
+	if strings.Join(env, ";") != strings.Join(want, ";") {
+		t.Errorf("expected %v, got %v", want, env)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	r := NewRedactor([]string{
+		"ANTHROPIC_API_KEY=sk-ant-secret-value",
+		"AWS_REGION=us-east-1",
+		"SHORT_TOKEN=abc",
+	})
+
+	got := r.Redact("auth failed for sk-ant-secret-value in us-east-1 (abc)")
+	want := "auth failed for [REDACTED] in us-east-1 (abc)"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestRedactor_Nil(t *testing.T) {
+	var r *Redactor
+	if got := r.Redact("text"); got != "text" {
+		t.Errorf("expected passthrough, got %q", got)
+	}
+}
+
+func TestReadStdout_RedactsDecodeErrors(t *testing.T) {
+	tr := NewSubprocessTransport("claude", nil)
+	tr.redactor = NewRedactor([]string{"ANTHROPIC_API_KEY=sk-ant-secret-value"})
+	tr.ctx = context.Background()
+	tr.msgChan = make(chan message.Message, 1)
+	tr.errChan = make(chan error, 1)
+
+	tr.readStdout(strings.NewReader(`{"type":"assistant","key":"sk-ant-secret-value"` + "\n"))
+
+	err := <-tr.errChan
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("expected a DecodeError, got %T: %v", err, err)
+	}
+	if strings.Contains(err.Error(), "sk-ant-secret-value") || !strings.Contains(decodeErr.Line, "[REDACTED]") {
+		t.Errorf("secret not redacted: %v", err)
+	}
+}
+
+func TestRedactor_Error(t *testing.T) {
+	r := NewRedactor([]string{"ANTHROPIC_API_KEY=sk-ant-secret-value"})
+	cause := &ExitError{ExitCode: 1}
+	err := r.Error(fmt.Errorf("token sk-ant-secret-value rejected: %w", cause))
+	if err.Error() != "token [REDACTED] rejected: CLI exited with code 1" {
+		t.Errorf("unexpected message: %v", err)
+	}
+	var exitErr *ExitError
+	if !errors.Is(err, cause) || !errors.As(err, &exitErr) {
+		t.Error("expected the redacted error to match its cause")
+	}
+	if errors.Unwrap(err) != nil || strings.Contains(fmt.Sprintf("%+v", err), "sk-ant") {
+		t.Error("expected the unredacted message to be unreachable")
+	}
+	if plain := errors.New("plain"); r.Error(plain) != plain {
+		t.Error("expected errors without secrets to be returned as is")
+	}
+}
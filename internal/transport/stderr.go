@@ -0,0 +1,164 @@
+package transport
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+const defaultStderrBufferLines = 200
+
+// ringBuffer keeps the most recent stderr lines of the CLI process.
+type ringBuffer struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	if size <= 0 {
+		size = defaultStderrBufferLines
+	}
+	return &ringBuffer{lines: make([]string, size)}
+}
+
+func (r *ringBuffer) add(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *ringBuffer) snapshot() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]string(nil), r.lines[:r.next]...)
+	}
+	out := make([]string, 0, len(r.lines))
+	out = append(out, r.lines[r.next:]...)
+	return append(out, r.lines[:r.next]...)
+}
+
+type CLIErrorKind string
+
+const (
+	CLIErrorAuth        CLIErrorKind = "auth"
+	CLIErrorInvalidFlag CLIErrorKind = "invalid_flag"
+	CLIErrorRuntime     CLIErrorKind = "runtime"
+)
+
+var cliErrorPatterns = []struct {
+	kind     CLIErrorKind
+	patterns []string
+}{
+	{CLIErrorAuth, []string{
+		"invalid api key",
+		"please run /login",
+		"authentication_error",
+		"not logged in",
+		"oauth token has expired",
+		"unauthorized",
+	}},
+	{CLIErrorInvalidFlag, []string{
+		"error: unknown option",
+		"error: option '",
+		"error: required option",
+		"error: missing required argument",
+		"error: too many arguments",
+	}},
+	{CLIErrorRuntime, []string{
+		"node: not found",
+		"env: node: no such file",
+		"cannot find module",
+		"syntaxerror:",
+		"err_require_esm",
+		"requires node",
+		"unsupported engine",
+	}},
+}
+
+// ClassifyStderr returns the first recognised CLI failure in the given lines.
+func ClassifyStderr(lines []string) (CLIErrorKind, string, bool) {
+	for _, line := range lines {
+		lower := strings.ToLower(line)
+		for _, group := range cliErrorPatterns {
+			for _, p := range group.patterns {
+				if strings.Contains(lower, p) {
+					return group.kind, strings.TrimSpace(line), true
+				}
+			}
+		}
+	}
+	return "", "", false
+}
+
+// ExitError reports that the CLI process exited with a non-zero status
+// outside of a Close or watchdog restart.
+type ExitError struct {
+	ExitCode int
+	Stderr   []string
+}
+
+func (e *ExitError) Error() string {
+	if len(e.Stderr) > 0 {
+		return fmt.Sprintf("CLI exited with code %d: %s", e.ExitCode, e.Stderr[len(e.Stderr)-1])
+	}
+	return fmt.Sprintf("CLI exited with code %d", e.ExitCode)
+}
+
+// DecodeError reports a stdout line that is not a message the SDK can
+// parse. Line has secrets redacted.
+type DecodeError struct {
+	Line string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode CLI output: %v (line: %s)", e.Err, e.Line)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// processWaiter calls cmd.Wait exactly once, whether the exit is observed by
+// the stdout reader or forced by terminateProcess.
+type processWaiter struct {
+	cmd  *exec.Cmd
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func newProcessWaiter(cmd *exec.Cmd) *processWaiter {
+	return &processWaiter{cmd: cmd, done: make(chan struct{})}
+}
+
+func (w *processWaiter) Done() <-chan struct{} {
+	w.once.Do(func() {
+		go func() {
+			w.err = w.cmd.Wait()
+			close(w.done)
+		}()
+	})
+	return w.done
+}
+
+func (w *processWaiter) exitCode() *int {
+	select {
+	case <-w.done:
+	default:
+		return nil
+	}
+	if w.cmd.ProcessState == nil {
+		return nil
+	}
+	code := w.cmd.ProcessState.ExitCode()
+	return &code
+}
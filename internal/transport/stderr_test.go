@@ -0,0 +1,53 @@
+package transport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRingBuffer_KeepsMostRecent(t *testing.T) {
+	r := newRingBuffer(3)
+	for _, line := range []string{"a", "b", "c", "d", "e"} {
+		r.add(line)
+	}
+
+	got := r.snapshot()
+	want := []string{"c", "d", "e"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestRingBuffer_Partial(t *testing.T) {
+	r := newRingBuffer(3)
+	r.add("a")
+
+	got := r.snapshot()
+	if !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("expected [a], got %v", got)
+	}
+}
+
+func TestClassifyStderr(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		kind  CLIErrorKind
+		ok    bool
+	}{
+		{"auth", []string{"Invalid API key · Please run /login"}, CLIErrorAuth, true},
+		{"flag", []string{"error: unknown option '--bogus'"}, CLIErrorInvalidFlag, true},
+		{"node", []string{"/usr/bin/env: node: No such file or directory"}, CLIErrorRuntime, true},
+		{"module", []string{"Error: Cannot find module 'foo'"}, CLIErrorRuntime, true},
+		{"unknown", []string{"something else"}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, _, ok := ClassifyStderr(tt.lines)
+			if ok != tt.ok || kind != tt.kind {
+				t.Errorf("expected (%q, %v), got (%q, %v)", tt.kind, tt.ok, kind, ok)
+			}
+		})
+	}
+}
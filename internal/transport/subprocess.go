@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -23,6 +24,7 @@ import (
 const (
 	channelBufferSize         = 10
 	terminationTimeoutSeconds = 5
+	stderrDrainTimeout        = time.Second
 )
 
 type SubprocessTransport struct {
@@ -36,6 +38,9 @@ type SubprocessTransport struct {
 	stdin  io.WriteCloser
 	stdout io.ReadCloser
 	stderr *os.File
+	waiter *processWaiter
+
+	stderrDone chan struct{}
 
 	parser  *parser.Parser
 	control *protocol.ControlHandler
@@ -50,8 +55,20 @@ type SubprocessTransport struct {
 	connected bool
 
 	env            map[string]string
+	envMode        EnvMode
+	envAllowlist   []string
+	redactor       *Redactor
 	cwd            *string
 	stderrCallback func(string)
+	stderrLines    *ringBuffer
+	exitCode       *int
+
+	watchdog   *watchdog
+	onRestart  func(ctx context.Context) error
+	restartCh  chan io.Reader
+	stateMu    sync.Mutex
+	restarting bool
+	sessionID  string
 }
 
 type SubprocessOption func(*SubprocessTransport)
@@ -88,6 +105,33 @@ func WithStderrCallback(fn func(string)) SubprocessOption {
 	}
 }
 
+// WithStderrBufferSize sets how many recent stderr lines are kept for diagnostics.
+func WithStderrBufferSize(lines int) SubprocessOption {
+	return func(t *SubprocessTransport) {
+		t.stderrLines = newRingBuffer(lines)
+	}
+}
+
+// WithStallWatchdog reports a stall when a turn produces no stdout for the given
+// timeout. Every line counts as liveness, including tool progress and stream events.
+func WithStallWatchdog(timeout time.Duration, action StallAction, onStall func(StallEvent)) SubprocessOption {
+	return func(t *SubprocessTransport) {
+		t.watchdog = &watchdog{
+			timeout: timeout,
+			action:  action,
+			onStall: onStall,
+		}
+	}
+}
+
+// WithRestartHook is called after a stalled process has been replaced, so the
+// owner can re-run the initialize handshake against the new process.
+func WithRestartHook(fn func(ctx context.Context) error) SubprocessOption {
+	return func(t *SubprocessTransport) {
+		t.onRestart = fn
+	}
+}
+
 func NewSubprocessTransport(cliPath string, cmdOpts *cli.CommandOptions, opts ...SubprocessOption) *SubprocessTransport {
 	t := &SubprocessTransport{
 		cliPath:    cliPath,
@@ -100,6 +144,9 @@ func NewSubprocessTransport(cliPath string, cmdOpts *cli.CommandOptions, opts ..
 	for _, opt := range opts {
 		opt(t)
 	}
+	if t.stderrLines == nil {
+		t.stderrLines = newRingBuffer(defaultStderrBufferLines)
+	}
 
 	t.control = protocol.NewControlHandler(t.sendRaw)
 
@@ -145,26 +192,51 @@ func (t *SubprocessTransport) Connect(ctx context.Context) error {
 		return fmt.Errorf("transport already connected")
 	}
 
+	if err := t.startProcess(ctx, t.buildArgs(t.cmdOpts)); err != nil {
+		return err
+	}
+
+	t.ctx, t.cancel = context.WithCancel(ctx)
+	t.msgChan = make(chan message.Message, channelBufferSize)
+	t.errChan = make(chan error, channelBufferSize)
+	t.restartCh = make(chan io.Reader, 1)
+
+	t.wg.Add(1)
+	go t.handleStdout(t.stdout)
+
+	if t.watchdog != nil {
+		if t.promptArg != nil {
+			t.watchdog.arm()
+		}
+		t.wg.Add(1)
+		go t.watch()
+	}
+
+	t.connected = true
+	return nil
+}
+
+func (t *SubprocessTransport) buildArgs(cmdOpts *cli.CommandOptions) []string {
 	var args []string
 	if t.promptArg != nil {
-		args = cli.BuildCommandWithPrompt(t.cliPath, t.cmdOpts, *t.promptArg)
+		args = cli.BuildCommandWithPrompt(t.cliPath, cmdOpts, *t.promptArg)
 	} else {
-		args = cli.BuildCommand(t.cliPath, t.cmdOpts, t.closeStdin)
+		args = cli.BuildCommand(t.cliPath, cmdOpts, t.closeStdin)
 	}
 
-	if t.cmdOpts != nil && t.cmdOpts.Executable != nil {
-		execArgs := append(t.cmdOpts.ExecutableArgs, args...)
-		args = append([]string{*t.cmdOpts.Executable}, execArgs...)
+	if cmdOpts != nil && cmdOpts.Executable != nil {
+		execArgs := append(cmdOpts.ExecutableArgs, args...)
+		args = append([]string{*cmdOpts.Executable}, execArgs...)
 	}
+	return args
+}
 
+func (t *SubprocessTransport) startProcess(ctx context.Context, args []string) error {
 	t.cmd = exec.CommandContext(ctx, args[0], args[1:]...)
 
-	env := os.Environ()
-	env = append(env, "CLAUDE_CODE_ENTRYPOINT="+t.entrypoint)
-	for k, v := range t.env {
-		env = append(env, fmt.Sprintf("%s=%s", k, v))
-	}
+	env := buildEnv(os.Environ(), t.envMode, t.envAllowlist, t.entrypoint, t.env)
 	t.cmd.Env = env
+	t.redactor = NewRedactor(env)
 
 	if t.cwd != nil {
 		if err := cli.ValidateWorkingDirectory(*t.cwd); err != nil {
@@ -191,43 +263,58 @@ func (t *SubprocessTransport) Connect(ctx context.Context) error {
 		return fmt.Errorf("failed to create stdout pipe: %w", err)
 	}
 
-	t.stderr, err = os.CreateTemp("", "claude_stderr_*.log")
+	// A plain pipe rather than cmd.StderrPipe, so Wait never closes the read
+	// side before the buffered lines have been consumed.
+	stderrR, stderrW, err := os.Pipe()
 	if err != nil {
-		return fmt.Errorf("failed to create stderr file: %w", err)
-	}
-	if t.stderrCallback != nil {
-		stderrPipe, pipeErr := t.cmd.StderrPipe()
-		if pipeErr != nil {
-			return fmt.Errorf("failed to create stderr pipe: %w", pipeErr)
-		}
-		go func() {
-			scanner := bufio.NewScanner(stderrPipe)
-			for scanner.Scan() {
-				line := scanner.Text()
-				fmt.Fprintln(t.stderr, line)
-				t.stderrCallback(line)
-			}
-		}()
-	} else {
-		t.cmd.Stderr = t.stderr
+		return fmt.Errorf("failed to create stderr pipe: %w", err)
 	}
+	t.cmd.Stderr = stderrW
+	t.stderr = stderrR
 
-	if err := t.cmd.Start(); err != nil {
+	err = t.cmd.Start()
+	_ = stderrW.Close()
+	if err != nil {
 		t.cleanup()
 		return fmt.Errorf("failed to start CLI: %w", err)
 	}
 
-	t.ctx, t.cancel = context.WithCancel(ctx)
-	t.msgChan = make(chan message.Message, channelBufferSize)
-	t.errChan = make(chan error, channelBufferSize)
-
-	t.wg.Add(1)
-	go t.handleStdout()
+	t.waiter = newProcessWaiter(t.cmd)
+	t.stderrDone = make(chan struct{})
+	go t.readStderr(stderrR, t.stderrDone, t.redactor)
 
-	t.connected = true
 	return nil
 }
 
+func (t *SubprocessTransport) readStderr(r io.Reader, done chan struct{}, redactor *Redactor) {
+	defer close(done)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := redactor.Redact(scanner.Text())
+		t.stderrLines.add(line)
+		if t.stderrCallback != nil {
+			t.stderrCallback(line)
+		}
+	}
+}
+
+// StderrTail returns the most recent stderr lines of the CLI process.
+func (t *SubprocessTransport) StderrTail() []string {
+	return t.stderrLines.snapshot()
+}
+
+// RedactError redacts the secrets passed to the CLI from err's message.
+func (t *SubprocessTransport) RedactError(err error) error {
+	return t.redactor.Error(err)
+}
+
+// ExitCode returns the exit code of the last CLI process, or nil while it is running.
+func (t *SubprocessTransport) ExitCode() *int {
+	t.stateMu.Lock()
+	defer t.stateMu.Unlock()
+	return t.exitCode
+}
+
 func (t *SubprocessTransport) SendMessage(ctx context.Context, msg StreamMessage) error {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
@@ -255,6 +342,10 @@ func (t *SubprocessTransport) SendMessage(ctx context.Context, msg StreamMessage
 		return fmt.Errorf("failed to write message: %w", err)
 	}
 
+	if t.watchdog != nil && msg.Type == "user" {
+		t.watchdog.arm()
+	}
+
 	if t.closeStdin {
 		_ = t.stdin.Close()
 		t.stdin = nil
@@ -332,19 +423,69 @@ func (t *SubprocessTransport) Close() error {
 	return err
 }
 
-func (t *SubprocessTransport) handleStdout() {
+func (t *SubprocessTransport) handleStdout(stdout io.Reader) {
 	defer t.wg.Done()
 	defer close(t.msgChan)
 	defer close(t.errChan)
 
-	scanner := bufio.NewScanner(t.stdout)
+	for stdout != nil {
+		if !t.readStdout(stdout) {
+			return
+		}
+		if !t.takeRestarting() {
+			t.reportExit()
+			return
+		}
+		stdout = t.awaitRestart()
+	}
+}
+
+// reportExit waits for the process to exit after stdout closed. A non-zero
+// exit is reported with the stderr tail, and pending control requests fail
+// instead of waiting forever for a process that is gone.
+func (t *SubprocessTransport) reportExit() {
+	t.mu.RLock()
+	waiter := t.waiter
+	t.mu.RUnlock()
+	if waiter == nil {
+		return
+	}
+
+	select {
+	case <-waiter.Done():
+	case <-t.ctx.Done():
+		return
+	}
+
+	select {
+	case <-t.stderrDone:
+	case <-time.After(stderrDrainTimeout):
+	}
+
+	code := waiter.exitCode()
+	t.stateMu.Lock()
+	t.exitCode = code
+	t.stateMu.Unlock()
+
+	exitErr := errors.New("CLI process exited")
+	if code != nil && *code != 0 {
+		exitErr = &ExitError{ExitCode: *code, Stderr: t.StderrTail()}
+		t.sendError(exitErr)
+	}
+	t.control.Fail(exitErr)
+}
+
+// readStdout consumes one process's stdout until EOF. It returns false if the
+// transport was closed while reading.
+func (t *SubprocessTransport) readStdout(stdout io.Reader) bool {
+	scanner := bufio.NewScanner(stdout)
 	buf := make([]byte, 0, 64*1024)
 	scanner.Buffer(buf, 1024*1024)
 
 	for scanner.Scan() {
 		select {
 		case <-t.ctx.Done():
-			return
+			return false
 		default:
 		}
 
@@ -354,36 +495,30 @@ func (t *SubprocessTransport) handleStdout() {
 		}
 
 		if t.isControlMessage(line) {
-			resp, err := t.control.HandleIncoming(t.ctx, []byte(line))
-			if err != nil {
-				select {
-				case t.errChan <- err:
-				case <-t.ctx.Done():
-					return
-				}
-			}
-			if resp != nil {
-				_ = t.sendRaw(t.ctx, resp)
+			if !t.handleControlLine(line) {
+				return false
 			}
 			continue
 		}
 
 		messages, err := t.parser.ProcessLine(line)
 		if err != nil {
+			err = &DecodeError{Line: t.redactor.Redact(line), Err: t.redactor.Error(err)}
 			select {
 			case t.errChan <- err:
 			case <-t.ctx.Done():
-				return
+				return false
 			}
 			continue
 		}
 
 		for _, msg := range messages {
 			if msg != nil {
+				t.observe(msg)
 				select {
 				case t.msgChan <- msg:
 				case <-t.ctx.Done():
-					return
+					return false
 				}
 			}
 		}
@@ -391,10 +526,49 @@ func (t *SubprocessTransport) handleStdout() {
 
 	if err := scanner.Err(); err != nil {
 		select {
-		case t.errChan <- fmt.Errorf("stdout scanner error: %w", err):
+		case t.errChan <- t.redactor.Error(fmt.Errorf("stdout scanner error: %w", err)):
+		case <-t.ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+func (t *SubprocessTransport) handleControlLine(line string) bool {
+	if t.watchdog != nil {
+		t.watchdog.touch("control")
+		t.watchdog.enter()
+		defer t.watchdog.leave()
+	}
+
+	resp, err := t.control.HandleIncoming(t.ctx, []byte(line))
+	if err != nil {
+		select {
+		case t.errChan <- t.redactor.Error(err):
 		case <-t.ctx.Done():
+			return false
 		}
 	}
+	if resp != nil {
+		_ = t.sendRaw(t.ctx, resp)
+	}
+	return true
+}
+
+func (t *SubprocessTransport) observe(msg message.Message) {
+	if sid := msg.GetSessionID(); sid != "" {
+		t.stateMu.Lock()
+		t.sessionID = sid
+		t.stateMu.Unlock()
+	}
+
+	if t.watchdog == nil {
+		return
+	}
+	t.watchdog.touch(msg.MessageType())
+	if _, ok := msg.(*message.ResultMessage); ok {
+		t.watchdog.disarm()
+	}
 }
 
 func (t *SubprocessTransport) isControlMessage(line string) bool {
@@ -419,14 +593,10 @@ func (t *SubprocessTransport) terminateProcess() error {
 		return nil
 	}
 
-	done := make(chan error, 1)
-	cmd := t.cmd
-	go func() {
-		done <- cmd.Wait()
-	}()
-
+	waiter := t.waiter
 	select {
-	case err := <-done:
+	case <-waiter.Done():
+		err := waiter.err
 		if err != nil && strings.Contains(err.Error(), "signal:") {
 			return nil
 		}
@@ -435,13 +605,13 @@ func (t *SubprocessTransport) terminateProcess() error {
 		if killErr := t.cmd.Process.Kill(); killErr != nil && !isProcessFinished(killErr) {
 			return killErr
 		}
-		<-done
+		<-waiter.Done()
 		return nil
 	case <-t.ctx.Done():
 		if killErr := t.cmd.Process.Kill(); killErr != nil && !isProcessFinished(killErr) {
 			return killErr
 		}
-		<-done
+		<-waiter.Done()
 		return nil
 	}
 }
@@ -454,11 +624,17 @@ func (t *SubprocessTransport) cleanup() {
 
 	if t.stderr != nil {
 		_ = t.stderr.Close()
-		_ = os.Remove(t.stderr.Name())
 		t.stderr = nil
 	}
 
+	if t.waiter != nil && t.waiter.exitCode() != nil {
+		t.stateMu.Lock()
+		t.exitCode = t.waiter.exitCode()
+		t.stateMu.Unlock()
+	}
+
 	t.cmd = nil
+	t.waiter = nil
 }
 
 func isProcessFinished(err error) bool {
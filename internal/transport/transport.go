@@ -11,6 +11,8 @@ type StreamMessage struct {
 	Message         message.UserContent `json:"message"`
 	ParentToolUseID *string             `json:"parent_tool_use_id"`
 	SessionID       string              `json:"session_id"`
+	// UUID names the user message, e.g. to rewind files to it later.
+	UUID string `json:"uuid,omitempty"`
 }
 
 type Transport interface {
@@ -0,0 +1,263 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"claudeagent/internal/cli"
+)
+
+type StallAction int
+
+const (
+	StallActionNone StallAction = iota
+	StallActionInterrupt
+	StallActionRestart
+)
+
+type StallEvent struct {
+	Idle            time.Duration
+	LastActivity    time.Time
+	LastMessageType string
+	Action          StallAction
+}
+
+type StallError struct {
+	Event StallEvent
+}
+
+func (e *StallError) Error() string {
+	return fmt.Sprintf("CLI stalled: no output for %s (last message: %s)", e.Event.Idle.Round(time.Millisecond), e.Event.LastMessageType)
+}
+
+// watchdog tracks time since the last stdout line while a turn is in flight.
+// It is only armed between a user message being sent and the matching result,
+// and is paused while the SDK itself is handling a control request from the CLI.
+type watchdog struct {
+	timeout time.Duration
+	action  StallAction
+	onStall func(StallEvent)
+
+	mu       sync.Mutex
+	last     time.Time
+	lastType string
+	armed    bool
+	busy     int
+	fired    bool
+}
+
+func (w *watchdog) touch(msgType string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.last = time.Now()
+	w.lastType = msgType
+	w.fired = false
+}
+
+func (w *watchdog) arm() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.armed {
+		w.last = time.Now()
+		w.fired = false
+	}
+	w.armed = true
+}
+
+func (w *watchdog) disarm() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.armed = false
+}
+
+func (w *watchdog) enter() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.busy++
+}
+
+func (w *watchdog) leave() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.busy--
+	w.last = time.Now()
+}
+
+// check reports a stall at most once per idle period.
+func (w *watchdog) check(now time.Time) (StallEvent, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.armed || w.busy > 0 || w.fired {
+		return StallEvent{}, false
+	}
+	idle := now.Sub(w.last)
+	if idle < w.timeout {
+		return StallEvent{}, false
+	}
+	w.fired = true
+	return StallEvent{
+		Idle:            idle,
+		LastActivity:    w.last,
+		LastMessageType: w.lastType,
+		Action:          w.action,
+	}, true
+}
+
+func (w *watchdog) interval() time.Duration {
+	interval := w.timeout / 4
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	return interval
+}
+
+func (t *SubprocessTransport) watch() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.watchdog.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case now := <-ticker.C:
+			// The CLI is expected to be quiet while it waits on an async hook.
+			if t.control.PendingAsyncHooks() > 0 {
+				t.watchdog.touch("control")
+				continue
+			}
+			if event, stalled := t.watchdog.check(now); stalled {
+				t.handleStall(event)
+			}
+		}
+	}
+}
+
+func (t *SubprocessTransport) handleStall(event StallEvent) {
+	if t.watchdog.onStall != nil {
+		t.watchdog.onStall(event)
+	}
+
+	select {
+	case t.errChan <- &StallError{Event: event}:
+	case <-t.ctx.Done():
+		return
+	}
+
+	switch event.Action {
+	case StallActionInterrupt:
+		t.interruptStalled()
+	case StallActionRestart:
+		t.restart()
+	}
+}
+
+func (t *SubprocessTransport) interruptStalled() {
+	t.mu.RLock()
+	streaming := t.stdin != nil
+	t.mu.RUnlock()
+
+	if !streaming {
+		_ = t.Interrupt(t.ctx)
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(t.ctx, terminationTimeoutSeconds*time.Second)
+		defer cancel()
+		if err := t.control.Interrupt(ctx); err != nil {
+			_ = t.Interrupt(ctx)
+		}
+	}()
+}
+
+// restart replaces a stalled process with a new one resuming the same session.
+// The stalled turn is abandoned; the caller learns about it from the StallError.
+// Prompt-mode transports have nothing to resume into, so the process is only terminated.
+func (t *SubprocessTransport) restart() {
+	t.stateMu.Lock()
+	sessionID := t.sessionID
+	t.restarting = t.promptArg == nil && sessionID != ""
+	restarting := t.restarting
+	t.stateMu.Unlock()
+
+	t.mu.Lock()
+	if !t.connected {
+		t.mu.Unlock()
+		return
+	}
+	if t.stdin != nil {
+		_ = t.stdin.Close()
+		t.stdin = nil
+	}
+	termErr := t.terminateProcess()
+	t.cleanup()
+	t.watchdog.disarm()
+
+	if !restarting {
+		t.mu.Unlock()
+		if termErr != nil {
+			t.sendError(fmt.Errorf("failed to terminate stalled CLI: %w", termErr))
+		}
+		return
+	}
+
+	var cmdOpts cli.CommandOptions
+	if t.cmdOpts != nil {
+		cmdOpts = *t.cmdOpts
+	}
+	cmdOpts.Resume = &sessionID
+	cmdOpts.Continue = false
+	cmdOpts.ForkSession = false
+	cmdOpts.ResumeSessionAt = nil
+
+	err := t.startProcess(t.ctx, t.buildArgs(&cmdOpts))
+	var stdout io.Reader
+	if err == nil {
+		stdout = t.stdout
+	}
+	t.mu.Unlock()
+
+	t.restartCh <- stdout
+	if err != nil {
+		t.sendError(fmt.Errorf("failed to restart stalled CLI: %w", err))
+		return
+	}
+
+	if t.onRestart != nil {
+		if err := t.onRestart(t.ctx); err != nil {
+			t.sendError(fmt.Errorf("failed to reinitialize restarted CLI: %w", err))
+		}
+	}
+}
+
+func (t *SubprocessTransport) takeRestarting() bool {
+	t.stateMu.Lock()
+	defer t.stateMu.Unlock()
+	restarting := t.restarting
+	t.restarting = false
+	return restarting
+}
+
+// awaitRestart returns the stdout of the replacement process, or nil if the
+// restart failed or the transport was closed meanwhile.
+func (t *SubprocessTransport) awaitRestart() io.Reader {
+	select {
+	case stdout := <-t.restartCh:
+		return stdout
+	case <-t.ctx.Done():
+		return nil
+	}
+}
+
+func (t *SubprocessTransport) sendError(err error) {
+	select {
+	case t.errChan <- t.redactor.Error(err):
+	case <-t.ctx.Done():
+	}
+}
@@ -0,0 +1,66 @@
+package transport
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatchdog_NotArmed(t *testing.T) {
+	w := &watchdog{timeout: 10 * time.Millisecond}
+	w.touch("assistant")
+
+	if _, stalled := w.check(time.Now().Add(time.Second)); stalled {
+		t.Error("expected no stall while disarmed")
+	}
+}
+
+func TestWatchdog_Stall(t *testing.T) {
+	w := &watchdog{timeout: 10 * time.Millisecond, action: StallActionInterrupt}
+	w.arm()
+	w.touch("tool_progress")
+
+	event, stalled := w.check(time.Now().Add(time.Second))
+	if !stalled {
+		t.Fatal("expected stall")
+	}
+	if event.LastMessageType != "tool_progress" {
+		t.Errorf("expected last message type 'tool_progress', got %q", event.LastMessageType)
+	}
+	if event.Action != StallActionInterrupt {
+		t.Errorf("expected interrupt action, got %v", event.Action)
+	}
+
+	if _, stalled := w.check(time.Now().Add(2 * time.Second)); stalled {
+		t.Error("expected stall to be reported once per idle period")
+	}
+
+	w.touch("stream_event")
+	if _, stalled := w.check(time.Now().Add(time.Second)); !stalled {
+		t.Error("expected stall to be reported again after new activity")
+	}
+}
+
+func TestWatchdog_PausedWhileBusy(t *testing.T) {
+	w := &watchdog{timeout: 10 * time.Millisecond}
+	w.arm()
+	w.enter()
+
+	if _, stalled := w.check(time.Now().Add(time.Second)); stalled {
+		t.Error("expected no stall while handling a control request")
+	}
+
+	w.leave()
+	if _, stalled := w.check(time.Now().Add(time.Second)); !stalled {
+		t.Error("expected stall after control request completed")
+	}
+}
+
+func TestWatchdog_DisarmedByResult(t *testing.T) {
+	w := &watchdog{timeout: 10 * time.Millisecond}
+	w.arm()
+	w.disarm()
+
+	if _, stalled := w.check(time.Now().Add(time.Second)); stalled {
+		t.Error("expected no stall after disarm")
+	}
+}
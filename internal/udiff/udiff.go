@@ -0,0 +1,302 @@
+// Package udiff computes line diffs and formats them as unified diffs.
+package udiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultContext is the number of unchanged lines shown around changes.
+const DefaultContext = 3
+
+// NoNewline marks a hunk line that has no newline at the end of the file.
+const NoNewline = `\ No newline at end of file`
+
+// Hunk is one hunk of a unified diff. Lines are prefixed by ' ', '-' or '+'
+// and have no trailing newline; NoNewline follows a line that had none.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []string
+}
+
+// Header returns the hunk's "@@ -a,b +c,d @@" line.
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", span(h.OldStart, h.OldLines), span(h.NewStart, h.NewLines))
+}
+
+func span(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+type opKind int
+
+const (
+	equal opKind = iota
+	del
+	ins
+)
+
+type op struct {
+	kind opKind
+	text string
+	// old and new are the numbers of old and new lines before this op.
+	old, new int
+}
+
+// Diff returns the hunks turning old into new, with context unchanged lines
+// around each change. Equal inputs have no hunks.
+func Diff(old, new string, context int) []Hunk {
+	if old == new {
+		return nil
+	}
+	return hunks(lineOps(SplitLines(old), SplitLines(new)), context)
+}
+
+// Unified formats the diff of old and new as a unified diff with the given
+// file names, or returns "" if they are equal.
+func Unified(oldName, newName, old, new string) string {
+	return Format(oldName, newName, Diff(old, new, DefaultContext))
+}
+
+// Format writes hunks as a unified diff.
+func Format(oldName, newName string, hunks []Hunk) string {
+	if len(hunks) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks {
+		b.WriteString(h.Header())
+		b.WriteByte('\n')
+		for _, line := range h.Lines {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// SplitLines splits s after each newline. The last line has no newline if s
+// does not end with one.
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineOps returns the edit script from a to b, trimming the common prefix
+// and suffix before running Myers' algorithm on the rest.
+func lineOps(a, b []string) []op {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	kinds := make([]opKind, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		kinds = append(kinds, equal)
+	}
+	kinds = append(kinds, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for i := 0; i < suffix; i++ {
+		kinds = append(kinds, equal)
+	}
+
+	ops := make([]op, len(kinds))
+	x, y := 0, 0
+	for i, k := range kinds {
+		ops[i] = op{kind: k, old: x, new: y}
+		switch k {
+		case equal:
+			ops[i].text = a[x]
+			x++
+			y++
+		case del:
+			ops[i].text = a[x]
+			x++
+		case ins:
+			ops[i].text = b[y]
+			y++
+		}
+	}
+	return ops
+}
+
+// maxEditDistance bounds the edit distance myers searches. Past it, the
+// changed lines are diffed as a plain replacement, which keeps the memory of
+// the search, O(D²), at a few megabytes.
+var maxEditDistance = 1000
+
+// myers returns a shortest edit script from a to b, deletions first.
+func myers(a, b []string) []opKind {
+	n, m := len(a), len(b)
+	total := n + m
+	if total == 0 {
+		return nil
+	}
+	off := total + 1
+	v := make([]int, 2*total+3)
+	// trace[d] holds v[-d..d] as it was before step d.
+	var trace [][]int
+
+	for d := 0; d <= min(total, maxEditDistance); d++ {
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, n, m)
+			}
+		}
+	}
+	return replaceAll(n, m)
+}
+
+// replaceAll is the edit script deleting all n lines, then inserting m.
+func replaceAll(n, m int) []opKind {
+	kinds := make([]opKind, 0, n+m)
+	for i := 0; i < n; i++ {
+		kinds = append(kinds, del)
+	}
+	for i := 0; i < m; i++ {
+		kinds = append(kinds, ins)
+	}
+	return kinds
+}
+
+func backtrack(trace [][]int, x, y int) []opKind {
+	var kinds []opKind
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		// v[i] is the furthest x on diagonal i-d.
+		at := func(k int) int { return v[k+d] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		var prevX int
+		if d > 0 {
+			prevX = at(prevK)
+		}
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			kinds = append(kinds, equal)
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				kinds = append(kinds, ins)
+			} else {
+				kinds = append(kinds, del)
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(kinds)-1; i < j; i, j = i+1, j-1 {
+		kinds[i], kinds[j] = kinds[j], kinds[i]
+	}
+	return kinds
+}
+
+// hunks groups an edit script into hunks, merging changes separated by at
+// most 2*context unchanged lines.
+func hunks(ops []op, context int) []Hunk {
+	var result []Hunk
+	i := 0
+	for i < len(ops) {
+		for i < len(ops) && ops[i].kind == equal {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		last, j := i, i
+		for j < len(ops) {
+			if ops[j].kind != equal {
+				last = j
+				j++
+				continue
+			}
+			k := j
+			for k < len(ops) && ops[k].kind == equal {
+				k++
+			}
+			if k == len(ops) || k-j > 2*context {
+				break
+			}
+			j = k
+		}
+		end := last + 1 + context
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		result = append(result, hunk(ops[start:end]))
+		i = end
+	}
+	return result
+}
+
+func hunk(ops []op) Hunk {
+	h := Hunk{OldStart: ops[0].old + 1, NewStart: ops[0].new + 1}
+	for _, o := range ops {
+		prefix := " "
+		switch o.kind {
+		case equal:
+			h.OldLines++
+			h.NewLines++
+		case del:
+			prefix = "-"
+			h.OldLines++
+		case ins:
+			prefix = "+"
+			h.NewLines++
+		}
+		text, hasNewline := strings.CutSuffix(o.text, "\n")
+		h.Lines = append(h.Lines, prefix+text)
+		if !hasNewline {
+			h.Lines = append(h.Lines, NoNewline)
+		}
+	}
+	// An empty range starts at the line before it.
+	if h.OldLines == 0 {
+		h.OldStart--
+	}
+	if h.NewLines == 0 {
+		h.NewStart--
+	}
+	return h
+}
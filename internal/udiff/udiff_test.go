@@ -0,0 +1,165 @@
+package udiff
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	new := "a\nB\nc\nd\ne\nf\ng\nh\ni\nk\nl\n"
+	want := `--- a/x
++++ b/x
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -7,5 +7,5 @@
+ g
+ h
+ i
+-j
+ k
++l
+`
+	if got := Unified("a/x", "b/x", old, new); got != want {
+		t.Errorf("Unified() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDiff_EdgeCases(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     []Hunk
+	}{
+		{"equal", "a\n", "a\n", nil},
+		{"create", "", "a\nb\n", []Hunk{{0, 0, 1, 2, []string{"+a", "+b"}}}},
+		{"delete all", "a\n", "", []Hunk{{1, 1, 0, 0, []string{"-a"}}}},
+		{"no newline", "a\nb", "a\nb\n", []Hunk{{1, 2, 1, 2, []string{" a", "-b", NoNewline, "+b"}}}},
+		{"insert at start", "b\n", "a\nb\n", []Hunk{{1, 1, 1, 2, []string{"+a", " b"}}}},
+		{"merged hunks", "1\n2\n3\n4\n5\n6\n7\n8\n", "1\nX\n3\n4\n5\n6\nY\n8\n",
+			[]Hunk{{1, 8, 1, 8, []string{" 1", "-2", "+X", " 3", " 4", " 5", " 6", "-7", "+Y", " 8"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Diff(tt.old, tt.new, DefaultContext)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiff_RoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomText := func() string {
+		lines := make([]string, rng.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		s := strings.Join(lines, "\n")
+		if rng.Intn(2) == 0 && s != "" {
+			s += "\n"
+		}
+		return s
+	}
+	for i := 0; i < 500; i++ {
+		old, new := randomText(), randomText()
+		for _, context := range []int{0, 1, 3} {
+			if got := apply(t, old, Diff(old, new, context)); got != new {
+				t.Fatalf("applying Diff(%q, %q, %d) gave %q", old, new, context, got)
+			}
+		}
+	}
+}
+
+func TestDiff_MaxEditDistance(t *testing.T) {
+	defer func(d int) { maxEditDistance = d }(maxEditDistance)
+	maxEditDistance = 4
+
+	old, new := "keep\na\nb\nc\nd\nkeep\n", "keep\nw\nx\ny\nz\nkeep\n"
+	hunks := Diff(old, new, 0)
+	if len(hunks) != 1 || hunks[0].OldStart != 2 || hunks[0].OldLines != 4 || hunks[0].NewLines != 4 {
+		t.Fatalf("expected one replace hunk for the changed lines, got %+v", hunks)
+	}
+	if got := apply(t, old, hunks); got != new {
+		t.Errorf("applying the fallback gave %q", got)
+	}
+}
+
+func TestDiff_LargeRewrite(t *testing.T) {
+	var a, b strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&a, "old %d\n", i)
+		fmt.Fprintf(&b, "new %d\n", i)
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	hunks := Diff(a.String(), b.String(), DefaultContext)
+	runtime.ReadMemStats(&after)
+
+	if got := apply(t, a.String(), hunks); got != b.String() {
+		t.Fatal("rewrite did not round-trip")
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 100<<20 {
+		t.Errorf("diffing allocated %d MiB", alloc>>20)
+	}
+}
+
+// apply applies hunks to old, checking their context and line counts.
+func apply(t *testing.T, old string, hunks []Hunk) string {
+	t.Helper()
+	src := SplitLines(old)
+	var out []string
+	next := 0
+	for _, h := range hunks {
+		start := h.OldStart - 1
+		if h.OldLines == 0 {
+			start = h.OldStart
+		}
+		out = append(out, src[next:start]...)
+		next = start
+		oldLines, newLines := 0, 0
+		for i, line := range h.Lines {
+			if line == NoNewline {
+				continue
+			}
+			text := line[1:]
+			if i+1 >= len(h.Lines) || h.Lines[i+1] != NoNewline {
+				text += "\n"
+			}
+			switch line[0] {
+			case ' ':
+				if src[next] != text {
+					t.Fatalf("context %q does not match %q", text, src[next])
+				}
+				out = append(out, text)
+				next++
+				oldLines++
+				newLines++
+			case '-':
+				if src[next] != text {
+					t.Fatalf("deleted %q does not match %q", text, src[next])
+				}
+				next++
+				oldLines++
+			case '+':
+				out = append(out, text)
+				newLines++
+			}
+		}
+		if oldLines != h.OldLines || newLines != h.NewLines {
+			t.Fatalf("hunk %s counts %d,%d lines", h.Header(), oldLines, newLines)
+		}
+	}
+	out = append(out, src[next:]...)
+	return strings.Join(out, "")
+}
@@ -58,6 +58,7 @@ func (it *channelIterator) Next(ctx context.Context) (message.Message, error) {
 				}
 				continue
 			}
+			err = translateError(err)
 			it.lastErr = err
 			return nil, err
 		}
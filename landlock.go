@@ -0,0 +1,75 @@
+package claudeagent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"claudeagent/internal/cli"
+	"claudeagent/sandbox"
+)
+
+// WithLandlock confines the CLI, and every tool and MCP server it starts, with
+// Landlock rules and resource limits enforced by the SDK rather than the CLI.
+// Cwd and AdditionalDirectories are added to the read-write paths, and the CLI
+// installation to the read-only ones. Linux only; NewClient and Query fail if
+// the kernel cannot enforce the rules and cfg.BestEffort is not set. With
+// cfg.BestEffort on other platforms, the CLI runs unconfined.
+func WithLandlock(cfg sandbox.Config) Option {
+	return func(o *Options) {
+		o.Landlock = &cfg
+	}
+}
+
+// hasSandboxWrapper is sandbox.HasWrapper, replaceable in tests.
+var hasSandboxWrapper = sandbox.HasWrapper
+
+// applyLandlock routes the command through the sandbox wrapper, keeping any
+// executable set with WithExecutable as the command the wrapper execs. With
+// BestEffort on a platform without the wrapper, the CLI runs unconfined.
+func applyLandlock(cmdOpts *cli.CommandOptions, options *Options, cliPath string) error {
+	if options.Landlock == nil {
+		return nil
+	}
+	if !hasSandboxWrapper {
+		if !options.Landlock.BestEffort {
+			return fmt.Errorf("%w: Landlock is only available on Linux", sandbox.ErrUnsupported)
+		}
+		return nil
+	}
+
+	cfg := *options.Landlock
+	cfg.ReadOnly = append(append([]string(nil), cfg.ReadOnly...), cliInstallDirs(cliPath)...)
+	cfg.ReadWrite = append([]string(nil), cfg.ReadWrite...)
+	if options.Cwd != nil {
+		cfg.ReadWrite = append(cfg.ReadWrite, *options.Cwd)
+	} else if wd, err := os.Getwd(); err == nil {
+		cfg.ReadWrite = append(cfg.ReadWrite, wd)
+	}
+	cfg.ReadWrite = append(cfg.ReadWrite, options.AdditionalDirectories...)
+
+	wrapper, args, err := sandbox.WrapperArgs(cfg)
+	if err != nil {
+		return err
+	}
+	if cmdOpts.Executable != nil {
+		args = append(append(args, *cmdOpts.Executable), cmdOpts.ExecutableArgs...)
+	}
+	cmdOpts.Executable = &wrapper
+	cmdOpts.ExecutableArgs = args
+	return nil
+}
+
+// cliInstallDirs returns the directories the CLI is installed in, following a
+// launcher symlink such as ~/.local/bin/claude to the real installation.
+func cliInstallDirs(cliPath string) []string {
+	abs, err := filepath.Abs(cliPath)
+	if err != nil {
+		return nil
+	}
+	dirs := []string{filepath.Dir(abs)}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil && resolved != abs {
+		dirs = append(dirs, filepath.Dir(resolved))
+	}
+	return dirs
+}
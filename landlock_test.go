@@ -0,0 +1,76 @@
+package claudeagent
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"claudeagent/sandbox"
+)
+
+func TestApplyLandlock(t *testing.T) {
+	opts := applyOptions([]Option{
+		WithCwd("/work"),
+		WithAdditionalDirectories("/shared"),
+		WithExecutable("node", "--max-old-space-size=4096"),
+		WithLandlock(sandbox.Config{ReadWrite: []string{"/cache"}, BestEffort: true}),
+	})
+	cmdOpts := buildCommandOptions(opts)
+	if err := applyLandlock(cmdOpts, opts, "/usr/local/lib/claude/cli.js"); err != nil {
+		t.Fatalf("applyLandlock failed: %v", err)
+	}
+
+	args := cmdOpts.ExecutableArgs
+	if len(args) != 5 || args[2] != "--" || args[3] != "node" || args[4] != "--max-old-space-size=4096" {
+		t.Fatalf("unexpected wrapper args: %v", args)
+	}
+
+	var cfg sandbox.Config
+	if err := json.Unmarshal([]byte(args[1]), &cfg); err != nil {
+		t.Fatalf("decode config: %v", err)
+	}
+	if want := []string{"/cache", "/work", "/shared"}; !reflect.DeepEqual(cfg.ReadWrite, want) {
+		t.Errorf("ReadWrite = %v, want %v", cfg.ReadWrite, want)
+	}
+	if len(cfg.ReadOnly) == 0 || cfg.ReadOnly[0] != "/usr/local/lib/claude" {
+		t.Errorf("ReadOnly = %v, want CLI install dir", cfg.ReadOnly)
+	}
+	if len(opts.Landlock.ReadWrite) != 1 {
+		t.Errorf("options were modified: %v", opts.Landlock.ReadWrite)
+	}
+}
+
+func TestApplyLandlock_Disabled(t *testing.T) {
+	opts := applyOptions(nil)
+	cmdOpts := buildCommandOptions(opts)
+	if err := applyLandlock(cmdOpts, opts, "claude"); err != nil {
+		t.Fatal(err)
+	}
+	if cmdOpts.Executable != nil {
+		t.Errorf("executable should be unchanged, got %q", *cmdOpts.Executable)
+	}
+}
+
+func TestApplyLandlock_NoWrapper(t *testing.T) {
+	defer func(has bool) { hasSandboxWrapper = has }(hasSandboxWrapper)
+	hasSandboxWrapper = false
+
+	opts := applyOptions([]Option{
+		WithExecutable("node"),
+		WithLandlock(sandbox.Config{BestEffort: true}),
+	})
+	cmdOpts := buildCommandOptions(opts)
+	if err := applyLandlock(cmdOpts, opts, "/usr/local/lib/claude/cli.js"); err != nil {
+		t.Fatal(err)
+	}
+	if cmdOpts.Executable == nil || *cmdOpts.Executable != "node" || len(cmdOpts.ExecutableArgs) != 0 {
+		t.Errorf("expected the CLI command unchanged, got %v %v", cmdOpts.Executable, cmdOpts.ExecutableArgs)
+	}
+
+	opts = applyOptions([]Option{WithLandlock(sandbox.Config{})})
+	cmdOpts = buildCommandOptions(opts)
+	if err := applyLandlock(cmdOpts, opts, "claude"); !errors.Is(err, sandbox.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported without BestEffort, got %v", err)
+	}
+}
@@ -141,12 +141,18 @@ func (s *SdkMcpServer) Version() string { return s.version }
 // ListTools returns all registered tool definitions.
 func (s *SdkMcpServer) ListTools() []ToolDefinition { return s.defs }
 
-// CallTool invokes a tool by name with the given arguments.
-func (s *SdkMcpServer) CallTool(ctx context.Context, name string, args map[string]any) (*ToolResult, error) {
+// CallTool invokes a tool by name with the given arguments. A panicking
+// handler is reported as an error rather than crashing the process.
+func (s *SdkMcpServer) CallTool(ctx context.Context, name string, args map[string]any) (result *ToolResult, err error) {
 	caller, ok := s.tools[name]
 	if !ok {
 		return nil, fmt.Errorf("unknown tool: %s", name)
 	}
+	defer func() {
+		if v := recover(); v != nil {
+			result, err = nil, fmt.Errorf("tool %s panicked: %v", name, v)
+		}
+	}()
 	return caller.call(ctx, args)
 }
 
@@ -2,6 +2,7 @@ package mcp
 
 import (
 	"context"
+	"strings"
 	"testing"
 )
 
@@ -105,3 +106,18 @@ func TestSdkServerConfig(t *testing.T) {
 		t.Error("expected instance to be the server")
 	}
 }
+
+func TestSdkMcpServer_ToolPanic(t *testing.T) {
+	tool := Tool("crash", "Panics", func(ctx context.Context, args EchoInput) (*ToolResult, error) {
+		panic("boom")
+	})
+	server := CreateSdkMcpServer("test-server", AddTool(tool))
+
+	result, err := server.CallTool(context.Background(), "crash", map[string]any{})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected panic error, got %v", err)
+	}
+	if result != nil {
+		t.Errorf("expected nil result, got %+v", result)
+	}
+}
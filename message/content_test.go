@@ -156,3 +156,28 @@ func TestParseContentBlock_InvalidJSON(t *testing.T) {
 		t.Fatal("expected error for invalid JSON")
 	}
 }
+
+func TestUserContent_Blocks(t *testing.T) {
+	text := UserContent{Content: "hello"}
+	blocks := text.Blocks()
+	if len(blocks) != 1 || blocks[0].(*TextBlock).Text != "hello" {
+		t.Errorf("unexpected blocks for string content: %+v", blocks)
+	}
+
+	var msg UserMessage
+	data := `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"tu1","content":"ok"},{"type":"text","text":"next"}]}}`
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		t.Fatal(err)
+	}
+	blocks = msg.Message.Blocks()
+	if len(blocks) != 2 {
+		t.Fatalf("expected 2 blocks, got %d", len(blocks))
+	}
+	result, ok := blocks[0].(*ToolResultBlock)
+	if !ok || result.ToolUseID != "tu1" {
+		t.Errorf("unexpected first block: %+v", blocks[0])
+	}
+	if _, ok := blocks[1].(*TextBlock); !ok {
+		t.Errorf("unexpected second block: %+v", blocks[1])
+	}
+}
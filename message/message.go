@@ -1,5 +1,7 @@
 package message
 
+import "encoding/json"
+
 type Message interface {
 	MessageType() string
 	GetSessionID() string
@@ -21,6 +23,31 @@ type UserContent struct {
 	Content any    `json:"content"`
 }
 
+// Blocks returns the content as content blocks. Plain string content becomes
+// a single text block.
+func (c UserContent) Blocks() []ContentBlock {
+	switch content := c.Content.(type) {
+	case string:
+		return []ContentBlock{&TextBlock{Type: "text", Text: content}}
+	case []ContentBlock:
+		return content
+	case []any:
+		blocks := make([]ContentBlock, 0, len(content))
+		for _, item := range content {
+			data, err := json.Marshal(item)
+			if err != nil {
+				continue
+			}
+			if block, err := ParseContentBlock(data); err == nil {
+				blocks = append(blocks, block)
+			}
+		}
+		return blocks
+	default:
+		return nil
+	}
+}
+
 func (m *UserMessage) MessageType() string  { return "user" }
 func (m *UserMessage) GetSessionID() string { return m.SessionID }
 func (m *UserMessage) GetUUID() string      { return m.UUID }
@@ -167,6 +194,20 @@ func (m *CompactBoundaryMessage) MessageType() string  { return "compact_boundar
 func (m *CompactBoundaryMessage) GetSessionID() string { return m.SessionID }
 func (m *CompactBoundaryMessage) GetUUID() string      { return m.UUID }
 
+// CompactBoundary reports whether msg marks the point where the conversation
+// was compacted, in either form the CLI emits, and returns its metadata.
+func CompactBoundary(msg Message) (*CompactMetadata, bool) {
+	switch m := msg.(type) {
+	case *CompactBoundaryMessage:
+		return m.Metadata, true
+	case *SystemMessage:
+		if m.Subtype == "compact_boundary" {
+			return m.CompactMetadata, true
+		}
+	}
+	return nil, false
+}
+
 type StatusMessage struct {
 	Type      string `json:"type"`
 	Status    string `json:"status"`
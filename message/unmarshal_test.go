@@ -285,6 +285,24 @@ func TestParseMessage_CompactBoundary(t *testing.T) {
 	}
 }
 
+func TestCompactBoundary(t *testing.T) {
+	msg, err := ParseMessage([]byte(`{"type":"system","subtype":"compact_boundary","compact_metadata":{"trigger":"manual","pre_tokens":150000},"uuid":"b1","session_id":"s1"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	meta, ok := CompactBoundary(msg)
+	if !ok || meta == nil || meta.Trigger != "manual" || meta.PreTokens != 150000 {
+		t.Errorf("unexpected compact boundary: %v, %+v", ok, meta)
+	}
+
+	if _, ok := CompactBoundary(&CompactBoundaryMessage{}); !ok {
+		t.Error("expected a compact_boundary message to be a boundary")
+	}
+	if _, ok := CompactBoundary(&SystemMessage{Subtype: "init"}); ok {
+		t.Error("expected an init message not to be a boundary")
+	}
+}
+
 func TestParseMessage_Status(t *testing.T) {
 	data := []byte(`{
 		"type": "status",
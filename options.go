@@ -3,10 +3,15 @@ package claudeagent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"time"
 
 	"claudeagent/control"
 	"claudeagent/mcp"
+	"claudeagent/sandbox"
+	"claudeagent/workspace"
+	"claudeagent/worktree"
 )
 
 type Options struct {
@@ -45,10 +50,29 @@ type Options struct {
 	Executable                      *string
 	ExecutableArgs                  []string
 	Env                             map[string]string
+	EnvMode                         EnvMode
+	EnvAllowlist                    []string
+	Credentials                     []ProviderCredentials
+	ConfigDir                       *ConfigDir
+	Landlock                        *sandbox.Config
 	CLIPath                         *string
 	ExtraArgs                       map[string]*string
 	Stderr                          func(data string)
+	StderrBufferSize                int
 	SpawnClaudeCodeProcess          SpawnFunc
+	StallTimeout                    time.Duration
+	StallAction                     StallAction
+	OnStall                         func(StallEvent)
+	CallbackTimeout                 time.Duration
+	OnWorkspaceChanges              func(TurnChanges)
+	WorkspaceOptions                []workspace.Option
+	WorktreeRepo                    string
+	WorktreeOptions                 []worktree.Option
+	OnWorktreeResult                func(*worktree.Result, error)
+
+	// optionErrors are reported by validateOptions, since options cannot
+	// return errors themselves.
+	optionErrors []error
 }
 
 type SystemPromptConfig struct {
@@ -371,6 +395,14 @@ func WithStderr(fn func(string)) Option {
 	}
 }
 
+// WithStderrBufferSize sets how many recent stderr lines are kept for
+// Client.Diagnostics and attached to process errors.
+func WithStderrBufferSize(lines int) Option {
+	return func(o *Options) {
+		o.StderrBufferSize = lines
+	}
+}
+
 func WithExtraArg(name string, value *string) Option {
 	return func(o *Options) {
 		if o.ExtraArgs == nil {
@@ -416,6 +448,33 @@ func WithFallbackModel(model string) Option {
 	}
 }
 
+// WithStallWatchdog reports a *StallError when a turn produces no CLI output
+// for the given timeout, then applies the action. Tool progress messages and
+// stream events count as output, so long-running tools that report progress
+// are not treated as stalls.
+func WithStallWatchdog(timeout time.Duration, action StallAction) Option {
+	return func(o *Options) {
+		o.StallTimeout = timeout
+		o.StallAction = action
+	}
+}
+
+// WithCallbackTimeout bounds every permission and hook callback. A callback
+// still running at the deadline is abandoned and the CLI receives an error
+// response; its context is canceled. Hook matcher timeouts apply within it.
+func WithCallbackTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.CallbackTimeout = d
+	}
+}
+
+// WithOnStall registers a callback invoked for every stall, e.g. for alerting.
+func WithOnStall(fn func(StallEvent)) Option {
+	return func(o *Options) {
+		o.OnStall = fn
+	}
+}
+
 func applyOptions(opts []Option) *Options {
 	options := &Options{}
 	for _, opt := range opts {
@@ -423,3 +482,19 @@ func applyOptions(opts []Option) *Options {
 	}
 	return options
 }
+
+// validateOptions reports option errors before any process is started.
+func validateOptions(options *Options) error {
+	if len(options.optionErrors) > 0 {
+		return errors.Join(options.optionErrors...)
+	}
+	if _, err := envModeToTransport(options.EnvMode); err != nil {
+		return err
+	}
+	if options.Landlock != nil {
+		if err := sandbox.Check(*options.Landlock); err != nil {
+			return err
+		}
+	}
+	return validateCredentials(options.Credentials)
+}
@@ -0,0 +1,102 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"claudeagent/internal/udiff"
+	"claudeagent/tools"
+)
+
+// editNotebook applies a NotebookEdit call to the notebook's JSON. The
+// result is written the way Jupyter writes notebooks, with one-space
+// indentation and sorted keys.
+func editNotebook(src string, in *tools.NotebookEditInput) (string, error) {
+	dec := json.NewDecoder(strings.NewReader(src))
+	dec.UseNumber()
+	var nb map[string]any
+	if err := dec.Decode(&nb); err != nil {
+		return "", fmt.Errorf("parse notebook: %w", err)
+	}
+	cells, _ := nb["cells"].([]any)
+
+	idx := -1
+	if in.CellID != "" {
+		if idx = findCell(cells, in.CellID); idx < 0 {
+			return "", fmt.Errorf("cell %q not found", in.CellID)
+		}
+	}
+
+	switch in.EditMode {
+	case "", "replace":
+		if idx < 0 {
+			return "", fmt.Errorf("replace needs a cell_id")
+		}
+		cell, ok := cells[idx].(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("cell %q is not an object", in.CellID)
+		}
+		if in.CellType != "" {
+			cell["cell_type"] = in.CellType
+		}
+		setSource(cell, in.NewSource)
+	case "insert":
+		cellType := in.CellType
+		if cellType == "" {
+			cellType = "code"
+		}
+		cell := map[string]any{"cell_type": cellType, "metadata": map[string]any{}}
+		setSource(cell, in.NewSource)
+		cells = append(cells[:idx+1], append([]any{cell}, cells[idx+1:]...)...)
+	case "delete":
+		if idx < 0 {
+			return "", fmt.Errorf("delete needs a cell_id")
+		}
+		cells = append(cells[:idx], cells[idx+1:]...)
+	default:
+		return "", fmt.Errorf("unknown edit mode %q", in.EditMode)
+	}
+	nb["cells"] = cells
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", " ")
+	if err := enc.Encode(nb); err != nil {
+		return "", fmt.Errorf("write notebook: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// findCell finds a cell by its ID, or by a "cell-N" index for notebooks
+// without cell IDs.
+func findCell(cells []any, id string) int {
+	for i, c := range cells {
+		if cell, ok := c.(map[string]any); ok && cell["id"] == id {
+			return i
+		}
+	}
+	if n, err := strconv.Atoi(strings.TrimPrefix(id, "cell-")); err == nil && strings.HasPrefix(id, "cell-") && n >= 0 && n < len(cells) {
+		return n
+	}
+	return -1
+}
+
+// setSource replaces a cell's source, clearing the outputs of code cells.
+func setSource(cell map[string]any, source string) {
+	lines := make([]any, 0)
+	for _, line := range udiff.SplitLines(source) {
+		lines = append(lines, line)
+	}
+	cell["source"] = lines
+	if cell["cell_type"] == "code" {
+		cell["execution_count"] = nil
+		cell["outputs"] = []any{}
+	} else {
+		delete(cell, "execution_count")
+		delete(cell, "outputs")
+	}
+}
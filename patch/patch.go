@@ -0,0 +1,357 @@
+// Package patch rebuilds the file changes an agent made as unified diffs.
+//
+// A Recorder follows the Write, Edit, MultiEdit and NotebookEdit calls of a
+// session, live or from a transcript, and keeps each file's contents before
+// the first change and after the last one:
+//
+//	rec := patch.NewRecorder(patch.WithBaseDir(cwd))
+//	for msg := range client.Messages(ctx) {
+//	    rec.Observe(msg)
+//	}
+//	fmt.Print(rec.Patch())
+//
+// The starting contents come from the structured results the CLI attaches
+// to successful calls. Calls whose results lack them, such as NotebookEdit,
+// need WithReadFile.
+package patch
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"claudeagent/internal/udiff"
+	"claudeagent/message"
+	"claudeagent/tools"
+)
+
+// ErrUnknownOriginal is reported for files whose contents before the first
+// change are not known.
+var ErrUnknownOriginal = errors.New("original file contents unknown")
+
+// File is the net change to one file.
+type File struct {
+	Path string
+	// Name is the path used in the diff, relative to the base directory when
+	// the file is inside it.
+	Name     string
+	Original string
+	Current  string
+	// Created reports a file that did not exist before the first change.
+	Created bool
+	// ToolUseIDs are the calls that changed the file, in order.
+	ToolUseIDs []string
+	// Err reports why the change could not be rebuilt. Such files are left
+	// out of Patch.
+	Err error
+}
+
+// Hunks returns the file's change as structured patch hunks, in the form the
+// CLI uses in tool results.
+func (f File) Hunks() []tools.PatchHunk {
+	if f.Err != nil {
+		return nil
+	}
+	diff := udiff.Diff(f.Original, f.Current, udiff.DefaultContext)
+	hunks := make([]tools.PatchHunk, len(diff))
+	for i, h := range diff {
+		hunks[i] = tools.PatchHunk{
+			OldStart: h.OldStart,
+			OldLines: h.OldLines,
+			NewStart: h.NewStart,
+			NewLines: h.NewLines,
+			Lines:    h.Lines,
+		}
+	}
+	return hunks
+}
+
+// Diff returns the file's change as a unified diff, or "" if the file is
+// unchanged or could not be rebuilt.
+func (f File) Diff() string {
+	if f.Err != nil {
+		return ""
+	}
+	name := strings.TrimPrefix(f.Name, "/")
+	oldName := "a/" + name
+	if f.Created {
+		oldName = "/dev/null"
+	}
+	return udiff.Unified(oldName, "b/"+name, f.Original, f.Current)
+}
+
+// Option configures a Recorder.
+type Option func(*Recorder)
+
+// WithBaseDir names files in diffs relative to dir, usually the session's
+// working directory.
+func WithBaseDir(dir string) Option {
+	return func(r *Recorder) {
+		r.baseDir = dir
+	}
+}
+
+// WithReadFile reads the starting contents of files whose first change has
+// no structured result with them, e.g. os.ReadFile. Files are read when the
+// call is observed, so on a live stream this only works if messages are
+// observed before the CLI runs the tool.
+func WithReadFile(fn func(path string) ([]byte, error)) Option {
+	return func(r *Recorder) {
+		r.readFile = fn
+	}
+}
+
+// snapshot is a file's contents read before its first change.
+type snapshot struct {
+	text   string
+	exists bool
+}
+
+// Recorder rebuilds file changes from the tool calls of a session.
+type Recorder struct {
+	baseDir  string
+	readFile func(string) ([]byte, error)
+
+	mu        sync.Mutex
+	calls     *tools.Correlator
+	snapshots map[string]snapshot
+	files     map[string]*File
+	order     []string
+}
+
+// NewRecorder creates a Recorder with no changes.
+func NewRecorder(opts ...Option) *Recorder {
+	r := &Recorder{
+		calls:     tools.NewCorrelator(),
+		snapshots: make(map[string]snapshot),
+		files:     make(map[string]*File),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// FromMessages records the changes of a finished session, such as one
+// loaded with session.Load.
+func FromMessages(msgs []message.Message, opts ...Option) *Recorder {
+	r := NewRecorder(opts...)
+	for _, msg := range msgs {
+		r.Observe(msg)
+	}
+	return r
+}
+
+// Observe records the changes made by the successful calls completed by a
+// message. Pass every message of the session.
+func (r *Recorder) Observe(msg message.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if assistant, ok := msg.(*message.AssistantMessage); ok && r.readFile != nil {
+		r.snapshot(assistant)
+	}
+	for _, call := range r.calls.Observe(msg) {
+		if !call.IsError() {
+			r.apply(call)
+		}
+	}
+}
+
+func (r *Recorder) snapshot(msg *message.AssistantMessage) {
+	for _, block := range msg.Message.Content {
+		use, ok := block.(*message.ToolUseBlock)
+		if !ok {
+			continue
+		}
+		in, err := tools.DecodeToolUse(use)
+		if err != nil {
+			continue
+		}
+		path := filePath(in)
+		if path == "" || r.files[path] != nil {
+			continue
+		}
+		if _, ok := r.snapshots[path]; ok {
+			continue
+		}
+		data, err := r.readFile(path)
+		switch {
+		case err == nil:
+			r.snapshots[path] = snapshot{text: string(data), exists: true}
+		case errors.Is(err, fs.ErrNotExist):
+			r.snapshots[path] = snapshot{}
+		}
+	}
+}
+
+func filePath(in tools.Input) string {
+	switch in := in.(type) {
+	case *tools.WriteInput:
+		return in.FilePath
+	case *tools.EditInput:
+		return in.FilePath
+	case *tools.MultiEditInput:
+		return in.FilePath
+	case *tools.NotebookEditInput:
+		return in.NotebookPath
+	default:
+		return ""
+	}
+}
+
+func (r *Recorder) apply(call tools.Call) {
+	id := call.Use.ID
+	switch in := call.Input.(type) {
+	case *tools.WriteInput:
+		var original *string
+		created := false
+		if res, ok := call.Result.(*tools.WriteResult); ok {
+			if res.Type == "create" {
+				original, created = new(string), true
+			} else {
+				original = res.OriginalFile
+			}
+		}
+		r.change(in.FilePath, id, original, created, func(string) (string, error) {
+			return in.Content, nil
+		})
+
+	case *tools.EditInput:
+		var original *string
+		if res, ok := call.Result.(*tools.EditResult); ok {
+			original = &res.OriginalFile
+		}
+		r.change(in.FilePath, id, original, false, func(pre string) (string, error) {
+			return replace(pre, tools.EditOperation{OldString: in.OldString, NewString: in.NewString, ReplaceAll: in.ReplaceAll})
+		})
+
+	case *tools.MultiEditInput:
+		var original *string
+		if res, ok := call.Result.(*tools.MultiEditResult); ok {
+			original = &res.OriginalFileContents
+		}
+		r.change(in.FilePath, id, original, false, func(pre string) (string, error) {
+			var err error
+			for i, e := range in.Edits {
+				if pre, err = replace(pre, e); err != nil {
+					return "", fmt.Errorf("edit %d: %w", i+1, err)
+				}
+			}
+			return pre, nil
+		})
+
+	case *tools.NotebookEditInput:
+		r.change(in.NotebookPath, id, nil, false, func(pre string) (string, error) {
+			return editNotebook(pre, in)
+		})
+	}
+}
+
+// change applies one call to a file. original is the file's contents before
+// the call according to its result, if known.
+func (r *Recorder) change(path, id string, original *string, created bool, edit func(pre string) (string, error)) {
+	f := r.files[path]
+	if f == nil {
+		f = &File{Path: path, Name: r.name(path)}
+		r.files[path] = f
+		r.order = append(r.order, path)
+	}
+	if f.Err != nil {
+		return
+	}
+
+	pre := f.Current
+	if len(f.ToolUseIDs) == 0 {
+		snap, ok := r.snapshots[path]
+		switch {
+		case original != nil:
+			f.Original, f.Created = *original, created
+		case ok:
+			f.Original, f.Created = snap.text, !snap.exists
+		default:
+			f.Err = fmt.Errorf("%w: %s", ErrUnknownOriginal, path)
+			return
+		}
+		pre = f.Original
+	} else if original != nil {
+		// Picks up changes made outside the recorded calls.
+		pre = *original
+	}
+
+	next, err := edit(pre)
+	if err != nil {
+		f.Err = fmt.Errorf("%s: %w", id, err)
+		return
+	}
+	f.Current = next
+	f.ToolUseIDs = append(f.ToolUseIDs, id)
+}
+
+func (r *Recorder) name(path string) string {
+	if r.baseDir != "" {
+		if rel, err := filepath.Rel(r.baseDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(path)
+}
+
+// replace applies one edit the way the Edit tool does.
+func replace(s string, e tools.EditOperation) (string, error) {
+	if e.OldString == "" {
+		if s != "" {
+			return "", errors.New("empty old_string for a non-empty file")
+		}
+		return e.NewString, nil
+	}
+	if !strings.Contains(s, e.OldString) {
+		return "", errors.New("old_string not found")
+	}
+	if e.ReplaceAll {
+		return strings.ReplaceAll(s, e.OldString, e.NewString), nil
+	}
+	return strings.Replace(s, e.OldString, e.NewString, 1), nil
+}
+
+// Files returns a copy of every changed file, in the order of their first
+// change.
+func (r *Recorder) Files() []File {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	files := make([]File, len(r.order))
+	for i, path := range r.order {
+		files[i] = r.files[path].clone()
+	}
+	return files
+}
+
+// File returns a copy of the change to the file at path.
+func (r *Recorder) File(path string) (File, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.files[path]
+	if !ok {
+		return File{}, false
+	}
+	return f.clone(), true
+}
+
+func (f *File) clone() File {
+	c := *f
+	c.ToolUseIDs = append([]string(nil), f.ToolUseIDs...)
+	return c
+}
+
+// Patch returns the combined unified diff of every file that could be
+// rebuilt, in the order of their first change.
+func (r *Recorder) Patch() string {
+	var b strings.Builder
+	for _, f := range r.Files() {
+		b.WriteString(f.Diff())
+	}
+	return b.String()
+}
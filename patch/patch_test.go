@@ -0,0 +1,216 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"strconv"
+	"strings"
+	"testing"
+
+	"claudeagent/message"
+	"claudeagent/tools"
+)
+
+func mustParse(t *testing.T, data string) message.Message {
+	t.Helper()
+	msg, err := message.ParseMessage([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// call returns the messages of one tool call and its result.
+func call(t *testing.T, id, tool string, input, result any, isError bool) []message.Message {
+	t.Helper()
+	in, _ := json.Marshal(input)
+	res, _ := json.Marshal(result)
+	return []message.Message{
+		mustParse(t, `{"type":"assistant","message":{"content":[{"type":"tool_use","id":"`+id+`","name":"`+tool+`","input":`+string(in)+`}]}}`),
+		mustParse(t, `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"`+id+`","content":"ok","is_error":`+strconv.FormatBool(isError)+`}]},"tool_use_result":`+string(res)+`}`),
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	var msgs []message.Message
+	msgs = append(msgs, call(t, "w1", "Write",
+		map[string]any{"file_path": "/repo/new.go", "content": "package x\n"},
+		map[string]any{"type": "create", "filePath": "/repo/new.go", "content": "package x\n"}, false)...)
+	msgs = append(msgs, call(t, "e1", "Edit",
+		map[string]any{"file_path": "/repo/main.go", "old_string": "foo", "new_string": "bar", "replace_all": true},
+		map[string]any{"filePath": "/repo/main.go", "originalFile": "a\nfoo\nfoo\n"}, false)...)
+	// A failed edit changes nothing.
+	msgs = append(msgs, call(t, "e2", "Edit",
+		map[string]any{"file_path": "/repo/main.go", "old_string": "bar", "new_string": "nope"},
+		"Error: String to replace not found", true)...)
+	msgs = append(msgs, call(t, "m1", "MultiEdit",
+		map[string]any{"file_path": "/repo/main.go", "edits": []any{
+			map[string]any{"old_string": "a\n", "new_string": "A\n"},
+			map[string]any{"old_string": "bar\nbar", "new_string": "baz"},
+		}},
+		map[string]any{"filePath": "/repo/main.go", "originalFileContents": "a\nbar\nbar\n"}, false)...)
+
+	rec := FromMessages(msgs, WithBaseDir("/repo"))
+
+	files := rec.Files()
+	if len(files) != 2 || files[0].Path != "/repo/new.go" || files[1].Name != "main.go" {
+		t.Fatalf("unexpected files: %+v", files)
+	}
+	main := files[1]
+	if main.Original != "a\nfoo\nfoo\n" || main.Current != "A\nbaz\n" || strings.Join(main.ToolUseIDs, ",") != "e1,m1" {
+		t.Errorf("unexpected main.go: %+v", main)
+	}
+
+	want := `--- /dev/null
++++ b/new.go
+@@ -0,0 +1 @@
++package x
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,2 @@
+-a
+-foo
+-foo
++A
++baz
+`
+	if got := rec.Patch(); got != want {
+		t.Errorf("Patch() =\n%s\nwant\n%s", got, want)
+	}
+
+	hunks := main.Hunks()
+	if len(hunks) != 1 || hunks[0].OldLines != 3 || hunks[0].NewLines != 2 {
+		t.Errorf("unexpected hunks: %+v", hunks)
+	}
+}
+
+func TestRecorder_UnknownOriginal(t *testing.T) {
+	msgs := call(t, "e1", "Edit",
+		map[string]any{"file_path": "/a.go", "old_string": "x", "new_string": "y"}, nil, false)
+	rec := FromMessages(msgs)
+
+	f, ok := rec.File("/a.go")
+	if !ok || !errors.Is(f.Err, ErrUnknownOriginal) {
+		t.Errorf("expected ErrUnknownOriginal, got %+v", f)
+	}
+	if rec.Patch() != "" {
+		t.Errorf("expected an empty patch, got %q", rec.Patch())
+	}
+}
+
+func TestRecorder_ReadFile(t *testing.T) {
+	disk := map[string]string{
+		"/nb.ipynb": `{
+ "cells": [
+  {
+   "cell_type": "code",
+   "execution_count": 1,
+   "id": "c1",
+   "metadata": {},
+   "outputs": [],
+   "source": [
+    "print(1)"
+   ]
+  }
+ ],
+ "metadata": {},
+ "nbformat": 4,
+ "nbformat_minor": 5
+}
+`,
+	}
+	readFile := func(path string) ([]byte, error) {
+		if s, ok := disk[path]; ok {
+			return []byte(s), nil
+		}
+		return nil, fs.ErrNotExist
+	}
+
+	var msgs []message.Message
+	msgs = append(msgs, call(t, "n1", "NotebookEdit",
+		map[string]any{"notebook_path": "/nb.ipynb", "cell_id": "c1", "new_source": "print(2)"},
+		map[string]any{"new_source": "print(2)", "cell_id": "c1"}, false)...)
+	// Without a structured result, a missing file counts as created.
+	msgs = append(msgs, call(t, "w1", "Write",
+		map[string]any{"file_path": "/new.txt", "content": "hi\n"}, nil, false)...)
+	rec := FromMessages(msgs, WithReadFile(readFile))
+
+	nb, _ := rec.File("/nb.ipynb")
+	if nb.Err != nil {
+		t.Fatal(nb.Err)
+	}
+	want := `--- a/nb.ipynb
++++ b/nb.ipynb
+@@ -2,12 +2,12 @@
+  "cells": [
+   {
+    "cell_type": "code",
+-   "execution_count": 1,
++   "execution_count": null,
+    "id": "c1",
+    "metadata": {},
+    "outputs": [],
+    "source": [
+-    "print(1)"
++    "print(2)"
+    ]
+   }
+  ],
+`
+	if got := nb.Diff(); got != want {
+		t.Errorf("notebook diff =\n%s\nwant\n%s", got, want)
+	}
+
+	created, _ := rec.File("/new.txt")
+	if !created.Created || created.Err != nil || created.Current != "hi\n" {
+		t.Errorf("unexpected created file: %+v", created)
+	}
+}
+
+func TestEditNotebook_InsertDelete(t *testing.T) {
+	src := `{"cells":[{"cell_type":"markdown","metadata":{},"source":["# T"]}],"metadata":{},"nbformat":4,"nbformat_minor":5}`
+
+	out, err := editNotebook(src, &tools.NotebookEditInput{CellID: "cell-0", EditMode: "insert", NewSource: "a = 1\nb = 2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nb struct {
+		Cells []map[string]any `json:"cells"`
+	}
+	if err := json.Unmarshal([]byte(out), &nb); err != nil {
+		t.Fatal(err)
+	}
+	if len(nb.Cells) != 2 || nb.Cells[1]["cell_type"] != "code" {
+		t.Fatalf("unexpected cells after insert: %+v", nb.Cells)
+	}
+	if src := nb.Cells[1]["source"].([]any); len(src) != 2 || src[0] != "a = 1\n" {
+		t.Errorf("unexpected source: %v", src)
+	}
+
+	out, err = editNotebook(out, &tools.NotebookEditInput{CellID: "cell-0", EditMode: "delete"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(out), &nb); err != nil {
+		t.Fatal(err)
+	}
+	if len(nb.Cells) != 1 || nb.Cells[0]["cell_type"] != "code" {
+		t.Errorf("unexpected cells after delete: %+v", nb.Cells)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	if _, err := replace("abc", tools.EditOperation{OldString: "x", NewString: "y"}); err == nil {
+		t.Error("expected an error for a missing old_string")
+	}
+	if got, _ := replace("aXaXa", tools.EditOperation{OldString: "X", NewString: "-"}); got != "a-aXa" {
+		t.Errorf("replace first = %q", got)
+	}
+	if got, _ := replace("aXaXa", tools.EditOperation{OldString: "X", NewString: "-", ReplaceAll: true}); got != "a-a-a" {
+		t.Errorf("replace all = %q", got)
+	}
+	if got, _ := replace("", tools.EditOperation{NewString: "new"}); got != "new" {
+		t.Errorf("replace in empty file = %q", got)
+	}
+}
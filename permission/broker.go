@@ -0,0 +1,287 @@
+package permission
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"claudeagent/control"
+)
+
+// ErrUnknownApproval is returned by Submit for an ID that is not pending,
+// because it was already decided, timed out or never existed.
+var ErrUnknownApproval = errors.New("no pending approval with this ID")
+
+const (
+	defaultApprovalBuffer = 16
+	sessionDestination    = "session"
+)
+
+// ApprovalRequest is a tool call waiting for a human decision.
+type ApprovalRequest struct {
+	// ID identifies the request in Submit. It is the tool use ID when the CLI
+	// provides one.
+	ID             string
+	ToolName       string
+	Input          map[string]any
+	Suggestions    []control.PermissionUpdate
+	ToolUseID      string
+	AgentID        *string
+	BlockedPath    *string
+	DecisionReason *string
+	Created        time.Time
+	// Deadline is when the default decision applies; zero without a timeout.
+	Deadline time.Time
+}
+
+// ApprovalDecision answers an ApprovalRequest.
+type ApprovalDecision struct {
+	Behavior control.PermissionBehavior
+	// Message tells the model why a call was denied.
+	Message string
+	// UpdatedInput replaces the tool input of an allowed call. The original
+	// input is used when nil.
+	UpdatedInput map[string]any
+	// AlwaysAllow allows matching calls for the rest of the session, using
+	// the CLI's permission suggestions. When the CLI sent none, only this
+	// call is allowed.
+	AlwaysAllow bool
+	// Interrupt stops the current turn along with a denial.
+	Interrupt bool
+}
+
+// BrokerOption configures an ApprovalBroker.
+type BrokerOption func(*ApprovalBroker)
+
+// WithApprovalTimeout applies decision to requests not decided within d.
+func WithApprovalTimeout(d time.Duration, decision ApprovalDecision) BrokerOption {
+	return func(b *ApprovalBroker) {
+		b.timeout = d
+		b.timeoutDecision = decision
+	}
+}
+
+// WithApprovalHandler publishes requests to fn instead of the Requests
+// channel. fn is called on the CLI's control goroutine and must not block;
+// hand the request off to a UI and call Submit later.
+func WithApprovalHandler(fn func(ApprovalRequest)) BrokerOption {
+	return func(b *ApprovalBroker) {
+		b.handler = fn
+	}
+}
+
+// WithApprovalBuffer sets the capacity of the Requests channel.
+func WithApprovalBuffer(n int) BrokerOption {
+	return func(b *ApprovalBroker) {
+		b.buffer = n
+	}
+}
+
+// ApprovalBroker bridges the synchronous permission callback to approval
+// UIs running elsewhere. Its CanUseTool method publishes each call as an
+// ApprovalRequest and blocks until Submit is called with the request ID, the
+// timeout expires or the context is canceled.
+//
+// It can be used directly with WithCanUseTool, or as the ask handler of a
+// policy so that only calls the policy cannot decide reach a human.
+type ApprovalBroker struct {
+	timeout         time.Duration
+	timeoutDecision ApprovalDecision
+	handler         func(ApprovalRequest)
+	buffer          int
+
+	requests chan ApprovalRequest
+
+	mu      sync.Mutex
+	pending map[string]*pendingApproval
+}
+
+type pendingApproval struct {
+	req      ApprovalRequest
+	decision chan ApprovalDecision
+}
+
+// NewApprovalBroker creates a broker. Without a timeout, requests wait until
+// decided or their context is canceled.
+func NewApprovalBroker(opts ...BrokerOption) *ApprovalBroker {
+	b := &ApprovalBroker{
+		buffer:          defaultApprovalBuffer,
+		timeoutDecision: ApprovalDecision{Behavior: control.PermissionDeny, Message: "approval timed out"},
+		pending:         make(map[string]*pendingApproval),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.handler == nil {
+		b.requests = make(chan ApprovalRequest, b.buffer)
+	}
+	return b
+}
+
+// Requests delivers pending approvals when no handler is set. It is nil
+// when WithApprovalHandler is used.
+func (b *ApprovalBroker) Requests() <-chan ApprovalRequest {
+	return b.requests
+}
+
+// Pending returns the requests awaiting a decision, oldest first.
+func (b *ApprovalBroker) Pending() []ApprovalRequest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	reqs := make([]ApprovalRequest, 0, len(b.pending))
+	for _, p := range b.pending {
+		reqs = append(reqs, p.req)
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].Created.Before(reqs[j].Created) })
+	return reqs
+}
+
+// Submit decides a pending request.
+func (b *ApprovalBroker) Submit(id string, d ApprovalDecision) error {
+	switch d.Behavior {
+	case control.PermissionAllow, control.PermissionDeny:
+	default:
+		return fmt.Errorf("invalid approval behavior %q", d.Behavior)
+	}
+
+	b.mu.Lock()
+	p, ok := b.pending[id]
+	if ok {
+		delete(b.pending, id)
+	}
+	b.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownApproval, id)
+	}
+	p.decision <- d
+	return nil
+}
+
+// CanUseTool implements control.CanUseToolFunc.
+func (b *ApprovalBroker) CanUseTool(ctx context.Context, toolName string, input map[string]any, opts control.CanUseToolOptions) (control.PermissionResult, error) {
+	req := ApprovalRequest{
+		ID:             opts.ToolUseID,
+		ToolName:       toolName,
+		Input:          input,
+		Suggestions:    opts.Suggestions,
+		ToolUseID:      opts.ToolUseID,
+		AgentID:        opts.AgentID,
+		BlockedPath:    opts.BlockedPath,
+		DecisionReason: opts.DecisionReason,
+		Created:        time.Now(),
+	}
+	if req.ID == "" {
+		req.ID = newApprovalID()
+	}
+
+	var timeout <-chan time.Time
+	if b.timeout > 0 {
+		req.Deadline = req.Created.Add(b.timeout)
+		timer := time.NewTimer(b.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	p := &pendingApproval{req: req, decision: make(chan ApprovalDecision, 1)}
+	b.mu.Lock()
+	if _, dup := b.pending[req.ID]; dup {
+		b.mu.Unlock()
+		return control.PermissionResult{}, fmt.Errorf("approval %s is already pending", req.ID)
+	}
+	b.pending[req.ID] = p
+	b.mu.Unlock()
+
+	if err := b.publish(ctx, req, timeout); err != nil {
+		b.remove(req.ID)
+		if errors.Is(err, errApprovalTimeout) {
+			return b.result(req, b.timeoutDecision), nil
+		}
+		return control.PermissionResult{}, err
+	}
+
+	select {
+	case d := <-p.decision:
+		return b.result(req, d), nil
+	case <-timeout:
+		if b.remove(req.ID) {
+			return b.result(req, b.timeoutDecision), nil
+		}
+		// Submit won the race.
+		return b.result(req, <-p.decision), nil
+	case <-ctx.Done():
+		b.remove(req.ID)
+		return control.PermissionResult{}, ctx.Err()
+	}
+}
+
+var errApprovalTimeout = errors.New("approval timed out")
+
+func (b *ApprovalBroker) publish(ctx context.Context, req ApprovalRequest, timeout <-chan time.Time) error {
+	if b.handler != nil {
+		b.handler(req)
+		return nil
+	}
+	select {
+	case b.requests <- req:
+		return nil
+	case <-timeout:
+		return errApprovalTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// remove reports whether the request was still pending.
+func (b *ApprovalBroker) remove(id string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.pending[id]
+	delete(b.pending, id)
+	return ok
+}
+
+func (b *ApprovalBroker) result(req ApprovalRequest, d ApprovalDecision) control.PermissionResult {
+	if d.Behavior != control.PermissionAllow {
+		msg := d.Message
+		if msg == "" {
+			msg = "denied by user"
+		}
+		return control.PermissionResult{Behavior: control.PermissionDeny, Message: msg, Interrupt: d.Interrupt}
+	}
+
+	res := control.PermissionResult{Behavior: control.PermissionAllow, UpdatedInput: d.UpdatedInput}
+	if res.UpdatedInput == nil {
+		res.UpdatedInput = req.Input
+	}
+	if d.AlwaysAllow {
+		res.UpdatedPermissions = sessionPermissions(req)
+	}
+	return res
+}
+
+// sessionPermissions turns the CLI's suggestions into session-scoped
+// updates. Without suggestions there is nothing narrower than the whole tool
+// to allow, so it returns none.
+func sessionPermissions(req ApprovalRequest) []control.PermissionUpdate {
+	if len(req.Suggestions) == 0 {
+		return nil
+	}
+	updates := make([]control.PermissionUpdate, len(req.Suggestions))
+	for i, s := range req.Suggestions {
+		s.Destination = sessionDestination
+		updates[i] = s
+	}
+	return updates
+}
+
+func newApprovalID() string {
+	var buf [8]byte
+	_, _ = rand.Read(buf[:])
+	return "approval_" + hex.EncodeToString(buf[:])
+}
@@ -0,0 +1,114 @@
+package permission
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"claudeagent/control"
+)
+
+func TestApprovalBroker_Submit(t *testing.T) {
+	b := NewApprovalBroker()
+	input := map[string]any{"command": "make"}
+
+	done := make(chan control.PermissionResult, 1)
+	go func() {
+		res, err := b.CanUseTool(context.Background(), "Bash", input, control.CanUseToolOptions{ToolUseID: "tool_1"})
+		if err != nil {
+			t.Errorf("CanUseTool failed: %v", err)
+		}
+		done <- res
+	}()
+
+	req := <-b.Requests()
+	if req.ID != "tool_1" || req.ToolName != "Bash" || req.Input["command"] != "make" {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+	if len(b.Pending()) != 1 {
+		t.Errorf("expected 1 pending request, got %d", len(b.Pending()))
+	}
+	if err := b.Submit(req.ID, ApprovalDecision{Behavior: control.PermissionAllow}); err != nil {
+		t.Fatal(err)
+	}
+
+	res := <-done
+	if res.Behavior != control.PermissionAllow || res.UpdatedInput["command"] != "make" {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if err := b.Submit(req.ID, ApprovalDecision{Behavior: control.PermissionDeny}); !errors.Is(err, ErrUnknownApproval) {
+		t.Errorf("second Submit: expected ErrUnknownApproval, got %v", err)
+	}
+}
+
+func TestApprovalBroker_Timeout(t *testing.T) {
+	b := NewApprovalBroker(
+		WithApprovalHandler(func(ApprovalRequest) {}),
+		WithApprovalTimeout(20*time.Millisecond, ApprovalDecision{Behavior: control.PermissionDeny, Message: "nobody answered"}),
+	)
+	res, err := b.CanUseTool(context.Background(), "Write", nil, control.CanUseToolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Behavior != control.PermissionDeny || res.Message != "nobody answered" {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if len(b.Pending()) != 0 {
+		t.Error("timed out request still pending")
+	}
+}
+
+func TestApprovalBroker_AlwaysAllow(t *testing.T) {
+	suggestion := control.PermissionUpdate{
+		Type:        "addRules",
+		Rules:       []control.PermissionRule{{ToolName: "Bash", RuleContent: "npm test:*"}},
+		Behavior:    control.PermissionAllow,
+		Destination: "localSettings",
+	}
+
+	var b *ApprovalBroker
+	b = NewApprovalBroker(WithApprovalHandler(func(req ApprovalRequest) {
+		_ = b.Submit(req.ID, ApprovalDecision{Behavior: control.PermissionAllow, AlwaysAllow: true})
+	}))
+
+	res, err := b.CanUseTool(context.Background(), "Bash", nil, control.CanUseToolOptions{Suggestions: []control.PermissionUpdate{suggestion}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.UpdatedPermissions) != 1 || res.UpdatedPermissions[0].Destination != "session" {
+		t.Fatalf("expected session-scoped suggestion, got %+v", res.UpdatedPermissions)
+	}
+	if res.UpdatedPermissions[0].Rules[0].RuleContent != "npm test:*" {
+		t.Errorf("suggestion rules not kept: %+v", res.UpdatedPermissions[0])
+	}
+
+	// Without suggestions only this call is allowed, not all of Bash.
+	res, _ = b.CanUseTool(context.Background(), "Bash", map[string]any{"command": "rm -rf build"}, control.CanUseToolOptions{})
+	if res.Behavior != control.PermissionAllow || len(res.UpdatedPermissions) != 0 {
+		t.Errorf("expected a one-off allow without permission updates, got %+v", res)
+	}
+}
+
+func TestApprovalBroker_ContextCanceled(t *testing.T) {
+	b := NewApprovalBroker(WithApprovalHandler(func(ApprovalRequest) {}))
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	if _, err := b.CanUseTool(ctx, "Bash", nil, control.CanUseToolOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if len(b.Pending()) != 0 {
+		t.Error("canceled request still pending")
+	}
+}
+
+func TestApprovalBroker_InvalidDecision(t *testing.T) {
+	b := NewApprovalBroker()
+	if err := b.Submit("x", ApprovalDecision{Behavior: control.PermissionAsk}); err == nil {
+		t.Error("expected error for ask decision")
+	}
+}
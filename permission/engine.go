@@ -0,0 +1,287 @@
+package permission
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"claudeagent/control"
+)
+
+// Decision is the outcome of evaluating a tool call against a policy.
+type Decision struct {
+	Behavior control.PermissionBehavior
+	// Rule is the index of the deciding rule, or -1 for the policy default.
+	Rule     int
+	RuleName string
+	// Message is the deny message of the deciding rule.
+	Message string
+	// Explanation describes which rule decided the call and why.
+	Explanation string
+}
+
+// Option configures a compiled policy.
+type Option func(*Engine)
+
+// WithBaseDir resolves relative path globs and relative tool input paths
+// against dir, usually the CLI working directory.
+func WithBaseDir(dir string) Option {
+	return func(e *Engine) {
+		e.baseDir = dir
+	}
+}
+
+// WithAskHandler sets the callback that decides calls a rule marks as ask.
+// Without one, such calls are denied, since the CLI cannot prompt a user on
+// behalf of the SDK.
+func WithAskHandler(fn control.CanUseToolFunc) Option {
+	return func(e *Engine) {
+		e.ask = fn
+	}
+}
+
+// WithDecisionHook is called with every decision, e.g. for audit logging.
+func WithDecisionHook(fn func(toolName string, d Decision)) Option {
+	return func(e *Engine) {
+		e.onDecision = fn
+	}
+}
+
+// Engine is a compiled policy.
+type Engine struct {
+	rules      []Rule
+	def        control.PermissionBehavior
+	baseDir    string
+	ask        control.CanUseToolFunc
+	onDecision func(string, Decision)
+}
+
+// Compile validates the policy and prepares it for evaluation.
+func (p *Policy) Compile(opts ...Option) (*Engine, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	e := &Engine{def: p.Default}
+	if e.def == "" {
+		e.def = control.PermissionAsk
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	e.rules = make([]Rule, len(p.Rules))
+	for i, r := range p.Rules {
+		r.Paths = e.absGlobs(r.Paths)
+		e.rules[i] = r
+	}
+	return e, nil
+}
+
+func (e *Engine) absGlobs(globs []string) []string {
+	if len(globs) == 0 {
+		return nil
+	}
+	out := make([]string, len(globs))
+	for i, g := range globs {
+		if e.baseDir != "" && !filepath.IsAbs(g) && !strings.HasPrefix(g, "**") {
+			g = filepath.Join(e.baseDir, g)
+		}
+		out[i] = filepath.ToSlash(g)
+	}
+	return out
+}
+
+// Evaluate decides a tool call without invoking the ask handler.
+func (e *Engine) Evaluate(toolName string, input map[string]any, opts control.CanUseToolOptions) Decision {
+	call := e.newCall(toolName, input, opts)
+	for i, r := range e.rules {
+		if reason, ok := call.match(r); ok {
+			return Decision{
+				Behavior:    r.Behavior,
+				Rule:        i,
+				RuleName:    r.Name,
+				Message:     denyMessage(i, r),
+				Explanation: fmt.Sprintf("rule %s: %s %s (%s)", ruleLabel(i, r.Name), r.Behavior, toolName, reason),
+			}
+		}
+	}
+	return Decision{
+		Behavior:    e.def,
+		Rule:        -1,
+		Message:     "denied by permission policy default",
+		Explanation: fmt.Sprintf("no rule matched %s; default %s", toolName, e.def),
+	}
+}
+
+func denyMessage(index int, r Rule) string {
+	if r.Message != "" {
+		return r.Message
+	}
+	return fmt.Sprintf("denied by permission policy rule %s", ruleLabel(index, r.Name))
+}
+
+// CanUseTool returns the policy as a permission callback.
+func (e *Engine) CanUseTool() control.CanUseToolFunc {
+	return func(ctx context.Context, toolName string, input map[string]any, opts control.CanUseToolOptions) (control.PermissionResult, error) {
+		d := e.Evaluate(toolName, input, opts)
+		if e.onDecision != nil {
+			e.onDecision(toolName, d)
+		}
+
+		switch d.Behavior {
+		case control.PermissionAllow:
+			return control.PermissionResult{Behavior: control.PermissionAllow, UpdatedInput: input}, nil
+		case control.PermissionAsk:
+			if e.ask != nil {
+				return e.ask(ctx, toolName, input, opts)
+			}
+			return control.PermissionResult{
+				Behavior: control.PermissionDeny,
+				Message:  fmt.Sprintf("%s requires approval and no approver is configured", toolName),
+			}, nil
+		default:
+			return control.PermissionResult{Behavior: control.PermissionDeny, Message: d.Message}, nil
+		}
+	}
+}
+
+// call holds the parts of a tool call that rules match on.
+type call struct {
+	tool      string
+	agent     string
+	mcpServer string
+	mcpTool   string
+	isMCP     bool
+	path      string
+	hasPath   bool
+	commands  []string
+	unsafe    bool
+	isBash    bool
+}
+
+func (e *Engine) newCall(toolName string, input map[string]any, opts control.CanUseToolOptions) *call {
+	c := &call{tool: toolName}
+	if opts.AgentID != nil {
+		c.agent = *opts.AgentID
+	}
+	c.mcpServer, c.mcpTool, c.isMCP = splitMCPTool(toolName)
+
+	if p, ok := inputPath(input); ok {
+		if !filepath.IsAbs(p) && e.baseDir != "" {
+			p = filepath.Join(e.baseDir, p)
+		}
+		c.path, c.hasPath = filepath.ToSlash(filepath.Clean(p)), true
+	}
+	if cmd, ok := input["command"].(string); ok && toolName == "Bash" {
+		c.commands, c.unsafe = splitCommands(cmd)
+		c.isBash = true
+	}
+	return c
+}
+
+// match reports whether every matcher of r matches, and describes the match.
+func (c *call) match(r Rule) (string, bool) {
+	var reasons []string
+
+	if len(r.Tools) > 0 {
+		if !matchAny(r.Tools, c.tool) {
+			return "", false
+		}
+		reasons = append(reasons, "tool "+c.tool)
+	}
+	if len(r.MCPServers) > 0 {
+		if !c.isMCP || !matchAny(r.MCPServers, c.mcpServer) {
+			return "", false
+		}
+		reasons = append(reasons, "MCP server "+c.mcpServer)
+	}
+	if len(r.MCPTools) > 0 {
+		if !c.isMCP || !matchAny(r.MCPTools, c.mcpTool) {
+			return "", false
+		}
+		reasons = append(reasons, "MCP tool "+c.mcpTool)
+	}
+	if len(r.Agents) > 0 {
+		if !matchAgent(r.Agents, c.agent) {
+			return "", false
+		}
+		if c.agent == "" {
+			reasons = append(reasons, "main thread")
+		} else {
+			reasons = append(reasons, "agent "+c.agent)
+		}
+	}
+	if len(r.Paths) > 0 {
+		glob, ok := c.matchPath(r.Paths)
+		if !ok {
+			return "", false
+		}
+		reasons = append(reasons, fmt.Sprintf("path %s matched %q", c.path, glob))
+	}
+	if len(r.Commands) > 0 {
+		if !c.matchCommands(r.Commands, r.Behavior == control.PermissionAllow) {
+			return "", false
+		}
+		reasons = append(reasons, "command prefix matched")
+	}
+
+	if len(reasons) == 0 {
+		return "catch-all rule", true
+	}
+	return strings.Join(reasons, ", "), true
+}
+
+// matchAgent only lets MainAgent match the main thread, so that "*" means
+// any subagent.
+func matchAgent(globs []string, agent string) bool {
+	if agent == "" {
+		for _, g := range globs {
+			if g == MainAgent {
+				return true
+			}
+		}
+		return false
+	}
+	return matchAny(globs, agent)
+}
+
+func (c *call) matchPath(globs []string) (string, bool) {
+	if !c.hasPath {
+		return "", false
+	}
+	for _, g := range globs {
+		if matchPath(g, c.path) {
+			return g, true
+		}
+	}
+	return "", false
+}
+
+// matchCommands is strict for allow rules, where every simple command must
+// match a prefix, and lenient otherwise, where any one suffices.
+func (c *call) matchCommands(prefixes []string, strict bool) bool {
+	if !c.isBash || len(c.commands) == 0 {
+		return false
+	}
+	if strict && c.unsafe {
+		return false
+	}
+	for _, cmd := range c.commands {
+		matched := false
+		for _, p := range prefixes {
+			if matchCommandPrefix(p, cmd) {
+				matched = true
+				break
+			}
+		}
+		if strict && !matched {
+			return false
+		}
+		if !strict && matched {
+			return true
+		}
+	}
+	return strict
+}
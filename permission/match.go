@@ -0,0 +1,176 @@
+package permission
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// pathInputKeys are the input fields that hold the file path of a tool call.
+var pathInputKeys = []string{"file_path", "notebook_path", "path"}
+
+func inputPath(input map[string]any) (string, bool) {
+	for _, key := range pathInputKeys {
+		if p, ok := input[key].(string); ok && p != "" {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// splitMCPTool splits "mcp__<server>__<tool>" into server and tool.
+func splitMCPTool(name string) (server, tool string, ok bool) {
+	rest, ok := strings.CutPrefix(name, "mcp__")
+	if !ok {
+		return "", "", false
+	}
+	server, tool, ok = strings.Cut(rest, "__")
+	return server, tool, ok && server != ""
+}
+
+func matchAny(globs []string, s string) bool {
+	for _, g := range globs {
+		if ok, _ := path.Match(g, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func validatePathGlob(glob string) error {
+	for _, seg := range strings.Split(filepath.ToSlash(glob), "/") {
+		if seg == "**" {
+			continue
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchPath matches a slash-separated path against a glob where "**" matches
+// zero or more whole segments and other segments use path.Match.
+func matchPath(glob, name string) bool {
+	return matchSegments(splitPath(glob), splitPath(name))
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(filepath.ToSlash(p), "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+func matchSegments(glob, name []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(glob[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(glob[0], name[0]); !ok {
+			return false
+		}
+		glob, name = glob[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// matchCommandPrefix reports whether cmd starts with prefix on a word boundary.
+func matchCommandPrefix(prefix, cmd string) bool {
+	prefix = strings.TrimSpace(prefix)
+	return cmd == prefix || strings.HasPrefix(cmd, prefix+" ") || strings.HasPrefix(cmd, prefix+"\t")
+}
+
+// splitCommands splits a shell command line into its simple commands on
+// ;, &, |, &&, || and newlines outside quotes. unsafe reports command
+// or process substitution, which may run commands no prefix can vouch for,
+// and output redirection to a file, which writes past any path rule.
+func splitCommands(line string) (cmds []string, unsafe bool) {
+	var (
+		cur     strings.Builder
+		quote   byte
+		escaped bool
+	)
+	flush := func() {
+		if s := strings.TrimSpace(cur.String()); s != "" {
+			cmds = append(cmds, s)
+		}
+		cur.Reset()
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+		case c == '`' || (strings.IndexByte("$<>", c) >= 0 && i+1 < len(line) && line[i+1] == '('):
+			unsafe = true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '<' || c == '>' || (c == '&' && i+1 < len(line) && line[i+1] == '>'):
+			op := redirection(line[i:])
+			if writesFile(op, line[i+len(op):]) {
+				unsafe = true
+			}
+			cur.WriteString(op)
+			i += len(op) - 1
+			continue
+		case c == ';' || c == '&' || c == '|' || c == '\n':
+			flush()
+			continue
+		}
+		cur.WriteByte(c)
+	}
+	flush()
+	return cmds, unsafe
+}
+
+// redirectionOps are the redirection operators, longest first.
+var redirectionOps = []string{"&>>", "<<<", "&>", ">>", ">|", ">&", "<&", "<<", ">", "<"}
+
+// redirection returns the redirection operator s starts with.
+func redirection(s string) string {
+	for _, op := range redirectionOps {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return s[:1]
+}
+
+// writesFile reports whether the redirection op, followed by rest, writes to
+// a file. Duplicating a descriptor, as in 2>&1, and writing to /dev/null do
+// not.
+func writesFile(op, rest string) bool {
+	if !strings.Contains(op, ">") {
+		return false
+	}
+	rest = strings.TrimLeft(rest, " \t")
+	target := rest
+	if end := strings.IndexAny(rest, " \t\n;&|<>"); end >= 0 {
+		target = rest[:end]
+	}
+	if op == ">&" && target != "" && strings.Trim(target, "0123456789-") == "" {
+		return false
+	}
+	return target != "/dev/null"
+}
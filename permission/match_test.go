@@ -0,0 +1,71 @@
+package permission
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		glob, path string
+		want       bool
+	}{
+		{"/repo/src/**", "/repo/src/a.go", true},
+		{"/repo/src/**", "/repo/src/a/b/c.go", true},
+		{"/repo/src/**", "/repo/srcx/a.go", false},
+		{"**/.env", "/repo/.env", true},
+		{"**/.env", "/.env", true},
+		{"**/.env", "/repo/.env.example", false},
+		{"/repo/*.go", "/repo/main.go", true},
+		{"/repo/*.go", "/repo/pkg/main.go", false},
+		{"/repo/**/test/*.go", "/repo/test/a.go", true},
+		{"/repo/**/test/*.go", "/repo/a/b/test/a.go", true},
+	}
+	for _, tt := range tests {
+		if got := matchPath(tt.glob, tt.path); got != tt.want {
+			t.Errorf("matchPath(%q, %q) = %v, want %v", tt.glob, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSplitCommands(t *testing.T) {
+	tests := []struct {
+		line       string
+		want       []string
+		wantUnsafe bool
+	}{
+		{"ls -la", []string{"ls -la"}, false},
+		{"git status && git diff || echo no", []string{"git status", "git diff", "echo no"}, false},
+		{"cat a | grep 'x|y'; echo \"a;b\"", []string{"cat a", "grep 'x|y'", "echo \"a;b\""}, false},
+		{"echo `whoami`", []string{"echo `whoami`"}, true},
+		{"echo $(id)", []string{"echo $(id)"}, true},
+		{"echo '$(id)'", []string{"echo '$(id)'"}, false},
+		{"diff <(ls a) <(ls b)", []string{"diff <(ls a) <(ls b)"}, true},
+		{"sleep 1 &\nls", []string{"sleep 1", "ls"}, false},
+		{"git diff > src/main.go", []string{"git diff > src/main.go"}, true},
+		{"cat x >> ~/.bashrc", []string{"cat x >> ~/.bashrc"}, true},
+		{"make &> build.log", []string{"make &> build.log"}, true},
+		{"echo hi >| out", []string{"echo hi >| out"}, true},
+		{"ls >&out", []string{"ls >&out"}, true},
+		{"echo '>' \"a > b\"", []string{"echo '>' \"a > b\""}, false},
+		{"go test ./... 2>&1 | tail -5", []string{"go test ./... 2>&1", "tail -5"}, false},
+		{"go vet 2>/dev/null && cat <&3 >&2", []string{"go vet 2>/dev/null", "cat <&3 >&2"}, false},
+		{"sort < in.txt", []string{"sort < in.txt"}, false},
+	}
+	for _, tt := range tests {
+		got, unsafe := splitCommands(tt.line)
+		if !reflect.DeepEqual(got, tt.want) || unsafe != tt.wantUnsafe {
+			t.Errorf("splitCommands(%q) = %q, %v; want %q, %v", tt.line, got, unsafe, tt.want, tt.wantUnsafe)
+		}
+	}
+}
+
+func TestSplitMCPTool(t *testing.T) {
+	server, tool, ok := splitMCPTool("mcp__github__get_issue")
+	if !ok || server != "github" || tool != "get_issue" {
+		t.Errorf("got %q %q %v", server, tool, ok)
+	}
+	if _, _, ok := splitMCPTool("Read"); ok {
+		t.Error("Read is not an MCP tool")
+	}
+}
@@ -0,0 +1,144 @@
+package permission
+
+import (
+	"context"
+	"fmt"
+
+	"claudeagent/control"
+	"claudeagent/tools"
+)
+
+const defaultApprovedMode = control.PermissionModeAcceptEdits
+
+// PlanReview is a plan the agent submitted for approval by calling
+// ExitPlanMode.
+type PlanReview struct {
+	Plan      string
+	Input     map[string]any
+	ToolUseID string
+	AgentID   *string
+}
+
+// PlanDecision answers a PlanReview.
+type PlanDecision struct {
+	Approved bool
+	// Feedback tells the agent what to change in a rejected plan.
+	Feedback string
+	// Mode is the permission mode to switch to on approval, overriding the
+	// one set with WithApprovedMode.
+	Mode control.PermissionMode
+	// UpdatedPlan replaces the plan text of an approved plan, e.g. after the
+	// reviewer edited it.
+	UpdatedPlan string
+}
+
+// PlanApprover decides whether the agent may carry out a plan.
+type PlanApprover func(ctx context.Context, review PlanReview) (PlanDecision, error)
+
+// PlanOption configures a PlanGate.
+type PlanOption func(*PlanGate)
+
+// WithApprovedMode sets the permission mode the session switches to when a
+// plan is approved. The default is acceptEdits.
+func WithApprovedMode(mode control.PermissionMode) PlanOption {
+	return func(g *PlanGate) {
+		g.mode = mode
+	}
+}
+
+// WithPlanFallback decides every tool call other than ExitPlanMode, e.g.
+// with a policy engine or an ApprovalBroker. Without one, such calls are
+// denied.
+func WithPlanFallback(fn control.CanUseToolFunc) PlanOption {
+	return func(g *PlanGate) {
+		g.fallback = fn
+	}
+}
+
+// PlanGate runs the plan mode approval workflow. Start the session in plan
+// mode with the gate's CanUseTool; when the agent calls ExitPlanMode, the
+// plan goes to the approver. An approved plan is allowed and the session
+// switches to the approved mode through a setMode permission update, so
+// the agent starts on the plan right away. A rejected plan is denied with
+// the reviewer's feedback, so the agent stays in plan mode and revises it.
+type PlanGate struct {
+	approve  PlanApprover
+	mode     control.PermissionMode
+	fallback control.CanUseToolFunc
+}
+
+// NewPlanGate creates a gate that sends plans to approve.
+func NewPlanGate(approve PlanApprover, opts ...PlanOption) *PlanGate {
+	g := &PlanGate{approve: approve, mode: defaultApprovedMode}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// CanUseTool returns the permission callback to register with WithCanUseTool.
+func (g *PlanGate) CanUseTool() control.CanUseToolFunc {
+	return func(ctx context.Context, toolName string, input map[string]any, opts control.CanUseToolOptions) (control.PermissionResult, error) {
+		if toolName != tools.ExitPlanMode {
+			return decideOther(ctx, g.fallback, toolName, input, opts)
+		}
+		return g.review(ctx, input, opts)
+	}
+}
+
+func (g *PlanGate) review(ctx context.Context, input map[string]any, opts control.CanUseToolOptions) (control.PermissionResult, error) {
+	in, err := tools.Decode[tools.ExitPlanModeInput](input)
+	if err != nil {
+		return control.PermissionResult{}, err
+	}
+	d, err := g.approve(ctx, PlanReview{
+		Plan:      in.Plan,
+		Input:     input,
+		ToolUseID: opts.ToolUseID,
+		AgentID:   opts.AgentID,
+	})
+	if err != nil {
+		return control.PermissionResult{}, err
+	}
+
+	if !d.Approved {
+		msg := "The plan was rejected. Revise it and present it again."
+		if d.Feedback != "" {
+			msg = "The plan was rejected. Revise it based on this feedback and present it again:\n\n" + d.Feedback
+		}
+		return control.PermissionResult{Behavior: control.PermissionDeny, Message: msg}, nil
+	}
+
+	updated := input
+	if d.UpdatedPlan != "" {
+		in.Plan = d.UpdatedPlan
+		if updated, err = tools.UpdateInput(input, in); err != nil {
+			return control.PermissionResult{}, err
+		}
+	}
+	mode := d.Mode
+	if mode == "" {
+		mode = g.mode
+	}
+	return control.PermissionResult{
+		Behavior:     control.PermissionAllow,
+		UpdatedInput: updated,
+		UpdatedPermissions: []control.PermissionUpdate{{
+			Type:        "setMode",
+			Mode:        &mode,
+			Destination: sessionDestination,
+		}},
+	}, nil
+}
+
+// decideOther passes a call a gate does not handle to its fallback, denying
+// it without one.
+func decideOther(ctx context.Context, fallback control.CanUseToolFunc, toolName string, input map[string]any, opts control.CanUseToolOptions) (control.PermissionResult, error) {
+	if fallback != nil {
+		return fallback(ctx, toolName, input, opts)
+	}
+	return control.PermissionResult{
+		Behavior: control.PermissionDeny,
+		Message:  fmt.Sprintf("%s requires approval and no approver is configured", toolName),
+	}, nil
+}
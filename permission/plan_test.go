@@ -0,0 +1,107 @@
+package permission
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"claudeagent/control"
+)
+
+func TestPlanGate_Approve(t *testing.T) {
+	var got PlanReview
+	gate := NewPlanGate(func(_ context.Context, r PlanReview) (PlanDecision, error) {
+		got = r
+		return PlanDecision{Approved: true, UpdatedPlan: "1. Edit\n2. Test"}, nil
+	})
+	input := map[string]any{"plan": "1. Edit", "extra": true}
+
+	res, err := gate.CanUseTool()(context.Background(), "ExitPlanMode", input, control.CanUseToolOptions{ToolUseID: "tool_1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Plan != "1. Edit" || got.ToolUseID != "tool_1" {
+		t.Errorf("unexpected review: %+v", got)
+	}
+	if res.Behavior != control.PermissionAllow || res.UpdatedInput["plan"] != "1. Edit\n2. Test" || res.UpdatedInput["extra"] != true {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if len(res.UpdatedPermissions) != 1 {
+		t.Fatalf("expected a mode update, got %+v", res.UpdatedPermissions)
+	}
+	u := res.UpdatedPermissions[0]
+	if u.Type != "setMode" || u.Mode == nil || *u.Mode != control.PermissionModeAcceptEdits || u.Destination != "session" {
+		t.Errorf("unexpected mode update: %+v", u)
+	}
+}
+
+func TestPlanGate_Mode(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []PlanOption
+		decision control.PermissionMode
+		want     control.PermissionMode
+	}{
+		{"default", nil, "", control.PermissionModeAcceptEdits},
+		{"configured", []PlanOption{WithApprovedMode(control.PermissionModeDefault)}, "", control.PermissionModeDefault},
+		{"decision", []PlanOption{WithApprovedMode(control.PermissionModeDefault)}, control.PermissionModeBypassPermissions, control.PermissionModeBypassPermissions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gate := NewPlanGate(func(context.Context, PlanReview) (PlanDecision, error) {
+				return PlanDecision{Approved: true, Mode: tt.decision}, nil
+			}, tt.opts...)
+			res, err := gate.CanUseTool()(context.Background(), "ExitPlanMode", map[string]any{"plan": "p"}, control.CanUseToolOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mode := *res.UpdatedPermissions[0].Mode; mode != tt.want {
+				t.Errorf("mode = %s, want %s", mode, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanGate_Reject(t *testing.T) {
+	gate := NewPlanGate(func(context.Context, PlanReview) (PlanDecision, error) {
+		return PlanDecision{Feedback: "Add tests first."}, nil
+	})
+	res, err := gate.CanUseTool()(context.Background(), "ExitPlanMode", map[string]any{"plan": "p"}, control.CanUseToolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Behavior != control.PermissionDeny || !strings.HasSuffix(res.Message, "Add tests first.") || len(res.UpdatedPermissions) != 0 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+}
+
+func TestPlanGate_Error(t *testing.T) {
+	errReview := errors.New("review service down")
+	gate := NewPlanGate(func(context.Context, PlanReview) (PlanDecision, error) {
+		return PlanDecision{}, errReview
+	})
+	if _, err := gate.CanUseTool()(context.Background(), "ExitPlanMode", map[string]any{}, control.CanUseToolOptions{}); !errors.Is(err, errReview) {
+		t.Errorf("expected review error, got %v", err)
+	}
+}
+
+func TestPlanGate_Fallback(t *testing.T) {
+	approve := func(context.Context, PlanReview) (PlanDecision, error) {
+		t.Error("approver called for another tool")
+		return PlanDecision{}, nil
+	}
+
+	res, _ := NewPlanGate(approve).CanUseTool()(context.Background(), "Bash", map[string]any{}, control.CanUseToolOptions{})
+	if res.Behavior != control.PermissionDeny {
+		t.Errorf("expected deny without fallback, got %+v", res)
+	}
+
+	fallback := func(context.Context, string, map[string]any, control.CanUseToolOptions) (control.PermissionResult, error) {
+		return control.PermissionResult{Behavior: control.PermissionAllow}, nil
+	}
+	res, _ = NewPlanGate(approve, WithPlanFallback(fallback)).CanUseTool()(context.Background(), "Bash", map[string]any{}, control.CanUseToolOptions{})
+	if res.Behavior != control.PermissionAllow {
+		t.Errorf("expected fallback decision, got %+v", res)
+	}
+}
@@ -0,0 +1,147 @@
+// Package permission evaluates declarative tool permission policies.
+//
+// A Policy is an ordered list of rules. The first rule that matches a tool
+// call decides it; calls no rule matches get the policy default. Policies
+// are compiled into a control.CanUseToolFunc:
+//
+//	policy, err := permission.LoadFile("policy.json")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	engine, err := policy.Compile(permission.WithBaseDir(cwd))
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	client, err := claudeagent.NewClient(claudeagent.WithCanUseTool(engine.CanUseTool()))
+//
+// The package also parses the CLI's own rule syntax, such as
+// "Bash(npm run test:*)", into CLIRule values that can be matched against
+// tool calls with the CLI's semantics and printed back out.
+package permission
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"claudeagent/control"
+)
+
+// MainAgent matches calls made by the main thread rather than a subagent.
+const MainAgent = "main"
+
+// Rule matches tool calls and decides them. Every non-empty matcher must
+// match; within a matcher any entry may match. A rule without matchers
+// matches every call.
+type Rule struct {
+	// Name identifies the rule in decisions and deny messages.
+	Name string `json:"name,omitempty"`
+	// Tools are globs on the tool name, e.g. "Read" or "mcp__*".
+	Tools []string `json:"tools,omitempty"`
+	// MCPServers are globs on the server of an MCP tool (mcp__<server>__<tool>).
+	MCPServers []string `json:"mcpServers,omitempty"`
+	// MCPTools are globs on the tool name within its MCP server.
+	MCPTools []string `json:"mcpTools,omitempty"`
+	// Paths are globs on the file path of Read, Write, Edit, MultiEdit,
+	// NotebookEdit, Glob and Grep calls. "**" matches any number of
+	// directories; relative globs are resolved against the base directory.
+	Paths []string `json:"paths,omitempty"`
+	// Commands are Bash command prefixes matched on whole words. Allow rules
+	// only match when every command in a pipeline or list matches.
+	Commands []string `json:"commands,omitempty"`
+	// Agents are globs on the subagent ID. Globs never match the main
+	// thread; list MainAgent for that.
+	Agents []string `json:"agents,omitempty"`
+
+	Behavior control.PermissionBehavior `json:"behavior"`
+	// Message is returned to the model when the rule denies a call.
+	Message string `json:"message,omitempty"`
+}
+
+// Policy is an ordered list of rules.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+	// Default decides calls no rule matches. It defaults to ask.
+	Default control.PermissionBehavior `json:"default,omitempty"`
+}
+
+// Load reads a JSON policy. Unknown fields are rejected so that typos do not
+// silently widen a policy.
+func Load(r io.Reader) (*Policy, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var p Policy
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// LoadFile reads a JSON policy from a file.
+func LoadFile(name string) (*Policy, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("open policy: %w", err)
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Validate checks behaviors and glob syntax.
+func (p *Policy) Validate() error {
+	if p.Default != "" && !validBehavior(p.Default) {
+		return fmt.Errorf("invalid default behavior %q", p.Default)
+	}
+	for i, r := range p.Rules {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("rule %s: %w", ruleLabel(i, r.Name), err)
+		}
+	}
+	return nil
+}
+
+func (r Rule) validate() error {
+	if !validBehavior(r.Behavior) {
+		return fmt.Errorf("invalid behavior %q", r.Behavior)
+	}
+	for _, globs := range [][]string{r.Tools, r.MCPServers, r.MCPTools, r.Agents} {
+		for _, g := range globs {
+			if _, err := path.Match(g, ""); err != nil {
+				return fmt.Errorf("invalid glob %q: %w", g, err)
+			}
+		}
+	}
+	for _, g := range r.Paths {
+		if err := validatePathGlob(g); err != nil {
+			return fmt.Errorf("invalid path glob %q: %w", g, err)
+		}
+	}
+	for _, c := range r.Commands {
+		if c == "" {
+			return errors.New("empty command prefix")
+		}
+	}
+	return nil
+}
+
+func validBehavior(b control.PermissionBehavior) bool {
+	switch b {
+	case control.PermissionAllow, control.PermissionDeny, control.PermissionAsk:
+		return true
+	default:
+		return false
+	}
+}
+
+func ruleLabel(index int, name string) string {
+	if name != "" {
+		return fmt.Sprintf("%d (%s)", index, name)
+	}
+	return fmt.Sprintf("%d", index)
+}
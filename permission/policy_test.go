@@ -0,0 +1,162 @@
+package permission
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"claudeagent/control"
+)
+
+const testPolicy = `{
+  "rules": [
+    {"name": "no-secrets", "tools": ["Read", "Write", "Edit"], "paths": ["**/.env", "**/*.pem"], "behavior": "deny", "message": "secrets are off limits"},
+    {"name": "edit-src", "tools": ["Write", "Edit"], "paths": ["src/**"], "behavior": "allow"},
+    {"name": "read", "tools": ["Read", "Glob", "Grep"], "behavior": "allow"},
+    {"name": "no-push", "tools": ["Bash"], "commands": ["git push"], "behavior": "deny"},
+    {"name": "safe-bash", "tools": ["Bash"], "commands": ["git status", "git diff", "ls", "go test"], "behavior": "allow"},
+    {"name": "github-read", "mcpServers": ["github"], "mcpTools": ["get_*", "list_*"], "behavior": "allow"},
+    {"name": "subagents-ask", "agents": ["*"], "behavior": "ask"},
+    {"name": "main-web", "tools": ["WebFetch"], "agents": ["main"], "behavior": "allow"}
+  ],
+  "default": "deny"
+}`
+
+func compileTestPolicy(t *testing.T, opts ...Option) *Engine {
+	t.Helper()
+	p, err := Load(strings.NewReader(testPolicy))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	e, err := p.Compile(append([]Option{WithBaseDir("/repo")}, opts...)...)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	return e
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	e := compileTestPolicy(t)
+	sub := "agent-1"
+
+	tests := []struct {
+		name     string
+		tool     string
+		input    map[string]any
+		agent    *string
+		want     control.PermissionBehavior
+		wantRule string
+	}{
+		{"secret read", "Read", map[string]any{"file_path": "/repo/config/.env"}, nil, control.PermissionDeny, "no-secrets"},
+		{"relative secret", "Edit", map[string]any{"file_path": "keys/server.pem"}, nil, control.PermissionDeny, "no-secrets"},
+		{"edit in src", "Edit", map[string]any{"file_path": "/repo/src/pkg/a.go"}, nil, control.PermissionAllow, "edit-src"},
+		{"traversal out of src", "Write", map[string]any{"file_path": "/repo/src/../go.mod"}, nil, control.PermissionDeny, ""},
+		{"edit outside src", "Write", map[string]any{"file_path": "/etc/passwd"}, nil, control.PermissionDeny, ""},
+		{"read anything", "Read", map[string]any{"file_path": "/repo/README.md"}, nil, control.PermissionAllow, "read"},
+		{"git push", "Bash", map[string]any{"command": "git status && git push origin main"}, nil, control.PermissionDeny, "no-push"},
+		{"safe pipeline", "Bash", map[string]any{"command": "go test ./... | tail -5"}, nil, control.PermissionDeny, ""},
+		{"safe list", "Bash", map[string]any{"command": "git status; git diff --stat"}, nil, control.PermissionAllow, "safe-bash"},
+		{"chained unsafe", "Bash", map[string]any{"command": "ls && rm -rf /"}, nil, control.PermissionDeny, ""},
+		{"substitution", "Bash", map[string]any{"command": "ls $(rm -rf /)"}, nil, control.PermissionDeny, ""},
+		{"redirect to file", "Bash", map[string]any{"command": "git diff > src/main.go"}, nil, control.PermissionDeny, ""},
+		{"stderr to stdout", "Bash", map[string]any{"command": "go test ./... 2>&1"}, nil, control.PermissionAllow, "safe-bash"},
+		{"prefix word boundary", "Bash", map[string]any{"command": "lsblk"}, nil, control.PermissionDeny, ""},
+		{"quoted separator", "Bash", map[string]any{"command": "git diff -- 'a;b'"}, nil, control.PermissionAllow, "safe-bash"},
+		{"mcp read", "mcp__github__get_issue", nil, nil, control.PermissionAllow, "github-read"},
+		{"mcp write", "mcp__github__create_issue", nil, nil, control.PermissionDeny, ""},
+		{"subagent", "WebFetch", nil, &sub, control.PermissionAsk, "subagents-ask"},
+		{"main thread", "WebFetch", nil, nil, control.PermissionAllow, "main-web"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := e.Evaluate(tt.tool, tt.input, control.CanUseToolOptions{AgentID: tt.agent})
+			if d.Behavior != tt.want || d.RuleName != tt.wantRule {
+				t.Errorf("got %s by %q, want %s by %q (%s)", d.Behavior, d.RuleName, tt.want, tt.wantRule, d.Explanation)
+			}
+			if tt.wantRule == "" && d.Rule != -1 {
+				t.Errorf("expected default decision, got rule %d", d.Rule)
+			}
+		})
+	}
+}
+
+func TestEngine_Explanation(t *testing.T) {
+	e := compileTestPolicy(t)
+	d := e.Evaluate("Read", map[string]any{"file_path": "/repo/.env"}, control.CanUseToolOptions{})
+	if !strings.Contains(d.Explanation, "no-secrets") || !strings.Contains(d.Explanation, "/repo/.env") {
+		t.Errorf("unexpected explanation: %s", d.Explanation)
+	}
+}
+
+func TestEngine_CanUseTool(t *testing.T) {
+	var decisions []Decision
+	asked := false
+	e := compileTestPolicy(t,
+		WithDecisionHook(func(_ string, d Decision) { decisions = append(decisions, d) }),
+		WithAskHandler(func(ctx context.Context, toolName string, input map[string]any, opts control.CanUseToolOptions) (control.PermissionResult, error) {
+			asked = true
+			return control.PermissionResult{Behavior: control.PermissionAllow, UpdatedInput: input}, nil
+		}),
+	)
+	fn := e.CanUseTool()
+	ctx := context.Background()
+
+	input := map[string]any{"file_path": "/repo/.env"}
+	res, err := fn(ctx, "Read", input, control.CanUseToolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Behavior != control.PermissionDeny || res.Message != "secrets are off limits" {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	input = map[string]any{"file_path": "/repo/README.md"}
+	res, _ = fn(ctx, "Read", input, control.CanUseToolOptions{})
+	if res.Behavior != control.PermissionAllow || res.UpdatedInput["file_path"] != "/repo/README.md" {
+		t.Errorf("allow should pass input through: %+v", res)
+	}
+
+	sub := "agent-1"
+	res, _ = fn(ctx, "WebFetch", nil, control.CanUseToolOptions{AgentID: &sub})
+	if !asked || res.Behavior != control.PermissionAllow {
+		t.Errorf("ask handler not used: asked=%v result=%+v", asked, res)
+	}
+	if len(decisions) != 3 {
+		t.Errorf("expected 3 decisions, got %d", len(decisions))
+	}
+}
+
+func TestEngine_AskWithoutHandler(t *testing.T) {
+	e, err := (&Policy{}).Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := e.CanUseTool()(context.Background(), "Bash", map[string]any{"command": "ls"}, control.CanUseToolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Behavior != control.PermissionDeny {
+		t.Errorf("ask without handler should deny, got %s", res.Behavior)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":    `{"rules": [{"tool": ["Read"], "behavior": "allow"}]}`,
+		"bad behavior":     `{"rules": [{"behavior": "maybe"}]}`,
+		"bad default":      `{"rules": [], "default": "never"}`,
+		"bad glob":         `{"rules": [{"tools": ["[Read"], "behavior": "allow"}]}`,
+		"bad path glob":    `{"rules": [{"paths": ["src/[a"], "behavior": "allow"}]}`,
+		"empty command":    `{"rules": [{"commands": [""], "behavior": "deny"}]}`,
+		"malformed json":   `{"rules": [`,
+		"missing behavior": `{"rules": [{"tools": ["Read"]}]}`,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Load(strings.NewReader(data)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package permission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"claudeagent/control"
+	"claudeagent/tools"
+)
+
+// ErrNoAnswer is returned by a QuestionAnswerer that cannot answer a
+// question, so that the gate's unanswered policy applies.
+var ErrNoAnswer = errors.New("no answer available")
+
+// QuestionAnswerer answers one question the agent asked with AskUserQuestion.
+// It returns the labels of the chosen options, more than one only for
+// multi-select questions, or free text in place of a label.
+type QuestionAnswerer func(ctx context.Context, q tools.Question) ([]string, error)
+
+// UnansweredPolicy says what a QuestionGate does with questions its answerer
+// cannot answer.
+type UnansweredPolicy int
+
+const (
+	// FailUnanswered denies the AskUserQuestion call and interrupts the turn.
+	FailUnanswered UnansweredPolicy = iota
+	// AnswerFirstOption picks the first option of the question.
+	AnswerFirstOption
+)
+
+// QuestionOption configures a QuestionGate.
+type QuestionOption func(*QuestionGate)
+
+// WithUnansweredPolicy sets what happens to questions the answerer cannot
+// answer, or all questions without an answerer. The default is
+// FailUnanswered.
+func WithUnansweredPolicy(p UnansweredPolicy) QuestionOption {
+	return func(g *QuestionGate) {
+		g.unanswered = p
+	}
+}
+
+// WithQuestionFallback decides every tool call other than AskUserQuestion.
+// Without one, such calls are denied.
+func WithQuestionFallback(fn control.CanUseToolFunc) QuestionOption {
+	return func(g *QuestionGate) {
+		g.fallback = fn
+	}
+}
+
+// QuestionGate answers the agent's AskUserQuestion calls in the permission
+// flow, for runs without a user to ask. The answers are returned to the
+// agent in the tool input, as the CLI's own prompt does.
+type QuestionGate struct {
+	answer     QuestionAnswerer
+	unanswered UnansweredPolicy
+	fallback   control.CanUseToolFunc
+}
+
+// NewQuestionGate creates a gate that asks answer. A nil answer leaves every
+// question to the unanswered policy.
+func NewQuestionGate(answer QuestionAnswerer, opts ...QuestionOption) *QuestionGate {
+	g := &QuestionGate{answer: answer}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// CanUseTool returns the permission callback to register with WithCanUseTool.
+func (g *QuestionGate) CanUseTool() control.CanUseToolFunc {
+	return func(ctx context.Context, toolName string, input map[string]any, opts control.CanUseToolOptions) (control.PermissionResult, error) {
+		if toolName != tools.AskUserQuestion {
+			return decideOther(ctx, g.fallback, toolName, input, opts)
+		}
+		return g.ask(ctx, input)
+	}
+}
+
+func (g *QuestionGate) ask(ctx context.Context, input map[string]any) (control.PermissionResult, error) {
+	in, err := tools.Decode[tools.AskUserQuestionInput](input)
+	if err != nil {
+		return control.PermissionResult{}, err
+	}
+
+	in.Answers = make(map[string]string, len(in.Questions))
+	for _, q := range in.Questions {
+		labels, err := g.answerOne(ctx, q)
+		if errors.Is(err, ErrNoAnswer) {
+			return control.PermissionResult{
+				Behavior:  control.PermissionDeny,
+				Message:   fmt.Sprintf("No answer is available for %q, so the run was stopped.", q.Question),
+				Interrupt: true,
+			}, nil
+		}
+		if err != nil {
+			return control.PermissionResult{}, err
+		}
+		in.Answers[q.Question] = strings.Join(labels, ", ")
+	}
+
+	updated, err := tools.UpdateInput(input, in)
+	if err != nil {
+		return control.PermissionResult{}, err
+	}
+	return control.PermissionResult{Behavior: control.PermissionAllow, UpdatedInput: updated}, nil
+}
+
+// answerOne returns ErrNoAnswer when neither the answerer nor the policy
+// answers q.
+func (g *QuestionGate) answerOne(ctx context.Context, q tools.Question) ([]string, error) {
+	if g.answer != nil {
+		labels, err := g.answer(ctx, q)
+		if err == nil && len(labels) > 0 {
+			return labels, nil
+		}
+		if err != nil && !errors.Is(err, ErrNoAnswer) {
+			return nil, fmt.Errorf("answer %q: %w", q.Question, err)
+		}
+	}
+	if g.unanswered == AnswerFirstOption && len(q.Options) > 0 {
+		return []string{q.Options[0].Label}, nil
+	}
+	return nil, ErrNoAnswer
+}
@@ -0,0 +1,115 @@
+package permission
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"claudeagent/control"
+	"claudeagent/tools"
+)
+
+func questionInput() map[string]any {
+	return map[string]any{"questions": []any{
+		map[string]any{
+			"question": "Which database?", "header": "DB", "multiSelect": false,
+			"options": []any{
+				map[string]any{"label": "Postgres", "description": "SQL"},
+				map[string]any{"label": "Redis", "description": "KV"},
+			},
+		},
+		map[string]any{
+			"question": "Which features?", "header": "Features", "multiSelect": true,
+			"options": []any{
+				map[string]any{"label": "Auth", "description": ""},
+				map[string]any{"label": "Billing", "description": ""},
+			},
+		},
+	}}
+}
+
+func TestQuestionGate_Answer(t *testing.T) {
+	var asked []tools.Question
+	gate := NewQuestionGate(func(_ context.Context, q tools.Question) ([]string, error) {
+		asked = append(asked, q)
+		if q.MultiSelect {
+			return []string{"Auth", "Billing"}, nil
+		}
+		return []string{"Redis"}, nil
+	})
+
+	res, err := gate.CanUseTool()(context.Background(), "AskUserQuestion", questionInput(), control.CanUseToolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(asked) != 2 || asked[0].Options[1].Label != "Redis" {
+		t.Errorf("unexpected questions: %+v", asked)
+	}
+	answers, ok := res.UpdatedInput["answers"].(map[string]any)
+	if res.Behavior != control.PermissionAllow || !ok {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if answers["Which database?"] != "Redis" || answers["Which features?"] != "Auth, Billing" {
+		t.Errorf("answers = %v", answers)
+	}
+	if _, ok := res.UpdatedInput["questions"]; !ok {
+		t.Error("questions dropped from the updated input")
+	}
+}
+
+func TestQuestionGate_Unanswered(t *testing.T) {
+	partial := func(_ context.Context, q tools.Question) ([]string, error) {
+		if q.MultiSelect {
+			return nil, ErrNoAnswer
+		}
+		return []string{"Postgres"}, nil
+	}
+
+	res, err := NewQuestionGate(partial).CanUseTool()(context.Background(), "AskUserQuestion", questionInput(), control.CanUseToolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Behavior != control.PermissionDeny || !res.Interrupt {
+		t.Errorf("expected an interrupting deny, got %+v", res)
+	}
+
+	res, err = NewQuestionGate(partial, WithUnansweredPolicy(AnswerFirstOption)).CanUseTool()(context.Background(), "AskUserQuestion", questionInput(), control.CanUseToolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	answers, _ := res.UpdatedInput["answers"].(map[string]any)
+	if answers["Which database?"] != "Postgres" || answers["Which features?"] != "Auth" {
+		t.Errorf("answers = %v", answers)
+	}
+
+	res, _ = NewQuestionGate(nil, WithUnansweredPolicy(AnswerFirstOption)).CanUseTool()(context.Background(), "AskUserQuestion", questionInput(), control.CanUseToolOptions{})
+	if answers, _ := res.UpdatedInput["answers"].(map[string]any); answers["Which database?"] != "Postgres" {
+		t.Errorf("answers without answerer = %v", answers)
+	}
+}
+
+func TestQuestionGate_Error(t *testing.T) {
+	errUI := errors.New("ui closed")
+	gate := NewQuestionGate(func(context.Context, tools.Question) ([]string, error) {
+		return nil, errUI
+	}, WithUnansweredPolicy(AnswerFirstOption))
+	if _, err := gate.CanUseTool()(context.Background(), "AskUserQuestion", questionInput(), control.CanUseToolOptions{}); !errors.Is(err, errUI) {
+		t.Errorf("expected answerer error, got %v", err)
+	}
+}
+
+func TestQuestionGate_Fallback(t *testing.T) {
+	plan := NewPlanGate(func(context.Context, PlanReview) (PlanDecision, error) {
+		return PlanDecision{Approved: true}, nil
+	})
+	gate := NewQuestionGate(nil, WithQuestionFallback(plan.CanUseTool()))
+
+	res, err := gate.CanUseTool()(context.Background(), "ExitPlanMode", map[string]any{"plan": "p"}, control.CanUseToolOptions{})
+	if err != nil || res.Behavior != control.PermissionAllow {
+		t.Errorf("expected the plan gate to decide, got %+v, %v", res, err)
+	}
+	res, _ = gate.CanUseTool()(context.Background(), "Write", map[string]any{}, control.CanUseToolOptions{})
+	if res.Behavior != control.PermissionDeny {
+		t.Errorf("expected deny, got %+v", res)
+	}
+}
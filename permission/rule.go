@@ -0,0 +1,299 @@
+package permission
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"claudeagent/control"
+)
+
+// CLIRuleKind says how the content of a CLI permission rule is interpreted.
+type CLIRuleKind int
+
+const (
+	// RuleTool matches every use of a tool, e.g. "WebSearch" or "mcp__github".
+	RuleTool CLIRuleKind = iota
+	// RuleCommand matches an exact Bash command, e.g. "Bash(npm test)".
+	RuleCommand
+	// RuleCommandPrefix matches Bash commands by their leading words, e.g.
+	// "Bash(npm run test:*)" matches "npm run test" and "npm run test -- -v".
+	RuleCommandPrefix
+	// RulePath matches file paths with gitignore-style globs, e.g. "Read(./src/**)".
+	RulePath
+	// RuleDomain matches WebFetch URLs by host, e.g. "WebFetch(domain:example.com)".
+	RuleDomain
+	// RuleAgent matches the subagent type of Task calls, e.g. "Task(Explore)".
+	RuleAgent
+	// RuleContent is any other content; it is kept for printing but never matches.
+	RuleContent
+)
+
+const (
+	prefixSuffix = ":*"
+	domainPrefix = "domain:"
+)
+
+// readTools and editTools are covered by Read and Edit rules respectively.
+var (
+	readTools = []string{"Read", "Glob", "Grep", "LS", "NotebookRead"}
+	editTools = []string{"Edit", "MultiEdit", "Write", "NotebookEdit"}
+)
+
+// CLIRule is a parsed CLI permission rule such as "Bash(npm run test:*)".
+type CLIRule struct {
+	Tool string
+	// Content is the raw text between the parentheses, or "" for whole-tool rules.
+	Content string
+	Kind    CLIRuleKind
+	// Value is Content with the rule syntax removed: the command, command
+	// prefix, path pattern, domain or agent type.
+	Value string
+}
+
+// RuleContext resolves relative path patterns. Empty fields default to the
+// process working directory and home directory; ProjectDir defaults to Cwd.
+type RuleContext struct {
+	// Cwd resolves "./path" and "path" patterns.
+	Cwd string
+	// ProjectDir resolves "/path" patterns, which are relative to the
+	// directory holding the settings file.
+	ProjectDir string
+	// HomeDir resolves "~/path" patterns.
+	HomeDir string
+}
+
+// ParseCLIRule parses the CLI's rule syntax: a tool name, optionally followed
+// by content in parentheses. Parentheses inside the content are escaped with
+// a backslash.
+func ParseCLIRule(s string) (CLIRule, error) {
+	s = strings.TrimSpace(s)
+	open := strings.IndexByte(s, '(')
+	if open < 0 {
+		return NewCLIRule(s, "")
+	}
+	if !strings.HasSuffix(s, ")") {
+		return CLIRule{}, fmt.Errorf("permission rule %q: missing closing parenthesis", s)
+	}
+	content, err := unescapeContent(s[open+1 : len(s)-1])
+	if err != nil {
+		return CLIRule{}, fmt.Errorf("permission rule %q: %w", s, err)
+	}
+	return NewCLIRule(s[:open], content)
+}
+
+// FromPermissionRule parses the rule carried by a permission update.
+func FromPermissionRule(r control.PermissionRule) (CLIRule, error) {
+	return NewCLIRule(r.ToolName, r.RuleContent)
+}
+
+// NewCLIRule builds a rule from a tool name and unescaped content.
+func NewCLIRule(tool, content string) (CLIRule, error) {
+	if err := validateToolName(tool); err != nil {
+		return CLIRule{}, err
+	}
+	r := CLIRule{Tool: tool, Content: content, Kind: RuleTool}
+	if content == "" || (content == "*" && tool != "Bash") {
+		r.Content = ""
+		return r, nil
+	}
+
+	switch {
+	case tool == "Bash":
+		if prefix, ok := strings.CutSuffix(content, prefixSuffix); ok {
+			r.Kind, r.Value = RuleCommandPrefix, prefix
+		} else {
+			r.Kind, r.Value = RuleCommand, content
+		}
+	case contains(readTools, tool) || contains(editTools, tool):
+		r.Kind, r.Value = RulePath, content
+		if err := validatePathGlob(content); err != nil {
+			return CLIRule{}, fmt.Errorf("permission rule %s: invalid path pattern: %w", r, err)
+		}
+	case tool == "WebFetch":
+		domain, ok := strings.CutPrefix(content, domainPrefix)
+		if !ok || domain == "" {
+			return CLIRule{}, fmt.Errorf("permission rule %s: WebFetch rules must use domain:<host>", r)
+		}
+		r.Kind, r.Value = RuleDomain, strings.ToLower(domain)
+	case tool == "Task" || tool == "Agent":
+		r.Kind, r.Value = RuleAgent, content
+	default:
+		r.Kind, r.Value = RuleContent, content
+	}
+	return r, nil
+}
+
+func validateToolName(tool string) error {
+	if tool == "" {
+		return errors.New("permission rule: empty tool name")
+	}
+	for _, c := range tool {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '*' || c == '.') {
+			return fmt.Errorf("permission rule: invalid character %q in tool name %q", c, tool)
+		}
+	}
+	return nil
+}
+
+func unescapeContent(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(`()\`, s[i+1]) >= 0:
+			i++
+			b.WriteByte(s[i])
+		case c == '(' || c == ')':
+			return "", fmt.Errorf("unescaped %q in rule content", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+func escapeContent(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(s)
+}
+
+// String prints the rule in the CLI's syntax.
+func (r CLIRule) String() string {
+	if r.Content == "" {
+		return r.Tool
+	}
+	return r.Tool + "(" + escapeContent(r.Content) + ")"
+}
+
+// PermissionRule converts the rule for use in a permission update.
+func (r CLIRule) PermissionRule() control.PermissionRule {
+	return control.PermissionRule{ToolName: r.Tool, RuleContent: r.Content}
+}
+
+// AppliesTo reports whether the rule governs the given tool. Read rules also
+// cover Glob, Grep and LS; Edit rules cover every file editing tool; a rule on
+// an MCP server covers all of its tools.
+func (r CLIRule) AppliesTo(toolName string) bool {
+	switch {
+	case r.Tool == toolName:
+		return true
+	case r.Tool == "Read":
+		return contains(readTools, toolName)
+	case r.Tool == "Edit":
+		return contains(editTools, toolName)
+	case strings.HasPrefix(r.Tool, "mcp__"):
+		server, tool, ok := splitMCPTool(toolName)
+		if !ok {
+			return false
+		}
+		ruleServer, ruleTool, hasTool := splitMCPTool(r.Tool)
+		if !hasTool {
+			ruleServer = strings.TrimPrefix(r.Tool, "mcp__")
+			return server == ruleServer
+		}
+		return server == ruleServer && (ruleTool == "*" || ruleTool == tool)
+	default:
+		return false
+	}
+}
+
+// Match reports whether the rule matches a tool call. Bash rules match the
+// command as a whole; RuleSet applies them per command of a compound line.
+func (r CLIRule) Match(toolName string, input map[string]any, rc RuleContext) bool {
+	if !r.AppliesTo(toolName) {
+		return false
+	}
+	switch r.Kind {
+	case RuleTool:
+		return true
+	case RuleCommand, RuleCommandPrefix:
+		cmd, _ := input["command"].(string)
+		return r.matchCommand(strings.TrimSpace(cmd))
+	case RulePath:
+		p, ok := inputPath(input)
+		return ok && r.matchPath(p, rc.withDefaults())
+	case RuleDomain:
+		raw, _ := input["url"].(string)
+		return r.matchDomain(raw)
+	case RuleAgent:
+		agent, _ := input["subagent_type"].(string)
+		return agent == r.Value
+	default:
+		return false
+	}
+}
+
+func (r CLIRule) matchCommand(cmd string) bool {
+	if r.Kind == RuleCommandPrefix {
+		return matchCommandPrefix(r.Value, cmd)
+	}
+	return cmd == r.Value
+}
+
+// matchPath matches like gitignore: a pattern naming a directory matches
+// everything beneath it.
+func (r CLIRule) matchPath(p string, rc RuleContext) bool {
+	pattern := r.resolvePattern(rc)
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(rc.Cwd, p)
+	}
+	segs := splitPath(filepath.Clean(p))
+	glob := splitPath(pattern)
+	for i := len(segs); i > 0; i-- {
+		if matchSegments(glob, segs[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r CLIRule) resolvePattern(rc RuleContext) string {
+	v := r.Value
+	switch {
+	case strings.HasPrefix(v, "//"):
+		return v[1:]
+	case v == "~" || strings.HasPrefix(v, "~/"):
+		return filepath.ToSlash(filepath.Join(rc.HomeDir, v[1:]))
+	case strings.HasPrefix(v, "/"):
+		return filepath.ToSlash(filepath.Join(rc.ProjectDir, v))
+	default:
+		return filepath.ToSlash(filepath.Join(rc.Cwd, v))
+	}
+}
+
+func (r CLIRule) matchDomain(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if suffix, ok := strings.CutPrefix(r.Value, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == r.Value
+}
+
+func (rc RuleContext) withDefaults() RuleContext {
+	if rc.Cwd == "" {
+		rc.Cwd, _ = os.Getwd()
+	}
+	if rc.ProjectDir == "" {
+		rc.ProjectDir = rc.Cwd
+	}
+	if rc.HomeDir == "" {
+		rc.HomeDir, _ = os.UserHomeDir()
+	}
+	return rc
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package permission
+
+import (
+	"testing"
+
+	"claudeagent/control"
+)
+
+func TestParseCLIRule(t *testing.T) {
+	tests := []struct {
+		in    string
+		tool  string
+		kind  CLIRuleKind
+		value string
+	}{
+		{"WebSearch", "WebSearch", RuleTool, ""},
+		{"Bash()", "Bash", RuleTool, ""},
+		{"Read(*)", "Read", RuleTool, ""},
+		{"Bash(npm run test:*)", "Bash", RuleCommandPrefix, "npm run test"},
+		{"Bash(npm test)", "Bash", RuleCommand, "npm test"},
+		{`Bash(echo \(hi\))`, "Bash", RuleCommand, "echo (hi)"},
+		{"Read(./src/**)", "Read", RulePath, "./src/**"},
+		{"Edit(//etc/hosts)", "Edit", RulePath, "//etc/hosts"},
+		{"WebFetch(domain:Example.com)", "WebFetch", RuleDomain, "example.com"},
+		{"Task(Explore)", "Task", RuleAgent, "Explore"},
+		{"mcp__github", "mcp__github", RuleTool, ""},
+		{"mcp__github__get_issue", "mcp__github__get_issue", RuleTool, ""},
+		{"SomeTool(anything)", "SomeTool", RuleContent, "anything"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			r, err := ParseCLIRule(tt.in)
+			if err != nil {
+				t.Fatalf("ParseCLIRule failed: %v", err)
+			}
+			if r.Tool != tt.tool || r.Kind != tt.kind || r.Value != tt.value {
+				t.Errorf("got %+v", r)
+			}
+		})
+	}
+}
+
+func TestParseCLIRule_Invalid(t *testing.T) {
+	for _, in := range []string{"", "(x)", "Bash(ls", "Bash(echo (x))", "WebFetch(example.com)", "Read([a)", "Bad Tool"} {
+		if r, err := ParseCLIRule(in); err == nil {
+			t.Errorf("ParseCLIRule(%q) = %+v, expected error", in, r)
+		}
+	}
+}
+
+func TestCLIRule_String(t *testing.T) {
+	for _, in := range []string{"WebSearch", "Bash(npm run test:*)", `Bash(echo \(hi\) \\n)`, "Read(~/.ssh/**)", "WebFetch(domain:example.com)"} {
+		r, err := ParseCLIRule(in)
+		if err != nil {
+			t.Fatalf("ParseCLIRule(%q) failed: %v", in, err)
+		}
+		if got := r.String(); got != in {
+			t.Errorf("String() = %q, want %q", got, in)
+		}
+		back, err := FromPermissionRule(r.PermissionRule())
+		if err != nil || back != r {
+			t.Errorf("PermissionRule round trip: %+v, %v", back, err)
+		}
+	}
+}
+
+func TestCLIRule_Match(t *testing.T) {
+	rc := RuleContext{Cwd: "/repo/sub", ProjectDir: "/repo", HomeDir: "/home/u"}
+	tests := []struct {
+		rule  string
+		tool  string
+		input map[string]any
+		want  bool
+	}{
+		{"Bash(npm run test:*)", "Bash", map[string]any{"command": "npm run test -- --watch"}, true},
+		{"Bash(npm run test:*)", "Bash", map[string]any{"command": "npm run test"}, true},
+		{"Bash(npm run test:*)", "Bash", map[string]any{"command": "npm run test:unit"}, false},
+		{"Bash(ls:*)", "Bash", map[string]any{"command": "lsblk"}, false},
+		{"Bash(git diff:*)", "Bash", map[string]any{"command": "git diff-tree HEAD"}, false},
+		{"Bash(git diff:*)", "Bash", map[string]any{"command": "git difftool"}, false},
+		{"Bash(npm run test:*)", "Bash", map[string]any{"command": "npm run build"}, false},
+		{"Bash(npm test)", "Bash", map[string]any{"command": "npm test --watch"}, false},
+		{"Bash", "Bash", map[string]any{"command": "anything"}, true},
+		{"Read(./src/**)", "Read", map[string]any{"file_path": "/repo/sub/src/a/b.go"}, true},
+		{"Read(./src/**)", "Grep", map[string]any{"path": "src/a"}, true},
+		{"Read(./src/**)", "Read", map[string]any{"file_path": "/repo/src/a.go"}, false},
+		{"Read(/src/**)", "Read", map[string]any{"file_path": "/repo/src/a.go"}, true},
+		{"Read(~/.ssh)", "Read", map[string]any{"file_path": "/home/u/.ssh/id_rsa"}, true},
+		{"Edit(//etc/**)", "Write", map[string]any{"file_path": "/etc/hosts"}, true},
+		{"Edit(//etc/**)", "Read", map[string]any{"file_path": "/etc/hosts"}, false},
+		{"Read(**/.env)", "Read", map[string]any{"file_path": "/repo/sub/deep/.env"}, true},
+		{"WebFetch(domain:example.com)", "WebFetch", map[string]any{"url": "https://EXAMPLE.com/x"}, true},
+		{"WebFetch(domain:example.com)", "WebFetch", map[string]any{"url": "https://evil-example.com"}, false},
+		{"WebFetch(domain:*.example.com)", "WebFetch", map[string]any{"url": "https://docs.example.com"}, true},
+		{"mcp__github", "mcp__github__create_issue", nil, true},
+		{"mcp__github__*", "mcp__github__create_issue", nil, true},
+		{"mcp__github__get_issue", "mcp__github__create_issue", nil, false},
+		{"mcp__github", "mcp__githubx__get", nil, false},
+		{"Task(Explore)", "Task", map[string]any{"subagent_type": "Explore"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule+"/"+tt.tool, func(t *testing.T) {
+			r, err := ParseCLIRule(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.Match(tt.tool, tt.input, rc); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleSet_Decide(t *testing.T) {
+	s, err := ParseRuleSet(
+		[]string{"Bash(git status)", "Bash(git diff:*)", "Bash(ls:*)", "Read"},
+		[]string{"Bash(rm:*)", "Read(./.env)"},
+		[]string{"Bash(git push:*)"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := RuleContext{Cwd: "/repo"}
+
+	tests := []struct {
+		tool    string
+		input   map[string]any
+		want    control.PermissionBehavior
+		matched bool
+	}{
+		{"Bash", map[string]any{"command": "git status && git diff HEAD"}, control.PermissionAllow, true},
+		{"Bash", map[string]any{"command": "ls && rm -rf /"}, control.PermissionDeny, true},
+		{"Bash", map[string]any{"command": "git status; git push"}, control.PermissionAsk, true},
+		{"Bash", map[string]any{"command": "ls && make"}, "", false},
+		{"Bash", map[string]any{"command": "ls $(make)"}, "", false},
+		{"Bash", map[string]any{"command": "git diff > src/main.go"}, "", false},
+		{"Bash", map[string]any{"command": "git diff HEAD 2>&1 | ls"}, control.PermissionAllow, true},
+		{"Read", map[string]any{"file_path": "/repo/.env"}, control.PermissionDeny, true},
+		{"Read", map[string]any{"file_path": "/repo/main.go"}, control.PermissionAllow, true},
+		{"Write", map[string]any{"file_path": "/repo/main.go"}, "", false},
+	}
+	for _, tt := range tests {
+		got, rule, ok := s.Decide(tt.tool, tt.input, rc)
+		if got != tt.want || ok != tt.matched {
+			t.Errorf("Decide(%s %v) = %s, %v, %v; want %s, %v", tt.tool, tt.input, got, rule, ok, tt.want, tt.matched)
+		}
+	}
+}
+
+func TestRuleSet_Apply(t *testing.T) {
+	s := &RuleSet{}
+	add := control.PermissionUpdate{
+		Type:     "addRules",
+		Behavior: control.PermissionAllow,
+		Rules:    []control.PermissionRule{{ToolName: "Bash", RuleContent: "npm test:*"}, {ToolName: "WebSearch"}},
+	}
+	if err := s.Apply(add); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Apply(add); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Allow) != 2 || s.Allow[0].String() != "Bash(npm test:*)" {
+		t.Fatalf("unexpected allow rules: %v", s.Allow)
+	}
+
+	remove := control.PermissionUpdate{Type: "removeRules", Behavior: control.PermissionAllow, Rules: []control.PermissionRule{{ToolName: "WebSearch"}}}
+	if err := s.Apply(remove); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Allow) != 1 {
+		t.Errorf("expected 1 rule after remove, got %v", s.Allow)
+	}
+
+	if err := s.Apply(control.PermissionUpdate{Type: "setMode"}); err != nil {
+		t.Errorf("other update types should be ignored: %v", err)
+	}
+	bad := control.PermissionUpdate{Type: "addRules", Behavior: control.PermissionDeny, Rules: []control.PermissionRule{{ToolName: "WebFetch", RuleContent: "example.com"}}}
+	if err := s.Apply(bad); err == nil {
+		t.Error("expected error for invalid rule")
+	}
+}
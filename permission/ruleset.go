@@ -0,0 +1,175 @@
+package permission
+
+import (
+	"fmt"
+
+	"claudeagent/control"
+)
+
+// RuleSet holds CLI permission rules by behavior, as in the permissions
+// section of a settings file.
+type RuleSet struct {
+	Allow []CLIRule
+	Deny  []CLIRule
+	Ask   []CLIRule
+}
+
+// ParseRuleSet parses allow, deny and ask rule lists.
+func ParseRuleSet(allow, deny, ask []string) (*RuleSet, error) {
+	s := &RuleSet{}
+	lists := []struct {
+		dst *[]CLIRule
+		src []string
+	}{{&s.Allow, allow}, {&s.Deny, deny}, {&s.Ask, ask}}
+	for _, l := range lists {
+		for _, raw := range l.src {
+			r, err := ParseCLIRule(raw)
+			if err != nil {
+				return nil, err
+			}
+			*l.dst = append(*l.dst, r)
+		}
+	}
+	return s, nil
+}
+
+// Decide mirrors the CLI's evaluation order: deny rules win over ask rules,
+// which win over allow rules. For Bash, a deny or ask rule matching any
+// command of a compound line applies, while allow requires every command to
+// be allowed. ok is false when no rule applies and the CLI would fall back to
+// the permission mode.
+func (s *RuleSet) Decide(toolName string, input map[string]any, rc RuleContext) (behavior control.PermissionBehavior, rule *CLIRule, ok bool) {
+	rc = rc.withDefaults()
+	if r := s.matchAny(s.Deny, toolName, input, rc); r != nil {
+		return control.PermissionDeny, r, true
+	}
+	if r := s.matchAny(s.Ask, toolName, input, rc); r != nil {
+		return control.PermissionAsk, r, true
+	}
+	if r := s.matchAll(s.Allow, toolName, input, rc); r != nil {
+		return control.PermissionAllow, r, true
+	}
+	return "", nil, false
+}
+
+func (s *RuleSet) matchAny(rules []CLIRule, toolName string, input map[string]any, rc RuleContext) *CLIRule {
+	for _, in := range commandInputs(toolName, input, true) {
+		for i := range rules {
+			if rules[i].Match(toolName, in, rc) {
+				return &rules[i]
+			}
+		}
+	}
+	return nil
+}
+
+// matchAll returns the rule allowing the first command when every command is
+// allowed by some rule.
+func (s *RuleSet) matchAll(rules []CLIRule, toolName string, input map[string]any, rc RuleContext) *CLIRule {
+	unsafe := false
+	if cmd, ok := input["command"].(string); ok && toolName == "Bash" {
+		_, unsafe = splitCommands(cmd)
+	}
+
+	var first *CLIRule
+	for _, in := range commandInputs(toolName, input, false) {
+		var matched *CLIRule
+		for i := range rules {
+			// A prefix cannot vouch for commands hidden in a substitution,
+			// or for the files a redirection writes.
+			if unsafe && rules[i].Kind == RuleCommandPrefix {
+				continue
+			}
+			if rules[i].Match(toolName, in, rc) {
+				matched = &rules[i]
+				break
+			}
+		}
+		if matched == nil {
+			return nil
+		}
+		if first == nil {
+			first = matched
+		}
+	}
+	return first
+}
+
+// commandInputs splits a Bash call into one input per command. Other tools,
+// and unsafe lines (see splitCommands) when checking allow rules, are kept
+// whole. When lenient, the whole line is checked as well.
+func commandInputs(toolName string, input map[string]any, lenient bool) []map[string]any {
+	cmd, ok := input["command"].(string)
+	if toolName != "Bash" || !ok {
+		return []map[string]any{input}
+	}
+	cmds, unsafe := splitCommands(cmd)
+	if len(cmds) <= 1 || (unsafe && !lenient) {
+		return []map[string]any{input}
+	}
+	inputs := make([]map[string]any, 0, len(cmds)+1)
+	if lenient {
+		inputs = append(inputs, input)
+	}
+	for _, c := range cmds {
+		inputs = append(inputs, map[string]any{"command": c})
+	}
+	return inputs
+}
+
+// Apply applies an addRules, replaceRules or removeRules update, such as a
+// permission suggestion the user accepted. Other update types are ignored.
+func (s *RuleSet) Apply(u control.PermissionUpdate) error {
+	var list *[]CLIRule
+	switch u.Behavior {
+	case control.PermissionAllow:
+		list = &s.Allow
+	case control.PermissionDeny:
+		list = &s.Deny
+	case control.PermissionAsk:
+		list = &s.Ask
+	default:
+		if u.Type == "addRules" || u.Type == "replaceRules" || u.Type == "removeRules" {
+			return fmt.Errorf("permission update %s: invalid behavior %q", u.Type, u.Behavior)
+		}
+		return nil
+	}
+
+	rules := make([]CLIRule, 0, len(u.Rules))
+	for _, pr := range u.Rules {
+		r, err := FromPermissionRule(pr)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, r)
+	}
+
+	switch u.Type {
+	case "addRules":
+		for _, r := range rules {
+			if !containsRule(*list, r) {
+				*list = append(*list, r)
+			}
+		}
+	case "replaceRules":
+		*list = rules
+	case "removeRules":
+		kept := (*list)[:0]
+		for _, r := range *list {
+			if !containsRule(rules, r) {
+				kept = append(kept, r)
+			}
+		}
+		*list = kept
+	}
+	return nil
+}
+
+func containsRule(rules []CLIRule, r CLIRule) bool {
+	for _, existing := range rules {
+		if existing.String() == r.String() {
+			return true
+		}
+	}
+	return false
+}
@@ -2,7 +2,6 @@ package claudeagent
 
 import (
 	"context"
-	"fmt"
 
 	"claudeagent/internal/cli"
 	"claudeagent/internal/transport"
@@ -11,68 +10,116 @@ import (
 
 func Query(ctx context.Context, prompt string, opts ...Option) (MessageIterator, error) {
 	options := applyOptions(opts)
+	if err := validateOptions(options); err != nil {
+		return nil, err
+	}
 
 	cliPath, err := resolveCLIPath(options)
 	if err != nil {
 		return nil, err
 	}
 
+	wt, options, err := prepareWorktree(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
 	cmdOpts := buildCommandOptions(options)
-	var tOpts []transport.SubprocessOption
-	tOpts = append(tOpts, transport.WithPrompt(prompt))
-	if options.Env != nil {
-		tOpts = append(tOpts, transport.WithEnv(options.Env))
+	if err := applyLandlock(cmdOpts, options, cliPath); err != nil {
+		_ = wt.finish()
+		return nil, err
 	}
-	if options.Stderr != nil {
-		tOpts = append(tOpts, transport.WithStderrCallback(options.Stderr))
+
+	configDir, err := prepareQueryConfigDir(options)
+	if err != nil {
+		_ = wt.finish()
+		return nil, err
 	}
+
+	tOpts := append(buildTransportOptions(options, configDir), transport.WithPrompt(prompt))
 	t := transport.NewSubprocessTransport(cliPath, cmdOpts, tOpts...)
 
 	if options.CanUseTool != nil {
 		t.Control().SetCanUseTool(options.CanUseTool)
 	}
+	if options.CallbackTimeout > 0 {
+		t.Control().SetCallbackTimeout(options.CallbackTimeout)
+	}
 	if options.Hooks != nil {
 		t.Control().SetHooks(options.Hooks)
 	}
 
+	// The prompt is sent as soon as the process starts.
+	snapshots := newTurnSnapshots(options)
+	snapshots.begin()
+	wt.begin()
+
 	if err := t.Connect(ctx); err != nil {
-		return nil, fmt.Errorf("failed to connect: %w", err)
+		_ = configDir.cleanup()
+		_ = wt.finish()
+		return nil, newConnectionError("failed to connect", t.RedactError(err), t.StderrTail())
 	}
 
 	msgChan, errChan := t.ReceiveMessages(ctx)
-
-	return newChannelIterator(msgChan, errChan, t.Close), nil
+	done := make(chan struct{})
+	return newChannelIterator(wt.wrap(done, snapshots.wrap(done, msgChan)), errChan, closeQuery(t, configDir, wt, done)), nil
 }
 
 func QueryWithInput(ctx context.Context, input <-chan message.UserMessage, opts ...Option) (MessageIterator, error) {
 	options := applyOptions(opts)
+	if err := validateOptions(options); err != nil {
+		return nil, err
+	}
 
 	cliPath, err := resolveCLIPath(options)
 	if err != nil {
 		return nil, err
 	}
 
+	wt, options, err := prepareWorktree(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
 	cmdOpts := buildCommandOptions(options)
-	var tOpts []transport.SubprocessOption
-	if options.Env != nil {
-		tOpts = append(tOpts, transport.WithEnv(options.Env))
+	if err := applyLandlock(cmdOpts, options, cliPath); err != nil {
+		_ = wt.finish()
+		return nil, err
 	}
-	if options.Stderr != nil {
-		tOpts = append(tOpts, transport.WithStderrCallback(options.Stderr))
+
+	configDir, err := prepareQueryConfigDir(options)
+	if err != nil {
+		_ = wt.finish()
+		return nil, err
 	}
-	t := transport.NewSubprocessTransport(cliPath, cmdOpts, tOpts...)
+
+	t := transport.NewSubprocessTransport(cliPath, cmdOpts, buildTransportOptions(options, configDir)...)
 
 	if options.CanUseTool != nil {
 		t.Control().SetCanUseTool(options.CanUseTool)
 	}
+	if options.CallbackTimeout > 0 {
+		t.Control().SetCallbackTimeout(options.CallbackTimeout)
+	}
 	if options.Hooks != nil {
 		t.Control().SetHooks(options.Hooks)
 	}
 
 	if err := t.Connect(ctx); err != nil {
-		return nil, fmt.Errorf("failed to connect: %w", err)
+		_ = configDir.cleanup()
+		_ = wt.finish()
+		return nil, newConnectionError("failed to connect", t.RedactError(err), t.StderrTail())
 	}
 
+	// Hooks only reach the CLI through the initialize request.
+	if hooks := t.Control().HookMatchers(); len(hooks) > 0 {
+		if _, err := t.Control().Initialize(ctx, hooks, nil, nil, nil, nil, nil); err != nil {
+			_ = closeQuery(t, configDir, wt, nil)()
+			return nil, newConnectionError("failed to initialize", t.RedactError(err), t.StderrTail())
+		}
+	}
+
+	snapshots := newTurnSnapshots(options)
 	go func() {
 		for msg := range input {
 			streamMsg := transport.StreamMessage{
@@ -83,6 +130,8 @@ func QueryWithInput(ctx context.Context, input <-chan message.UserMessage, opts
 				},
 				SessionID: msg.SessionID,
 			}
+			snapshots.begin()
+			wt.begin()
 			if err := t.SendMessage(ctx, streamMsg); err != nil {
 				break
 			}
@@ -90,7 +139,33 @@ func QueryWithInput(ctx context.Context, input <-chan message.UserMessage, opts
 	}()
 
 	msgChan, errChan := t.ReceiveMessages(ctx)
-	return newChannelIterator(msgChan, errChan, t.Close), nil
+	done := make(chan struct{})
+	return newChannelIterator(wt.wrap(done, snapshots.wrap(done, msgChan)), errChan, closeQuery(t, configDir, wt, done)), nil
+}
+
+func prepareQueryConfigDir(options *Options) (*preparedConfigDir, error) {
+	if options.ConfigDir == nil {
+		return nil, nil
+	}
+	return prepareConfigDir(options.ConfigDir)
+}
+
+// closeQuery returns the iterator's close function. Closing done stops the
+// goroutines forwarding messages to the iterator.
+func closeQuery(t *transport.SubprocessTransport, configDir *preparedConfigDir, wt *sessionWorktree, done chan struct{}) func() error {
+	return func() error {
+		if done != nil {
+			close(done)
+		}
+		err := t.Close()
+		if cleanupErr := configDir.cleanup(); err == nil {
+			err = cleanupErr
+		}
+		if cleanupErr := wt.finish(); err == nil {
+			err = cleanupErr
+		}
+		return err
+	}
 }
 
 func resolveCLIPath(options *Options) (string, error) {
@@ -100,6 +175,36 @@ func resolveCLIPath(options *Options) (string, error) {
 	return cli.FindCLI()
 }
 
+func buildTransportOptions(options *Options, configDir *preparedConfigDir) []transport.SubprocessOption {
+	var extraEnv map[string]string
+	if configDir != nil {
+		extraEnv = configDir.env
+	}
+
+	var tOpts []transport.SubprocessOption
+	if env := buildEnv(options, extraEnv); env != nil {
+		tOpts = append(tOpts, transport.WithEnv(env))
+	}
+	if mode, _ := envModeToTransport(options.EnvMode); mode != transport.EnvInherit {
+		tOpts = append(tOpts, transport.WithEnvMode(mode, options.EnvAllowlist))
+	}
+	if options.Stderr != nil {
+		tOpts = append(tOpts, transport.WithStderrCallback(options.Stderr))
+	}
+	if options.StderrBufferSize > 0 {
+		tOpts = append(tOpts, transport.WithStderrBufferSize(options.StderrBufferSize))
+	}
+	if options.StallTimeout > 0 {
+		var onStall func(transport.StallEvent)
+		if options.OnStall != nil {
+			fn := options.OnStall
+			onStall = func(e transport.StallEvent) { fn(stallEventFromTransport(e)) }
+		}
+		tOpts = append(tOpts, transport.WithStallWatchdog(options.StallTimeout, stallActionToTransport(options.StallAction), onStall))
+	}
+	return tOpts
+}
+
 func buildCommandOptions(options *Options) *cli.CommandOptions {
 	cmdOpts := &cli.CommandOptions{
 		AllowedTools:                    options.AllowedTools,
@@ -0,0 +1,203 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// Landlock syscall numbers are shared by all architectures.
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+)
+
+const (
+	landlockCreateRulesetVersion = 1 << 0
+	landlockRulePathBeneath      = 1
+	prSetNoNewPrivs              = 38
+
+	// oPath is O_PATH on every architecture Go supports except sparc64.
+	oPath = 0o10000000
+)
+
+const (
+	accessExecute    = 1 << 0
+	accessWriteFile  = 1 << 1
+	accessReadFile   = 1 << 2
+	accessReadDir    = 1 << 3
+	accessRemoveDir  = 1 << 4
+	accessRemoveFile = 1 << 5
+	accessMakeChar   = 1 << 6
+	accessMakeDir    = 1 << 7
+	accessMakeReg    = 1 << 8
+	accessMakeSock   = 1 << 9
+	accessMakeFifo   = 1 << 10
+	accessMakeBlock  = 1 << 11
+	accessMakeSym    = 1 << 12
+	accessRefer      = 1 << 13 // ABI 2
+	accessTruncate   = 1 << 14 // ABI 3
+	accessIoctlDev   = 1 << 15 // ABI 5
+
+	accessReadOnly = accessExecute | accessReadFile | accessReadDir
+	// accessFile holds the rights that apply to regular files rather than
+	// directories; rules on files may not use any others.
+	accessFile = accessExecute | accessWriteFile | accessReadFile | accessTruncate | accessIoctlDev
+)
+
+type rulesetAttr struct {
+	handledAccessFS uint64
+}
+
+// pathBeneathAttr mirrors the packed kernel struct; only its first 12 bytes
+// are read.
+type pathBeneathAttr struct {
+	allowedAccess uint64
+	parentFd      int32
+}
+
+var defaultReadOnly = []string{
+	"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32",
+	"/etc", "/opt", "/proc", "/sys", "/run", "/nix/store",
+}
+
+var defaultReadWrite = []string{"/dev", "/tmp", "/var/tmp"}
+
+// ABI returns the Landlock ABI version of the running kernel.
+func ABI() (int, error) {
+	v, _, errno := syscall.Syscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	switch errno {
+	case 0:
+		return int(v), nil
+	case syscall.ENOSYS:
+		return 0, fmt.Errorf("%w: kernel does not implement Landlock (Linux 5.13 or later is required)", ErrUnsupported)
+	case syscall.EOPNOTSUPP:
+		return 0, fmt.Errorf("%w: Landlock is disabled; enable it with the lsm= boot parameter", ErrUnsupported)
+	default:
+		return 0, fmt.Errorf("%w: %v", ErrUnsupported, errno)
+	}
+}
+
+func handledAccess(abi int) uint64 {
+	access := uint64(accessExecute | accessWriteFile | accessReadFile | accessReadDir |
+		accessRemoveDir | accessRemoveFile | accessMakeChar | accessMakeDir |
+		accessMakeReg | accessMakeSock | accessMakeFifo | accessMakeBlock | accessMakeSym)
+	if abi >= 2 {
+		access |= accessRefer
+	}
+	if abi >= 3 {
+		access |= accessTruncate
+	}
+	if abi >= 5 {
+		access |= accessIoctlDev
+	}
+	return access
+}
+
+// rules returns the paths to allow, with defaults that depend on the
+// environment the CLI will run with.
+func rules(cfg Config, command string) (readOnly, readWrite []string) {
+	readOnly = append(readOnly, cfg.ReadOnly...)
+	readWrite = append(readWrite, cfg.ReadWrite...)
+
+	if path, err := exec.LookPath(command); err == nil {
+		readOnly = append(readOnly, withSymlinkTarget(path)...)
+	}
+
+	if cfg.NoDefaults {
+		return readOnly, readWrite
+	}
+	readOnly = append(readOnly, defaultReadOnly...)
+	readWrite = append(readWrite, defaultReadWrite...)
+	if dir := os.Getenv("TMPDIR"); dir != "" {
+		readWrite = append(readWrite, dir)
+	}
+	if dir := os.Getenv("CLAUDE_CONFIG_DIR"); dir != "" {
+		readWrite = append(readWrite, dir)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		readWrite = append(readWrite, filepath.Join(home, ".claude"), filepath.Join(home, ".claude.json"))
+	}
+	return readOnly, readWrite
+}
+
+// withSymlinkTarget returns the directory of path, and of its target if it is
+// a symlink, so that launchers such as ~/.local/bin/claude keep working.
+func withSymlinkTarget(path string) []string {
+	dirs := []string{filepath.Dir(path)}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil && resolved != path {
+		dirs = append(dirs, filepath.Dir(resolved))
+	}
+	return dirs
+}
+
+// restrict confines the calling thread and everything it execs. The caller
+// must hold its OS thread locked until exec.
+func restrict(cfg Config, command string) error {
+	abi, err := ABI()
+	if err != nil {
+		return err
+	}
+	handled := handledAccess(abi)
+
+	attr := rulesetAttr{handledAccessFS: handled}
+	fd, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("create landlock ruleset: %w", errno)
+	}
+	ruleset := int(fd)
+	defer syscall.Close(ruleset)
+
+	readOnly, readWrite := rules(cfg, command)
+	for _, path := range readOnly {
+		if err := addPathRule(ruleset, path, accessReadOnly&handled); err != nil {
+			return err
+		}
+	}
+	for _, path := range readWrite {
+		if err := addPathRule(ruleset, path, handled); err != nil {
+			return err
+		}
+	}
+
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+		return fmt.Errorf("set no_new_privs: %w", errno)
+	}
+	if _, _, errno := syscall.RawSyscall(sysLandlockRestrictSelf, uintptr(ruleset), 0, 0); errno != 0 {
+		return fmt.Errorf("restrict self: %w", errno)
+	}
+	return nil
+}
+
+// addPathRule allows access beneath path. Paths that do not exist are skipped,
+// so defaults can name directories that only some distributions have.
+func addPathRule(ruleset int, path string, access uint64) error {
+	fd, err := syscall.Open(path, oPath|syscall.O_CLOEXEC, 0)
+	if errors.Is(err, syscall.ENOENT) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer syscall.Close(fd)
+
+	var st syscall.Stat_t
+	if err := syscall.Fstat(fd, &st); err != nil {
+		return fmt.Errorf("stat %s: %w", path, err)
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+		access &= accessFile
+	}
+
+	attr := pathBeneathAttr{allowedAccess: access, parentFd: int32(fd)}
+	if _, _, errno := syscall.Syscall6(sysLandlockAddRule, uintptr(ruleset), landlockRulePathBeneath,
+		uintptr(unsafe.Pointer(&attr)), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("add landlock rule for %s: %w", path, errno)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Package sandbox confines the Claude CLI process with Linux Landlock rules
+// and resource limits, independently of the CLI's own sandbox settings.
+//
+// Confinement is applied by a small wrapper: the SDK re-executes the current
+// binary with a marker argument, the wrapper applies rlimits and Landlock
+// rules to itself and then execs the CLI, which inherits them along with every
+// tool and MCP server it starts. The wrapper runs from this package's init, so
+// any binary that links the SDK can act as its own wrapper.
+package sandbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// wrapperArg marks an invocation of the current binary as the sandbox wrapper.
+const wrapperArg = "__claude_sdk_sandbox__"
+
+// ErrUnsupported is returned when the running kernel cannot enforce Landlock
+// rules. The wrapped error explains why.
+var ErrUnsupported = errors.New("landlock is not supported")
+
+// Config describes the filesystem access and resource limits of the CLI.
+type Config struct {
+	// ReadOnly paths may be read and executed.
+	ReadOnly []string `json:"readOnly,omitempty"`
+	// ReadWrite paths may be read, executed, written, created and removed.
+	ReadWrite []string `json:"readWrite,omitempty"`
+	// NoDefaults drops the built-in rules: read-only system directories
+	// (/usr, /etc, /proc, ...), read-write /dev and temp directories, and the
+	// CLI config directory. Only ReadOnly and ReadWrite then apply.
+	NoDefaults bool `json:"noDefaults,omitempty"`
+	// Limits are applied before Landlock, whether or not it is available.
+	Limits Limits `json:"limits,omitempty"`
+	// BestEffort starts the CLI without Landlock when the kernel does not
+	// support it, instead of failing.
+	BestEffort bool `json:"bestEffort,omitempty"`
+}
+
+// Limits are resource limits for the CLI and its children. Zero leaves a
+// limit unchanged; values above the current hard limit are capped to it.
+type Limits struct {
+	// CPUTime limits CPU time per process, rounded up to whole seconds.
+	CPUTime time.Duration `json:"cpuTime,omitempty"`
+	// Memory limits the address space per process, in bytes. Node reserves
+	// a lot of virtual memory up front, so keep this generous.
+	Memory uint64 `json:"memory,omitempty"`
+	// OpenFiles limits open file descriptors per process.
+	OpenFiles uint64 `json:"openFiles,omitempty"`
+	// Processes limits processes of the user, including ones outside the sandbox.
+	Processes uint64 `json:"processes,omitempty"`
+}
+
+// Check reports whether cfg can be enforced on this host. It only fails when
+// Landlock is unavailable and BestEffort is not set.
+func Check(cfg Config) error {
+	if _, err := ABI(); err != nil && !cfg.BestEffort {
+		return err
+	}
+	return nil
+}
+
+// WrapperArgs returns the executable and leading arguments that run a command
+// under cfg. The command and its arguments are appended by the caller.
+func WrapperArgs(cfg Config) (string, []string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return "", nil, fmt.Errorf("sandbox: locate wrapper executable: %w", err)
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return "", nil, fmt.Errorf("sandbox: encode config: %w", err)
+	}
+	return self, []string{wrapperArg, string(data), "--"}, nil
+}
+
+// parseWrapperArgs splits the arguments following wrapperArg into the config
+// and the command to exec.
+func parseWrapperArgs(args []string) (Config, []string, error) {
+	var cfg Config
+	if len(args) < 3 || args[1] != "--" {
+		return cfg, nil, errors.New("usage: " + wrapperArg + " <config> -- <command> [args...]")
+	}
+	if err := json.Unmarshal([]byte(args[0]), &cfg); err != nil {
+		return cfg, nil, fmt.Errorf("decode config: %w", err)
+	}
+	return cfg, args[2:], nil
+}
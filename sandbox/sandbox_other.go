@@ -0,0 +1,16 @@
+//go:build !linux
+
+package sandbox
+
+import "fmt"
+
+// HasWrapper reports whether binaries on this platform handle WrapperArgs.
+// Elsewhere than Linux they do not, and a wrapped command would run the
+// host program again.
+const HasWrapper = false
+
+// ABI returns the Landlock ABI version of the running kernel. Landlock is
+// Linux-only.
+func ABI() (int, error) {
+	return 0, fmt.Errorf("%w: Landlock is only available on Linux", ErrUnsupported)
+}
@@ -0,0 +1,112 @@
+package sandbox
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrapperArgs_RoundTrip(t *testing.T) {
+	cfg := Config{
+		ReadOnly:  []string{"/opt/tools"},
+		ReadWrite: []string{"/work"},
+		Limits:    Limits{CPUTime: time.Minute, OpenFiles: 256},
+	}
+	_, args, err := WrapperArgs(cfg)
+	if err != nil {
+		t.Fatalf("WrapperArgs failed: %v", err)
+	}
+	if args[0] != wrapperArg || args[len(args)-1] != "--" {
+		t.Fatalf("unexpected wrapper args: %v", args)
+	}
+
+	got, command, err := parseWrapperArgs(append(args[1:], "claude", "--print"))
+	if err != nil {
+		t.Fatalf("parseWrapperArgs failed: %v", err)
+	}
+	if got.ReadWrite[0] != "/work" || got.Limits.CPUTime != time.Minute || got.Limits.OpenFiles != 256 {
+		t.Errorf("config not preserved: %+v", got)
+	}
+	if len(command) != 2 || command[0] != "claude" {
+		t.Errorf("command = %v", command)
+	}
+}
+
+func TestParseWrapperArgs_Invalid(t *testing.T) {
+	tests := [][]string{
+		nil,
+		{"{}", "--"},
+		{"{}", "claude"},
+		{"not json", "--", "claude"},
+	}
+	for _, args := range tests {
+		if _, _, err := parseWrapperArgs(args); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+}
+
+func TestWrapper_Confines(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Landlock is Linux-only")
+	}
+	if _, err := ABI(); err != nil {
+		t.Skipf("Landlock unavailable: %v", err)
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not found")
+	}
+
+	allowed := t.TempDir()
+	denied := t.TempDir()
+	cfg := Config{
+		NoDefaults: true,
+		ReadOnly:   []string{"/usr", "/bin", "/lib", "/lib64", "/etc"},
+		ReadWrite:  []string{allowed},
+		Limits:     Limits{OpenFiles: 64},
+	}
+
+	wrapper, args, err := WrapperArgs(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := `echo ok > "$1/file" || exit 10
+echo no > "$2/file" 2>/dev/null && exit 11
+[ "$(ulimit -n)" = 64 ] || exit 12`
+	args = append(args, sh, "-c", script, "sh", allowed, denied)
+
+	out, err := exec.Command(wrapper, args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("wrapped command failed: %v\n%s", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(allowed, "file")); err != nil {
+		t.Errorf("write to allowed dir missing: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(denied, "file")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("write to denied dir was not blocked: %v", err)
+	}
+}
+
+func TestWrapper_ReportsMissingCommand(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("wrapper is Linux-only")
+	}
+	wrapper, args, err := WrapperArgs(Config{BestEffort: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(wrapper, append(args, "definitely-not-a-command")...).CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 126 {
+		t.Fatalf("expected exit code 126, got %v", err)
+	}
+	if !strings.Contains(string(out), "claude sdk sandbox:") {
+		t.Errorf("expected sandbox error on stderr, got %q", out)
+	}
+}
@@ -0,0 +1,88 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// rlimitNproc is RLIMIT_NPROC, which package syscall does not define. It is
+// 6 on every architecture except mips and sparc.
+const rlimitNproc = 6
+
+// HasWrapper reports whether binaries on this platform handle WrapperArgs.
+const HasWrapper = true
+
+// The wrapper takes over before main when the binary is invoked by WrapperArgs.
+func init() {
+	if len(os.Args) > 1 && os.Args[1] == wrapperArg {
+		os.Exit(runWrapper(os.Args[2:]))
+	}
+}
+
+// runWrapper only returns on failure; on success the process becomes the command.
+func runWrapper(args []string) int {
+	// Landlock and no_new_privs apply to the calling thread, which must be
+	// the one that execs.
+	runtime.LockOSThread()
+
+	if err := confineAndExec(args); err != nil {
+		fmt.Fprintf(os.Stderr, "claude sdk sandbox: %v\n", err)
+		return 126
+	}
+	return 0
+}
+
+func confineAndExec(args []string) error {
+	cfg, command, err := parseWrapperArgs(args)
+	if err != nil {
+		return err
+	}
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		return err
+	}
+
+	if err := setLimits(cfg.Limits); err != nil {
+		return err
+	}
+	if err := restrict(cfg, command[0]); err != nil {
+		if !cfg.BestEffort || !errors.Is(err, ErrUnsupported) {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "claude sdk sandbox: running without filesystem confinement: %v\n", err)
+	}
+
+	return syscall.Exec(path, command, os.Environ())
+}
+
+func setLimits(l Limits) error {
+	limits := []struct {
+		name     string
+		resource int
+		value    uint64
+	}{
+		{"cpu time", syscall.RLIMIT_CPU, uint64((l.CPUTime + 999_999_999) / 1_000_000_000)},
+		{"memory", syscall.RLIMIT_AS, l.Memory},
+		{"open files", syscall.RLIMIT_NOFILE, l.OpenFiles},
+		{"processes", rlimitNproc, l.Processes},
+	}
+	for _, limit := range limits {
+		if limit.value == 0 {
+			continue
+		}
+		var rl syscall.Rlimit
+		if err := syscall.Getrlimit(limit.resource, &rl); err != nil {
+			return fmt.Errorf("get %s limit: %w", limit.name, err)
+		}
+		value := min(limit.value, rl.Max)
+		rl.Cur, rl.Max = value, value
+		if err := syscall.Setrlimit(limit.resource, &rl); err != nil {
+			return fmt.Errorf("set %s limit: %w", limit.name, err)
+		}
+	}
+	return nil
+}
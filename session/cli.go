@@ -21,7 +21,12 @@ type Info struct {
 	SizeBytes int64
 }
 
+// CLIDir returns the CLI configuration directory: CLAUDE_CONFIG_DIR when set,
+// otherwise ~/.claude.
 func CLIDir() (string, error) {
+	if dir := os.Getenv("CLAUDE_CONFIG_DIR"); dir != "" {
+		return dir, nil
+	}
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", fmt.Errorf("get home dir: %w", err)
@@ -29,12 +34,27 @@ func CLIDir() (string, error) {
 	return filepath.Join(home, ".claude"), nil
 }
 
+// CLIDirIn returns the CLI configuration directory for a config root such as
+// ConfigDir.Path in the root package: the root itself when it is used as
+// CLAUDE_CONFIG_DIR, or its .claude directory when it replaces HOME.
+func CLIDirIn(root string, overrideHome bool) string {
+	if overrideHome {
+		return filepath.Join(root, ".claude")
+	}
+	return root
+}
+
 func ProjectDir(workingDir string) (string, error) {
 	cliDir, err := CLIDir()
 	if err != nil {
 		return "", err
 	}
+	return ProjectDirIn(cliDir, workingDir)
+}
 
+// ProjectDirIn is like ProjectDir but looks in the given CLI configuration
+// directory, such as one created for a client with an isolated config dir.
+func ProjectDirIn(cliDir, workingDir string) (string, error) {
 	absPath, err := filepath.Abs(workingDir)
 	if err != nil {
 		return "", fmt.Errorf("get absolute path: %w", err)
@@ -89,6 +109,16 @@ func ListSessions(projectDir string) ([]Info, error) {
 	return sessions, nil
 }
 
+// ListSessionsIn lists the sessions of workingDir in the CLI configuration
+// directory cliDir, such as the one returned by Client.ConfigDir.
+func ListSessionsIn(cliDir, workingDir string) ([]Info, error) {
+	projectDir, err := ProjectDirIn(cliDir, workingDir)
+	if err != nil {
+		return nil, err
+	}
+	return ListSessions(projectDir)
+}
+
 func Load(sessionPath string) ([]message.Message, error) {
 	f, err := os.Open(sessionPath)
 	if err != nil {
@@ -127,6 +157,16 @@ func LoadByID(projectDir, sessionID string) ([]message.Message, error) {
 	return Load(sessionPath)
 }
 
+// LoadByIDIn loads a session of workingDir from the CLI configuration
+// directory cliDir.
+func LoadByIDIn(cliDir, workingDir, sessionID string) ([]message.Message, error) {
+	projectDir, err := ProjectDirIn(cliDir, workingDir)
+	if err != nil {
+		return nil, err
+	}
+	return LoadByID(projectDir, sessionID)
+}
+
 type sessionEntry struct {
 	Type    string          `json:"type"`
 	Message json.RawMessage `json:"message"`
@@ -223,7 +263,10 @@ func parseSessionLine(line []byte) (message.Message, error) {
 				Role    string `json:"role"`
 				Content any    `json:"content"`
 			} `json:"message"`
-			UUID string `json:"uuid"`
+			// Transcripts store the structured tool result in camel case.
+			ToolUseResult any    `json:"toolUseResult"`
+			UUID          string `json:"uuid"`
+			SessionID     string `json:"sessionId"`
 		}
 		if err := json.Unmarshal(line, &msg); err != nil {
 			return nil, err
@@ -234,13 +277,16 @@ func parseSessionLine(line []byte) (message.Message, error) {
 				Role:    msg.Message.Role,
 				Content: msg.Message.Content,
 			},
-			UUID: msg.UUID,
+			ToolUseResult: msg.ToolUseResult,
+			UUID:          msg.UUID,
+			SessionID:     msg.SessionID,
 		}, nil
 
 	case "assistant":
 		var msg struct {
-			Message json.RawMessage `json:"message"`
-			UUID    string          `json:"uuid"`
+			Message   json.RawMessage `json:"message"`
+			UUID      string          `json:"uuid"`
+			SessionID string          `json:"sessionId"`
 		}
 		if err := json.Unmarshal(line, &msg); err != nil {
 			return nil, err
@@ -252,9 +298,10 @@ func parseSessionLine(line []byte) (message.Message, error) {
 		}
 
 		return &message.AssistantMessage{
-			Type:    "assistant",
-			Message: apiMsg,
-			UUID:    msg.UUID,
+			Type:      "assistant",
+			Message:   apiMsg,
+			UUID:      msg.UUID,
+			SessionID: msg.SessionID,
 		}, nil
 
 	case "result":
@@ -3,6 +3,7 @@ package session
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"claudeagent/message"
@@ -54,6 +55,28 @@ func TestLoad(t *testing.T) {
 	}
 }
 
+func TestLoad_ToolUseResult(t *testing.T) {
+	sessionFile := filepath.Join(t.TempDir(), "tools.jsonl")
+	content := `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"ok"}]},"toolUseResult":{"filePath":"/a.go","originalFile":"old"},"uuid":"u1","sessionId":"s1"}
+`
+	if err := os.WriteFile(sessionFile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := Load(sessionFile)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("Load = %d messages, %v", len(msgs), err)
+	}
+	msg := msgs[0].(*message.UserMessage)
+	result, ok := msg.ToolUseResult.(map[string]any)
+	if !ok || result["originalFile"] != "old" {
+		t.Errorf("unexpected tool use result: %#v", msg.ToolUseResult)
+	}
+	if msg.SessionID != "s1" {
+		t.Errorf("SessionID = %q", msg.SessionID)
+	}
+}
+
 func TestListSessions(t *testing.T) {
 	dir := t.TempDir()
 
@@ -133,3 +156,58 @@ func TestLoadNonexistentFile(t *testing.T) {
 		t.Error("Expected error for nonexistent file")
 	}
 }
+
+func TestProjectDirIn(t *testing.T) {
+	cliDir := t.TempDir()
+	workDir := t.TempDir()
+
+	if _, err := ProjectDirIn(cliDir, workDir); err == nil {
+		t.Fatal("expected error for missing project dir")
+	}
+
+	want := filepath.Join(cliDir, "projects", strings.ReplaceAll(workDir, string(filepath.Separator), "-"))
+	if err := os.MkdirAll(want, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ProjectDirIn(cliDir, workDir)
+	if err != nil {
+		t.Fatalf("ProjectDirIn failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("ProjectDirIn = %q, want %q", got, want)
+	}
+}
+
+func TestCLIDir_ConfigDirEnv(t *testing.T) {
+	t.Setenv("CLAUDE_CONFIG_DIR", "/tmp/isolated")
+	dir, err := CLIDir()
+	if err != nil || dir != "/tmp/isolated" {
+		t.Errorf("CLIDir = %q, %v", dir, err)
+	}
+}
+
+func TestSessionsIn(t *testing.T) {
+	root, workDir := t.TempDir(), t.TempDir()
+	cliDir := CLIDirIn(root, true)
+	if cliDir != filepath.Join(root, ".claude") || CLIDirIn(root, false) != root {
+		t.Fatalf("unexpected CLI dirs for %s", root)
+	}
+
+	projectDir := filepath.Join(cliDir, "projects", strings.ReplaceAll(workDir, string(filepath.Separator), "-"))
+	if err := os.MkdirAll(projectDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	line := `{"type":"user","message":{"role":"user","content":"hi"},"uuid":"u1","sessionId":"s1"}` + "\n"
+	if err := os.WriteFile(filepath.Join(projectDir, "s1.jsonl"), []byte(line), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := ListSessionsIn(cliDir, workDir)
+	if err != nil || len(sessions) != 1 || sessions[0].ID != "s1" {
+		t.Fatalf("ListSessionsIn = %+v, %v", sessions, err)
+	}
+	msgs, err := LoadByIDIn(cliDir, workDir, "s1")
+	if err != nil || len(msgs) != 1 || msgs[0].GetUUID() != "u1" {
+		t.Errorf("LoadByIDIn = %+v, %v", msgs, err)
+	}
+}
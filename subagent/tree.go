@@ -0,0 +1,463 @@
+// Package subagent builds the tree of conversations in a session.
+//
+// Messages of subagents started with the Task tool arrive interleaved with
+// the main thread, tagged only with the ID of the Task call that started
+// them. A Tree sorts them into one Node per conversation: the root for the
+// main thread, with a child for every Task call, and so on for subagents that
+// start subagents of their own:
+//
+//	tree := subagent.NewTree()
+//	client, err := claudeagent.NewClient(
+//	    claudeagent.WithHooks(claudeagent.HookSubagentStart, tree.Matcher()),
+//	)
+//	...
+//	for msg := range client.Messages(ctx) {
+//	    tree.Observe(msg)
+//	}
+//	tree.Walk(func(n subagent.Node, depth int) bool {
+//	    fmt.Printf("%*s%s: %s\n", 2*depth, "", n.AgentType, n.Status)
+//	    return true
+//	})
+package subagent
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"claudeagent/control"
+	"claudeagent/message"
+	"claudeagent/tools"
+)
+
+// RootID is the ID of the main thread's node.
+const RootID = ""
+
+// Status is the state of a conversation.
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+// Node is a copy of one conversation in the tree.
+type Node struct {
+	// ID is the tool use ID of the Task call that started the subagent, or
+	// RootID for the main thread.
+	ID       string
+	ParentID string
+	// Children are the IDs of the subagents started by this conversation, in
+	// order.
+	Children []string
+
+	// AgentType is the subagent type requested by the Task call and
+	// confirmed by the SubagentStart hook.
+	AgentType string
+	// AgentID is reported by the SubagentStart hook and the Task result.
+	AgentID     string
+	Description string
+	Prompt      string
+	Model       string
+
+	Status   Status
+	Started  time.Time
+	Finished time.Time
+	Messages []message.Message
+	// Usage sums the token usage of the conversation's API responses.
+	Usage message.Usage
+	// CostUSD is only known for the root, from the session's result
+	// messages; the CLI does not report the cost of subagents.
+	CostUSD float64
+	// Result is the final text of the conversation.
+	Result string
+}
+
+func (n *Node) clone() Node {
+	c := *n
+	c.Children = append([]string(nil), n.Children...)
+	c.Messages = append([]message.Message(nil), n.Messages...)
+	return c
+}
+
+// Event reports a change to a node.
+type Event struct {
+	Node Node
+	// Message is the message added to the node, or nil if only the node's
+	// state changed.
+	Message message.Message
+}
+
+type node struct {
+	Node
+	// responses are the API message IDs counted in Usage; the CLI sends one
+	// assistant message per content block of a response.
+	responses map[string]bool
+}
+
+// Tree is a live tree of the conversations in a session. Feed it every
+// message with Observe.
+type Tree struct {
+	mu        sync.Mutex
+	nodes     map[string]*node
+	listeners map[int]listener
+	nextID    int
+}
+
+type listener struct {
+	all    bool
+	nodeID string
+	fn     func(Event)
+}
+
+// NewTree creates a tree holding only the root.
+func NewTree() *Tree {
+	t := &Tree{
+		nodes:     make(map[string]*node),
+		listeners: make(map[int]listener),
+	}
+	t.nodes[RootID] = &node{
+		Node:      Node{ID: RootID, Status: StatusRunning, Started: time.Now()},
+		responses: make(map[string]bool),
+	}
+	return t
+}
+
+// Subscribe registers fn to be called for every change to the node with the
+// given ID, which need not exist yet. fn is called on the goroutine calling
+// Observe. The returned function unregisters it.
+func (t *Tree) Subscribe(id string, fn func(Event)) (unsubscribe func()) {
+	return t.subscribe(listener{nodeID: id, fn: fn})
+}
+
+// OnChange registers fn to be called for every change to any node.
+func (t *Tree) OnChange(fn func(Event)) (unsubscribe func()) {
+	return t.subscribe(listener{all: true, fn: fn})
+}
+
+func (t *Tree) subscribe(l listener) func() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := t.nextID
+	t.nextID++
+	t.listeners[id] = l
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.listeners, id)
+	}
+}
+
+// Matcher returns a SubagentStart hook to register with WithHooks. It
+// records the agent ID and type the CLI reports for each subagent.
+func (t *Tree) Matcher() control.HookCallbackMatcher {
+	return control.HookCallbackMatcher{Hooks: []control.HookCallback{t.subagentStart}}
+}
+
+func (t *Tree) subagentStart(_ context.Context, input control.HookInput, toolUseID *string) (control.HookOutput, error) {
+	start, ok := input.(*control.SubagentStartHookInput)
+	if !ok {
+		return control.HookOutput{}, nil
+	}
+	t.mu.Lock()
+	n := t.startedNode(toolUseID)
+	var events []Event
+	if n != nil {
+		n.AgentID = start.AgentID
+		if start.AgentType != "" {
+			n.AgentType = start.AgentType
+		}
+		events = []Event{{Node: n.clone()}}
+	}
+	listeners := t.listenersLocked()
+	t.mu.Unlock()
+
+	notify(listeners, events)
+	return control.HookOutput{}, nil
+}
+
+// startedNode finds the node a SubagentStart hook belongs to: the one named
+// by the hook's tool use ID, or else the oldest running subagent that has
+// not been started yet.
+func (t *Tree) startedNode(toolUseID *string) *node {
+	if toolUseID != nil {
+		if n := t.nodes[*toolUseID]; n != nil {
+			return n
+		}
+	}
+	var oldest *node
+	for _, n := range t.nodes {
+		if n.ID == RootID || n.AgentID != "" || n.Status != StatusRunning {
+			continue
+		}
+		if oldest == nil || n.Started.Before(oldest.Started) {
+			oldest = n
+		}
+	}
+	return oldest
+}
+
+// Observe adds a message to the conversation it belongs to and updates the
+// tree.
+func (t *Tree) Observe(msg message.Message) {
+	now := time.Now()
+	t.mu.Lock()
+	n := t.node(parentToolUseID(msg), now)
+	n.Messages = append(n.Messages, msg)
+	events := []Event{{Message: msg}}
+	var changed []*node
+
+	switch msg := msg.(type) {
+	case *message.SystemMessage:
+		if msg.Subtype == "init" && msg.Model != "" {
+			n.Model = msg.Model
+		}
+	case *message.AssistantMessage:
+		if n.ID == RootID && n.Status != StatusRunning {
+			// A new turn of the main thread.
+			n.Status = StatusRunning
+			n.Finished = time.Time{}
+		}
+		if n.Model == "" {
+			n.Model = msg.Message.Model
+		}
+		n.addUsage(msg.Message.ID, msg.Message.Usage)
+		changed = t.started(n, msg, now)
+	case *message.UserMessage:
+		changed = t.finished(msg, now)
+	case *message.ResultMessage:
+		n.CostUSD = msg.TotalCostUSD
+		n.Result = msg.Result
+		n.Finished = now
+		n.Status = StatusCompleted
+		if msg.IsError {
+			n.Status = StatusFailed
+		}
+		changed = t.denied(msg.PermissionDenials, now)
+	}
+
+	events[0].Node = n.clone()
+	for _, c := range changed {
+		events = append(events, Event{Node: c.clone()})
+	}
+	listeners := t.listenersLocked()
+	t.mu.Unlock()
+
+	notify(listeners, events)
+}
+
+// node returns the node for a parent tool use ID, creating it if the Task
+// call that started it was not seen.
+func (t *Tree) node(id *string, now time.Time) *node {
+	if id == nil {
+		return t.nodes[RootID]
+	}
+	if n := t.nodes[*id]; n != nil {
+		return n
+	}
+	return t.add(RootID, *id, now)
+}
+
+func (t *Tree) add(parentID, id string, now time.Time) *node {
+	n := &node{
+		Node:      Node{ID: id, ParentID: parentID, Status: StatusRunning, Started: now},
+		responses: make(map[string]bool),
+	}
+	t.nodes[id] = n
+	parent := t.nodes[parentID]
+	parent.Children = append(parent.Children, id)
+	return n
+}
+
+func (n *node) addUsage(responseID string, usage *message.Usage) {
+	if usage == nil || (responseID != "" && n.responses[responseID]) {
+		return
+	}
+	if responseID != "" {
+		n.responses[responseID] = true
+	}
+	n.Usage.InputTokens += usage.InputTokens
+	n.Usage.OutputTokens += usage.OutputTokens
+	n.Usage.CacheReadInputTokens += usage.CacheReadInputTokens
+	n.Usage.CacheCreationInputTokens += usage.CacheCreationInputTokens
+}
+
+// started adds a child for every Task call in an assistant message.
+func (t *Tree) started(parent *node, msg *message.AssistantMessage, now time.Time) []*node {
+	var changed []*node
+	for _, block := range msg.Message.Content {
+		use, ok := block.(*message.ToolUseBlock)
+		if !ok {
+			continue
+		}
+		in, _ := tools.DecodeToolUse(use)
+		task, ok := in.(*tools.TaskInput)
+		if !ok {
+			continue
+		}
+		n := t.nodes[use.ID]
+		if n == nil {
+			n = t.add(parent.ID, use.ID, now)
+		}
+		n.AgentType = task.SubagentType
+		n.Description = task.Description
+		n.Prompt = task.Prompt
+		if task.Model != "" {
+			n.Model = task.Model
+		}
+		changed = append(changed, n)
+	}
+	return changed
+}
+
+// finished completes the subagents whose Task calls have results.
+func (t *Tree) finished(msg *message.UserMessage, now time.Time) []*node {
+	var results []*message.ToolResultBlock
+	for _, block := range msg.Message.Blocks() {
+		if r, ok := block.(*message.ToolResultBlock); ok {
+			results = append(results, r)
+		}
+	}
+
+	var changed []*node
+	for _, r := range results {
+		n := t.nodes[r.ToolUseID]
+		if n == nil || r.ToolUseID == RootID || n.Status != StatusRunning {
+			continue
+		}
+		n.Finished = now
+		n.Status = StatusCompleted
+		if r.IsError != nil && *r.IsError {
+			n.Status = StatusFailed
+		}
+		n.Result = tools.ResultText(r.Content)
+		// The structured result belongs to the message's only tool result.
+		if len(results) == 1 {
+			if res, _ := tools.DecodeResult(tools.Task, msg.ToolUseResult); res != nil {
+				if task, ok := res.(*tools.TaskResult); ok {
+					n.applyResult(task)
+				}
+			}
+		}
+		changed = append(changed, n)
+	}
+	return changed
+}
+
+func (n *node) applyResult(res *tools.TaskResult) {
+	if res.AgentID != "" {
+		n.AgentID = res.AgentID
+	}
+	var text []string
+	for _, block := range res.Content {
+		text = append(text, block.Text)
+	}
+	if len(text) > 0 {
+		n.Result = strings.Join(text, "\n")
+	}
+}
+
+// denied fails subagents whose Task calls were refused.
+func (t *Tree) denied(denials []message.PermissionDenial, now time.Time) []*node {
+	var changed []*node
+	for _, d := range denials {
+		n := t.nodes[d.ToolUseID]
+		if n == nil || d.ToolUseID == RootID || n.Status != StatusRunning {
+			continue
+		}
+		n.Finished = now
+		n.Status = StatusFailed
+		changed = append(changed, n)
+	}
+	return changed
+}
+
+// Root returns a copy of the main thread's node.
+func (t *Tree) Root() Node {
+	n, _ := t.Node(RootID)
+	return n
+}
+
+// Node returns a copy of the node with the given ID.
+func (t *Tree) Node(id string) (Node, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, ok := t.nodes[id]
+	if !ok {
+		return Node{}, false
+	}
+	return n.clone(), true
+}
+
+// Walk calls fn with a copy of every node, depth first from the root, with
+// children in the order they started. depth is 0 for the root. Returning
+// false from fn skips the node's children.
+func (t *Tree) Walk(fn func(n Node, depth int) bool) {
+	t.mu.Lock()
+	type entry struct {
+		node  Node
+		depth int
+	}
+	var nodes []entry
+	var visit func(id string, depth int)
+	visit = func(id string, depth int) {
+		n := t.nodes[id]
+		nodes = append(nodes, entry{n.clone(), depth})
+		for _, child := range n.Children {
+			visit(child, depth+1)
+		}
+	}
+	visit(RootID, 0)
+	t.mu.Unlock()
+
+	// Copying first lets fn call back into the tree.
+	skipBelow := -1
+	for _, e := range nodes {
+		if skipBelow >= 0 {
+			if e.depth > skipBelow {
+				continue
+			}
+			skipBelow = -1
+		}
+		if !fn(e.node, e.depth) {
+			skipBelow = e.depth
+		}
+	}
+}
+
+func (t *Tree) listenersLocked() []listener {
+	listeners := make([]listener, 0, len(t.listeners))
+	for _, l := range t.listeners {
+		listeners = append(listeners, l)
+	}
+	return listeners
+}
+
+func notify(listeners []listener, events []Event) {
+	for _, e := range events {
+		for _, l := range listeners {
+			if l.all || l.nodeID == e.Node.ID {
+				l.fn(e)
+			}
+		}
+	}
+}
+
+// parentToolUseID returns the Task call a message belongs to, or nil for
+// messages of the main thread.
+func parentToolUseID(msg message.Message) *string {
+	switch msg := msg.(type) {
+	case *message.UserMessage:
+		return msg.ParentToolUseID
+	case *message.AssistantMessage:
+		return msg.ParentToolUseID
+	case *message.StreamEvent:
+		return msg.ParentToolUseID
+	case *message.UserMessageReplay:
+		return msg.ParentToolUseID
+	default:
+		return nil
+	}
+}
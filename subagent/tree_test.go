@@ -0,0 +1,146 @@
+package subagent
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"claudeagent/control"
+	"claudeagent/message"
+)
+
+func mustParse(t *testing.T, data string) message.Message {
+	t.Helper()
+	msg, err := message.ParseMessage([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestTree(t *testing.T) {
+	tree := NewTree()
+	var events []string
+	tree.OnChange(func(e Event) {
+		events = append(events, e.Node.ID+":"+string(e.Node.Status))
+	})
+	var explorer []message.Message
+	unsubscribe := tree.Subscribe("task1", func(e Event) {
+		if e.Message != nil {
+			explorer = append(explorer, e.Message)
+		}
+	})
+
+	tree.Observe(mustParse(t, `{"type":"system","subtype":"init","model":"opus"}`))
+	tree.Observe(mustParse(t, `{"type":"assistant","message":{"id":"m1","usage":{"input_tokens":10,"output_tokens":5},"content":[
+		{"type":"tool_use","id":"task1","name":"Task","input":{"description":"Find tests","prompt":"Find the tests","subagent_type":"Explore"}}
+	]}}`))
+	if _, err := tree.subagentStart(context.Background(), &control.SubagentStartHookInput{AgentID: "a1", AgentType: "Explore"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	// The subagent starts a subagent of its own, over two messages of the
+	// same response.
+	tree.Observe(mustParse(t, `{"type":"assistant","parent_tool_use_id":"task1","message":{"id":"m2","model":"haiku","usage":{"input_tokens":3,"output_tokens":1},"content":[
+		{"type":"text","text":"Delegating"}
+	]}}`))
+	tree.Observe(mustParse(t, `{"type":"assistant","parent_tool_use_id":"task1","message":{"id":"m2","model":"haiku","usage":{"input_tokens":3,"output_tokens":1},"content":[
+		{"type":"tool_use","id":"task2","name":"Task","input":{"description":"d","prompt":"p","subagent_type":"general-purpose"}}
+	]}}`))
+	tree.Observe(mustParse(t, `{"type":"user","parent_tool_use_id":"task1","message":{"role":"user","content":[
+		{"type":"tool_result","tool_use_id":"task2","content":"nothing found","is_error":true}
+	]}}`))
+	unsubscribe()
+	tree.Observe(mustParse(t, `{"type":"user","message":{"role":"user","content":[
+		{"type":"tool_result","tool_use_id":"task1","content":[{"type":"text","text":"raw"}]}
+	]},"tool_use_result":{"agentId":"a1","content":[{"type":"text","text":"tests are in ./..."}],"totalTokens":42}}`))
+	tree.Observe(mustParse(t, `{"type":"result","subtype":"success","result":"done","total_cost_usd":0.25}`))
+
+	root := tree.Root()
+	if root.Status != StatusCompleted || root.CostUSD != 0.25 || root.Result != "done" || root.Model != "opus" {
+		t.Errorf("unexpected root: %+v", root)
+	}
+	if !reflect.DeepEqual(root.Children, []string{"task1"}) || len(root.Messages) != 4 {
+		t.Errorf("unexpected root children %v or %d messages", root.Children, len(root.Messages))
+	}
+
+	task1, _ := tree.Node("task1")
+	if task1.AgentID != "a1" || task1.AgentType != "Explore" || task1.Description != "Find tests" || task1.Model != "haiku" {
+		t.Errorf("unexpected task1: %+v", task1)
+	}
+	if task1.Status != StatusCompleted || task1.Result != "tests are in ./..." {
+		t.Errorf("task1 status %s, result %q", task1.Status, task1.Result)
+	}
+	if task1.Usage.InputTokens != 3 || task1.Usage.OutputTokens != 1 {
+		t.Errorf("task1 usage counted per response: %+v", task1.Usage)
+	}
+	if len(task1.Messages) != 3 || len(explorer) != 3 {
+		t.Errorf("task1 has %d messages, subscriber saw %d", len(task1.Messages), len(explorer))
+	}
+
+	task2, _ := tree.Node("task2")
+	if task2.ParentID != "task1" || task2.Status != StatusFailed || task2.Result != "nothing found" {
+		t.Errorf("unexpected task2: %+v", task2)
+	}
+
+	want := []string{
+		":running", ":running", "task1:running", "task1:running", // init, Task call, hook
+		"task1:running", "task1:running", "task2:running", // delegation
+		"task1:running", "task2:failed", // nested result
+		":running", "task1:completed", // result
+		":completed",
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
+
+func TestTree_Walk(t *testing.T) {
+	tree := NewTree()
+	tree.Observe(mustParse(t, `{"type":"assistant","message":{"content":[
+		{"type":"tool_use","id":"a","name":"Task","input":{"subagent_type":"A"}},
+		{"type":"tool_use","id":"b","name":"Agent","input":{"subagent_type":"B"}}
+	]}}`))
+	tree.Observe(mustParse(t, `{"type":"assistant","parent_tool_use_id":"a","message":{"content":[
+		{"type":"tool_use","id":"a1","name":"Task","input":{"subagent_type":"A1"}}
+	]}}`))
+	// Messages of an unknown Task call get a node under the root.
+	tree.Observe(mustParse(t, `{"type":"user","parent_tool_use_id":"c","message":{"role":"user","content":"hi"}}`))
+
+	var got []string
+	tree.Walk(func(n Node, depth int) bool {
+		got = append(got, n.ID+"/"+n.AgentType+"@"+string(rune('0'+depth)))
+		return true
+	})
+	want := []string{"/@0", "a/A@1", "a1/A1@2", "b/B@1", "c/@1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk = %v, want %v", got, want)
+	}
+
+	got = nil
+	tree.Walk(func(n Node, depth int) bool {
+		got = append(got, n.ID)
+		return n.ID != "a"
+	})
+	if !reflect.DeepEqual(got, []string{"", "a", "b", "c"}) {
+		t.Errorf("Walk skipping a's children = %v", got)
+	}
+}
+
+func TestTree_SubagentStartByToolUseID(t *testing.T) {
+	tree := NewTree()
+	tree.Observe(mustParse(t, `{"type":"assistant","message":{"content":[
+		{"type":"tool_use","id":"a","name":"Task","input":{"subagent_type":"A"}},
+		{"type":"tool_use","id":"b","name":"Task","input":{"subagent_type":"B"}}
+	]}}`))
+	id := "b"
+	hook := tree.Matcher().Hooks[0]
+	if _, err := hook(context.Background(), &control.SubagentStartHookInput{AgentID: "agent-b", AgentType: "B"}, &id); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := tree.Node("b"); n.AgentID != "agent-b" {
+		t.Errorf("b.AgentID = %q", n.AgentID)
+	}
+	if n, _ := tree.Node("a"); n.AgentID != "" {
+		t.Errorf("a.AgentID = %q", n.AgentID)
+	}
+}
@@ -0,0 +1,337 @@
+// Package tools provides typed views of the CLI's built-in tool calls.
+//
+// Tool inputs arrive as map[string]any in ToolUseBlock.Input and in the
+// permission callback. DecodeInput turns them into the structs of this
+// package, and EncodeInput and UpdateInput turn them back into maps, e.g.
+// for PermissionResult.UpdatedInput:
+//
+//	func(ctx context.Context, name string, input map[string]any, _ control.CanUseToolOptions) (control.PermissionResult, error) {
+//	    in, _ := tools.DecodeInput(name, input)
+//	    switch in := in.(type) {
+//	    case *tools.BashInput:
+//	        if strings.HasPrefix(in.Command, "rm ") {
+//	            return control.PermissionResult{Behavior: control.PermissionDeny, Message: "no rm"}, nil
+//	        }
+//	    case *tools.WriteInput:
+//	        ...
+//	    }
+//	    return control.PermissionResult{Behavior: control.PermissionAllow, UpdatedInput: input}, nil
+//	}
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"claudeagent/message"
+)
+
+// Built-in tool names.
+const (
+	Bash            = "Bash"
+	Read            = "Read"
+	Write           = "Write"
+	Edit            = "Edit"
+	MultiEdit       = "MultiEdit"
+	Glob            = "Glob"
+	Grep            = "Grep"
+	WebFetch        = "WebFetch"
+	WebSearch       = "WebSearch"
+	Task            = "Task"
+	TodoWrite       = "TodoWrite"
+	NotebookEdit    = "NotebookEdit"
+	ExitPlanMode    = "ExitPlanMode"
+	AskUserQuestion = "AskUserQuestion"
+)
+
+// agentTool is the newer name of the Task tool.
+const agentTool = "Agent"
+
+// ErrUnknownTool is returned by DecodeInput for tools without a typed input,
+// such as MCP tools.
+var ErrUnknownTool = errors.New("no typed input for tool")
+
+// Input is the typed input of a built-in tool.
+type Input interface {
+	ToolName() string
+}
+
+type BashInput struct {
+	Command     string `json:"command"`
+	Description string `json:"description,omitempty"`
+	// Timeout is in milliseconds.
+	Timeout                   *int `json:"timeout,omitempty"`
+	RunInBackground           bool `json:"run_in_background,omitempty"`
+	DangerouslyDisableSandbox bool `json:"dangerouslyDisableSandbox,omitempty"`
+}
+
+type ReadInput struct {
+	FilePath string `json:"file_path"`
+	Offset   *int   `json:"offset,omitempty"`
+	Limit    *int   `json:"limit,omitempty"`
+}
+
+type WriteInput struct {
+	FilePath string `json:"file_path"`
+	Content  string `json:"content"`
+}
+
+type EditInput struct {
+	FilePath   string `json:"file_path"`
+	OldString  string `json:"old_string"`
+	NewString  string `json:"new_string"`
+	ReplaceAll bool   `json:"replace_all,omitempty"`
+}
+
+type MultiEditInput struct {
+	FilePath string          `json:"file_path"`
+	Edits    []EditOperation `json:"edits"`
+}
+
+// EditOperation is one edit of a MultiEdit call.
+type EditOperation struct {
+	OldString  string `json:"old_string"`
+	NewString  string `json:"new_string"`
+	ReplaceAll bool   `json:"replace_all,omitempty"`
+}
+
+type GlobInput struct {
+	Pattern string `json:"pattern"`
+	Path    string `json:"path,omitempty"`
+}
+
+type GrepInput struct {
+	Pattern         string `json:"pattern"`
+	Path            string `json:"path,omitempty"`
+	Glob            string `json:"glob,omitempty"`
+	Type            string `json:"type,omitempty"`
+	OutputMode      string `json:"output_mode,omitempty"`
+	CaseInsensitive bool   `json:"-i,omitempty"`
+	LineNumbers     *bool  `json:"-n,omitempty"`
+	After           *int   `json:"-A,omitempty"`
+	Before          *int   `json:"-B,omitempty"`
+	Context         *int   `json:"-C,omitempty"`
+	Multiline       bool   `json:"multiline,omitempty"`
+	HeadLimit       *int   `json:"head_limit,omitempty"`
+	Offset          *int   `json:"offset,omitempty"`
+}
+
+type WebFetchInput struct {
+	URL    string `json:"url"`
+	Prompt string `json:"prompt"`
+}
+
+type WebSearchInput struct {
+	Query          string   `json:"query"`
+	AllowedDomains []string `json:"allowed_domains,omitempty"`
+	BlockedDomains []string `json:"blocked_domains,omitempty"`
+}
+
+type TaskInput struct {
+	Description     string `json:"description"`
+	Prompt          string `json:"prompt"`
+	SubagentType    string `json:"subagent_type"`
+	Model           string `json:"model,omitempty"`
+	Resume          string `json:"resume,omitempty"`
+	RunInBackground bool   `json:"run_in_background,omitempty"`
+}
+
+type TodoWriteInput struct {
+	Todos []Todo `json:"todos"`
+}
+
+// TodoStatus is the state of a todo item.
+type TodoStatus string
+
+const (
+	TodoPending    TodoStatus = "pending"
+	TodoInProgress TodoStatus = "in_progress"
+	TodoCompleted  TodoStatus = "completed"
+)
+
+type Todo struct {
+	Content string     `json:"content"`
+	Status  TodoStatus `json:"status"`
+	// ActiveForm is shown while the item is in progress, e.g. "Running tests".
+	ActiveForm string `json:"activeForm"`
+}
+
+type NotebookEditInput struct {
+	NotebookPath string `json:"notebook_path"`
+	CellID       string `json:"cell_id,omitempty"`
+	NewSource    string `json:"new_source"`
+	// CellType is "code" or "markdown".
+	CellType string `json:"cell_type,omitempty"`
+	// EditMode is "replace", "insert" or "delete".
+	EditMode string `json:"edit_mode,omitempty"`
+}
+
+type ExitPlanModeInput struct {
+	Plan string `json:"plan,omitempty"`
+}
+
+type AskUserQuestionInput struct {
+	Questions []Question `json:"questions"`
+	// Answers maps question text to the chosen labels, comma-separated for
+	// multi-select questions. It is filled in when answering on the user's
+	// behalf.
+	Answers map[string]string `json:"answers,omitempty"`
+}
+
+type Question struct {
+	Question    string           `json:"question"`
+	Header      string           `json:"header"`
+	Options     []QuestionOption `json:"options"`
+	MultiSelect bool             `json:"multiSelect"`
+}
+
+type QuestionOption struct {
+	Label       string `json:"label"`
+	Description string `json:"description"`
+}
+
+func (BashInput) ToolName() string            { return Bash }
+func (ReadInput) ToolName() string            { return Read }
+func (WriteInput) ToolName() string           { return Write }
+func (EditInput) ToolName() string            { return Edit }
+func (MultiEditInput) ToolName() string       { return MultiEdit }
+func (GlobInput) ToolName() string            { return Glob }
+func (GrepInput) ToolName() string            { return Grep }
+func (WebFetchInput) ToolName() string        { return WebFetch }
+func (WebSearchInput) ToolName() string       { return WebSearch }
+func (TaskInput) ToolName() string            { return Task }
+func (TodoWriteInput) ToolName() string       { return TodoWrite }
+func (NotebookEditInput) ToolName() string    { return NotebookEdit }
+func (ExitPlanModeInput) ToolName() string    { return ExitPlanMode }
+func (AskUserQuestionInput) ToolName() string { return AskUserQuestion }
+
+// newInput returns a pointer to a zero input for a built-in tool.
+func newInput(toolName string) Input {
+	switch toolName {
+	case Bash:
+		return &BashInput{}
+	case Read:
+		return &ReadInput{}
+	case Write:
+		return &WriteInput{}
+	case Edit:
+		return &EditInput{}
+	case MultiEdit:
+		return &MultiEditInput{}
+	case Glob:
+		return &GlobInput{}
+	case Grep:
+		return &GrepInput{}
+	case WebFetch:
+		return &WebFetchInput{}
+	case WebSearch:
+		return &WebSearchInput{}
+	case Task, agentTool:
+		return &TaskInput{}
+	case TodoWrite:
+		return &TodoWriteInput{}
+	case NotebookEdit:
+		return &NotebookEditInput{}
+	case ExitPlanMode:
+		return &ExitPlanModeInput{}
+	case AskUserQuestion:
+		return &AskUserQuestionInput{}
+	default:
+		return nil
+	}
+}
+
+// DecodeInput converts the input of a built-in tool call into a pointer to
+// its typed input, e.g. *BashInput. Tools without a typed input return an
+// error wrapping ErrUnknownTool.
+func DecodeInput(toolName string, input map[string]any) (Input, error) {
+	in := newInput(toolName)
+	if in == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTool, toolName)
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("%s input: %w", toolName, err)
+	}
+	if err := json.Unmarshal(data, in); err != nil {
+		return nil, fmt.Errorf("%s input: %w", toolName, err)
+	}
+	return in, nil
+}
+
+// DecodeToolUse decodes the input of a tool_use content block.
+func DecodeToolUse(block *message.ToolUseBlock) (Input, error) {
+	return DecodeInput(block.Name, block.Input)
+}
+
+// Decode converts a tool input into the typed input T, e.g.
+// Decode[tools.BashInput](input).
+func Decode[T Input](input map[string]any) (T, error) {
+	var in T
+	data, err := json.Marshal(input)
+	if err != nil {
+		return in, fmt.Errorf("decode %T: %w", in, err)
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return in, fmt.Errorf("decode %T: %w", in, err)
+	}
+	return in, nil
+}
+
+// EncodeInput converts a typed input back into the CLI's map form. Only the
+// fields of the typed input are included; use UpdateInput to keep fields
+// the SDK does not know about.
+func EncodeInput(in Input) (map[string]any, error) {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return nil, fmt.Errorf("%s input: %w", in.ToolName(), err)
+	}
+	var out map[string]any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("%s input: %w", in.ToolName(), err)
+	}
+	return out, nil
+}
+
+// UpdateInput returns a copy of original with the fields of in replacing the
+// ones they describe. Fields unknown to the typed input are kept.
+func UpdateInput(original map[string]any, in Input) (map[string]any, error) {
+	encoded, err := EncodeInput(in)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]any, len(original)+len(encoded))
+	for k, v := range original {
+		out[k] = v
+	}
+	for _, name := range jsonFields(reflect.TypeOf(in)) {
+		delete(out, name)
+	}
+	for k, v := range encoded {
+		out[k] = v
+	}
+	return out, nil
+}
+
+// jsonFields lists the JSON names of a struct's fields.
+func jsonFields(t reflect.Type) []string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
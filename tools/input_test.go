@@ -0,0 +1,152 @@
+package tools
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"claudeagent/message"
+)
+
+func TestDecodeInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		tool  string
+		input map[string]any
+		want  Input
+	}{
+		{
+			name:  "bash",
+			tool:  Bash,
+			input: map[string]any{"command": "go test ./...", "timeout": float64(60000), "description": "Run tests"},
+			want:  &BashInput{Command: "go test ./...", Timeout: intPtr(60000), Description: "Run tests"},
+		},
+		{
+			name:  "edit",
+			tool:  Edit,
+			input: map[string]any{"file_path": "/a.go", "old_string": "x", "new_string": "y", "replace_all": true},
+			want:  &EditInput{FilePath: "/a.go", OldString: "x", NewString: "y", ReplaceAll: true},
+		},
+		{
+			name: "multi edit",
+			tool: MultiEdit,
+			input: map[string]any{"file_path": "/a.go", "edits": []any{
+				map[string]any{"old_string": "a", "new_string": "b"},
+				map[string]any{"old_string": "c", "new_string": "d", "replace_all": true},
+			}},
+			want: &MultiEditInput{FilePath: "/a.go", Edits: []EditOperation{
+				{OldString: "a", NewString: "b"},
+				{OldString: "c", NewString: "d", ReplaceAll: true},
+			}},
+		},
+		{
+			name:  "grep flags",
+			tool:  Grep,
+			input: map[string]any{"pattern": "TODO", "-i": true, "-C": float64(2), "output_mode": "content"},
+			want:  &GrepInput{Pattern: "TODO", CaseInsensitive: true, Context: intPtr(2), OutputMode: "content"},
+		},
+		{
+			name:  "agent alias",
+			tool:  "Agent",
+			input: map[string]any{"description": "d", "prompt": "p", "subagent_type": "Explore"},
+			want:  &TaskInput{Description: "d", Prompt: "p", SubagentType: "Explore"},
+		},
+		{
+			name: "todos",
+			tool: TodoWrite,
+			input: map[string]any{"todos": []any{
+				map[string]any{"content": "Run tests", "status": "in_progress", "activeForm": "Running tests"},
+			}},
+			want: &TodoWriteInput{Todos: []Todo{{Content: "Run tests", Status: TodoInProgress, ActiveForm: "Running tests"}}},
+		},
+		{
+			name: "ask user question",
+			tool: AskUserQuestion,
+			input: map[string]any{"questions": []any{map[string]any{
+				"question": "Which database?", "header": "DB", "multiSelect": false,
+				"options": []any{map[string]any{"label": "Postgres", "description": "SQL"}},
+			}}},
+			want: &AskUserQuestionInput{Questions: []Question{{
+				Question: "Which database?", Header: "DB",
+				Options: []QuestionOption{{Label: "Postgres", Description: "SQL"}},
+			}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeInput(tt.tool, tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeInput() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeInput_Errors(t *testing.T) {
+	if _, err := DecodeInput("mcp__github__create_issue", map[string]any{}); !errors.Is(err, ErrUnknownTool) {
+		t.Errorf("expected ErrUnknownTool, got %v", err)
+	}
+	if _, err := DecodeInput(Bash, map[string]any{"command": 42}); err == nil {
+		t.Error("expected an error for a mistyped field")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	in, err := Decode[WriteInput](map[string]any{"file_path": "/a.txt", "content": "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in != (WriteInput{FilePath: "/a.txt", Content: "hi"}) {
+		t.Errorf("Decode() = %+v", in)
+	}
+}
+
+func TestDecodeToolUse(t *testing.T) {
+	in, err := DecodeToolUse(&message.ToolUseBlock{Name: Read, Input: map[string]any{"file_path": "/a.go", "limit": float64(10)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ReadInput{FilePath: "/a.go", Limit: intPtr(10)}
+	if !reflect.DeepEqual(in, want) {
+		t.Errorf("DecodeToolUse() = %+v, want %+v", in, want)
+	}
+}
+
+func TestEncodeInput(t *testing.T) {
+	got, err := EncodeInput(&EditInput{FilePath: "/a.go", OldString: "x", NewString: "y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"file_path": "/a.go", "old_string": "x", "new_string": "y"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EncodeInput() = %v, want %v", got, want)
+	}
+}
+
+func TestUpdateInput(t *testing.T) {
+	original := map[string]any{"command": "rm -rf build", "run_in_background": true, "future_field": "kept"}
+	in, err := Decode[BashInput](original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.Command = "rm -rf ./build"
+	in.RunInBackground = false
+
+	got, err := UpdateInput(original, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"command": "rm -rf ./build", "future_field": "kept"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("UpdateInput() = %v, want %v", got, want)
+	}
+	if original["command"] != "rm -rf build" {
+		t.Error("UpdateInput modified the original input")
+	}
+}
+
+func intPtr(n int) *int { return &n }
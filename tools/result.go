@@ -0,0 +1,310 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"claudeagent/message"
+)
+
+// Result is the structured result the CLI attaches to a built-in tool's
+// result message, in UserMessage.ToolUseResult.
+type Result interface {
+	ToolName() string
+}
+
+type BashResult struct {
+	Stdout      string `json:"stdout"`
+	Stderr      string `json:"stderr"`
+	Interrupted bool   `json:"interrupted"`
+	IsImage     bool   `json:"isImage,omitempty"`
+	// BackgroundTaskID is set for commands run in the background.
+	BackgroundTaskID         string `json:"backgroundTaskId,omitempty"`
+	ReturnCodeInterpretation string `json:"returnCodeInterpretation,omitempty"`
+}
+
+type ReadResult struct {
+	// Type is "text", "image", "notebook" or "pdf".
+	Type string   `json:"type"`
+	File ReadFile `json:"file"`
+}
+
+// ReadFile describes the file read. Text files fill the line fields; images
+// fill Base64 and MediaType.
+type ReadFile struct {
+	FilePath   string `json:"filePath,omitempty"`
+	Content    string `json:"content,omitempty"`
+	NumLines   int    `json:"numLines,omitempty"`
+	StartLine  int    `json:"startLine,omitempty"`
+	TotalLines int    `json:"totalLines,omitempty"`
+	Base64     string `json:"base64,omitempty"`
+	MediaType  string `json:"type,omitempty"`
+}
+
+// PatchHunk is one hunk of a structured patch, with unified diff lines
+// prefixed by ' ', '-' or '+'.
+type PatchHunk struct {
+	OldStart int      `json:"oldStart"`
+	OldLines int      `json:"oldLines"`
+	NewStart int      `json:"newStart"`
+	NewLines int      `json:"newLines"`
+	Lines    []string `json:"lines"`
+}
+
+type WriteResult struct {
+	// Type is "create" or "update".
+	Type            string      `json:"type"`
+	FilePath        string      `json:"filePath"`
+	Content         string      `json:"content"`
+	StructuredPatch []PatchHunk `json:"structuredPatch"`
+	OriginalFile    *string     `json:"originalFile,omitempty"`
+}
+
+type EditResult struct {
+	FilePath        string      `json:"filePath"`
+	OldString       string      `json:"oldString"`
+	NewString       string      `json:"newString"`
+	OriginalFile    string      `json:"originalFile"`
+	StructuredPatch []PatchHunk `json:"structuredPatch"`
+	UserModified    bool        `json:"userModified"`
+	ReplaceAll      bool        `json:"replaceAll"`
+}
+
+type MultiEditResult struct {
+	FilePath             string          `json:"filePath"`
+	Edits                []EditOperation `json:"edits"`
+	OriginalFileContents string          `json:"originalFileContents"`
+	StructuredPatch      []PatchHunk     `json:"structuredPatch"`
+	UserModified         bool            `json:"userModified"`
+}
+
+type GlobResult struct {
+	Filenames  []string `json:"filenames"`
+	NumFiles   int      `json:"numFiles"`
+	DurationMS int      `json:"durationMs"`
+	Truncated  bool     `json:"truncated"`
+}
+
+type GrepResult struct {
+	Mode      string   `json:"mode,omitempty"`
+	Filenames []string `json:"filenames"`
+	NumFiles  int      `json:"numFiles"`
+	Content   string   `json:"content,omitempty"`
+	NumLines  int      `json:"numLines,omitempty"`
+}
+
+type WebFetchResult struct {
+	URL        string `json:"url"`
+	Code       int    `json:"code"`
+	CodeText   string `json:"codeText"`
+	Bytes      int    `json:"bytes"`
+	Result     string `json:"result"`
+	DurationMS int    `json:"durationMs"`
+}
+
+type WebSearchResult struct {
+	Query           string  `json:"query"`
+	Results         []any   `json:"results"`
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+type TaskResult struct {
+	Status            string              `json:"status,omitempty"`
+	AgentID           string              `json:"agentId,omitempty"`
+	Prompt            string              `json:"prompt,omitempty"`
+	Content           []message.TextBlock `json:"content"`
+	TotalDurationMS   int                 `json:"totalDurationMs"`
+	TotalTokens       int                 `json:"totalTokens"`
+	TotalToolUseCount int                 `json:"totalToolUseCount"`
+	Usage             *message.Usage      `json:"usage,omitempty"`
+}
+
+type TodoWriteResult struct {
+	OldTodos []Todo `json:"oldTodos"`
+	NewTodos []Todo `json:"newTodos"`
+}
+
+type NotebookEditResult struct {
+	NewSource string `json:"new_source"`
+	CellID    string `json:"cell_id,omitempty"`
+	CellType  string `json:"cell_type,omitempty"`
+	Language  string `json:"language,omitempty"`
+	EditMode  string `json:"edit_mode,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type ExitPlanModeResult struct {
+	Plan     string `json:"plan"`
+	IsAgent  bool   `json:"isAgent"`
+	FilePath string `json:"filePath,omitempty"`
+}
+
+type AskUserQuestionResult struct {
+	Questions []Question        `json:"questions"`
+	Answers   map[string]string `json:"answers"`
+}
+
+// TextResult is a result the CLI reported as plain text, which it does for
+// failed calls ("Error: ...").
+type TextResult struct {
+	Tool string
+	Text string
+}
+
+// RawResult is the result of a tool without a typed result, such as an MCP
+// tool, or one whose shape did not match its typed result.
+type RawResult struct {
+	Tool string
+	Data any
+}
+
+func (BashResult) ToolName() string            { return Bash }
+func (ReadResult) ToolName() string            { return Read }
+func (WriteResult) ToolName() string           { return Write }
+func (EditResult) ToolName() string            { return Edit }
+func (MultiEditResult) ToolName() string       { return MultiEdit }
+func (GlobResult) ToolName() string            { return Glob }
+func (GrepResult) ToolName() string            { return Grep }
+func (WebFetchResult) ToolName() string        { return WebFetch }
+func (WebSearchResult) ToolName() string       { return WebSearch }
+func (TaskResult) ToolName() string            { return Task }
+func (TodoWriteResult) ToolName() string       { return TodoWrite }
+func (NotebookEditResult) ToolName() string    { return NotebookEdit }
+func (ExitPlanModeResult) ToolName() string    { return ExitPlanMode }
+func (AskUserQuestionResult) ToolName() string { return AskUserQuestion }
+func (r TextResult) ToolName() string          { return r.Tool }
+func (r RawResult) ToolName() string           { return r.Tool }
+
+func newResult(toolName string) Result {
+	switch toolName {
+	case Bash:
+		return &BashResult{}
+	case Read:
+		return &ReadResult{}
+	case Write:
+		return &WriteResult{}
+	case Edit:
+		return &EditResult{}
+	case MultiEdit:
+		return &MultiEditResult{}
+	case Glob:
+		return &GlobResult{}
+	case Grep:
+		return &GrepResult{}
+	case WebFetch:
+		return &WebFetchResult{}
+	case WebSearch:
+		return &WebSearchResult{}
+	case Task, agentTool:
+		return &TaskResult{}
+	case TodoWrite:
+		return &TodoWriteResult{}
+	case NotebookEdit:
+		return &NotebookEditResult{}
+	case ExitPlanMode:
+		return &ExitPlanModeResult{}
+	case AskUserQuestion:
+		return &AskUserQuestionResult{}
+	default:
+		return nil
+	}
+}
+
+// DecodeResult converts a structured tool result into a pointer to its typed
+// result, e.g. *BashResult. Text results become *TextResult and tools
+// without a typed result *RawResult. If the data does not fit the typed
+// result, a *RawResult is returned together with the error, so shape
+// changes are reported rather than producing empty fields. A nil raw value
+// returns nil.
+func DecodeResult(toolName string, raw any) (Result, error) {
+	switch raw := raw.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return &TextResult{Tool: toolName, Text: raw}, nil
+	}
+
+	res := newResult(toolName)
+	if res == nil {
+		return &RawResult{Tool: toolName, Data: raw}, nil
+	}
+	data, err := json.Marshal(raw)
+	if err == nil {
+		err = json.Unmarshal(data, res)
+	}
+	if err != nil {
+		return &RawResult{Tool: toolName, Data: raw}, fmt.Errorf("%s result: %w", toolName, err)
+	}
+	return res, nil
+}
+
+// Call is a tool call matched with its result.
+type Call struct {
+	Use *message.ToolUseBlock
+	// Input is the typed input, or nil for tools without one.
+	Input  Input
+	Block  *message.ToolResultBlock
+	Result Result
+	// ResultErr reports a structured result that did not decode; Result is
+	// then a *RawResult.
+	ResultErr error
+	// ParentToolUseID is set for calls made by a subagent.
+	ParentToolUseID *string
+}
+
+// IsError reports whether the CLI marked the result as an error.
+func (c Call) IsError() bool {
+	return c.Block.IsError != nil && *c.Block.IsError
+}
+
+// Correlator matches tool results with the tool_use blocks that started them.
+type Correlator struct {
+	mu   sync.Mutex
+	uses map[string]*message.ToolUseBlock
+}
+
+// NewCorrelator creates an empty Correlator.
+func NewCorrelator() *Correlator {
+	return &Correlator{uses: make(map[string]*message.ToolUseBlock)}
+}
+
+// Observe records the tool_use blocks of assistant messages and returns the
+// calls completed by a user message. Pass every message of the session.
+func (c *Correlator) Observe(msg message.Message) []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch msg := msg.(type) {
+	case *message.AssistantMessage:
+		for _, block := range msg.Message.Content {
+			if use, ok := block.(*message.ToolUseBlock); ok {
+				c.uses[use.ID] = use
+			}
+		}
+	case *message.UserMessage:
+		return c.complete(msg)
+	}
+	return nil
+}
+
+func (c *Correlator) complete(msg *message.UserMessage) []Call {
+	results := toolResults(msg)
+	var calls []Call
+	for _, r := range results {
+		use, ok := c.uses[r.ToolUseID]
+		if !ok {
+			continue
+		}
+		delete(c.uses, r.ToolUseID)
+
+		call := Call{Use: use, Block: r, ParentToolUseID: msg.ParentToolUseID}
+		call.Input, _ = DecodeInput(use.Name, use.Input)
+		// The structured result belongs to the message's only tool result.
+		if len(results) == 1 {
+			call.Result, call.ResultErr = DecodeResult(use.Name, msg.ToolUseResult)
+		}
+		calls = append(calls, call)
+	}
+	return calls
+}
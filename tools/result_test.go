@@ -0,0 +1,142 @@
+package tools
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"claudeagent/message"
+)
+
+func TestDecodeResult(t *testing.T) {
+	tests := []struct {
+		name string
+		tool string
+		raw  string
+		want Result
+	}{
+		{
+			name: "bash",
+			tool: Bash,
+			raw:  `{"stdout":"ok\n","stderr":"","interrupted":false,"isImage":false}`,
+			want: &BashResult{Stdout: "ok\n"},
+		},
+		{
+			name: "edit",
+			tool: Edit,
+			raw:  `{"filePath":"/a.go","oldString":"x","newString":"y","originalFile":"x\n","structuredPatch":[{"oldStart":1,"oldLines":1,"newStart":1,"newLines":1,"lines":["-x","+y"]}],"userModified":false,"replaceAll":false}`,
+			want: &EditResult{
+				FilePath: "/a.go", OldString: "x", NewString: "y", OriginalFile: "x\n",
+				StructuredPatch: []PatchHunk{{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1, Lines: []string{"-x", "+y"}}},
+			},
+		},
+		{
+			name: "read",
+			tool: Read,
+			raw:  `{"type":"text","file":{"filePath":"/a.go","content":"package a","numLines":1,"startLine":1,"totalLines":1}}`,
+			want: &ReadResult{Type: "text", File: ReadFile{FilePath: "/a.go", Content: "package a", NumLines: 1, StartLine: 1, TotalLines: 1}},
+		},
+		{
+			name: "todos",
+			tool: TodoWrite,
+			raw:  `{"oldTodos":[],"newTodos":[{"content":"a","status":"pending","activeForm":"Doing a"}]}`,
+			want: &TodoWriteResult{OldTodos: []Todo{}, NewTodos: []Todo{{Content: "a", Status: TodoPending, ActiveForm: "Doing a"}}},
+		},
+		{
+			name: "error text",
+			tool: Bash,
+			raw:  `"Error: command not found"`,
+			want: &TextResult{Tool: Bash, Text: "Error: command not found"},
+		},
+		{
+			name: "unknown tool",
+			tool: "mcp__db__query",
+			raw:  `{"rows":1}`,
+			want: &RawResult{Tool: "mcp__db__query", Data: map[string]any{"rows": float64(1)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var raw any
+			if err := json.Unmarshal([]byte(tt.raw), &raw); err != nil {
+				t.Fatal(err)
+			}
+			got, err := DecodeResult(tt.tool, raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeResult() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeResult_ShapeMismatch(t *testing.T) {
+	raw := map[string]any{"stdout": []any{"not", "a", "string"}}
+	got, err := DecodeResult(Bash, raw)
+	if err == nil {
+		t.Fatal("expected an error for a mismatched shape")
+	}
+	if r, ok := got.(*RawResult); !ok || !reflect.DeepEqual(r.Data, raw) {
+		t.Errorf("expected the raw result, got %+v", got)
+	}
+
+	if got, err := DecodeResult(Bash, nil); got != nil || err != nil {
+		t.Errorf("expected nil for a missing result, got %+v, %v", got, err)
+	}
+}
+
+func TestCorrelator(t *testing.T) {
+	c := NewCorrelator()
+
+	assistant, err := message.ParseMessage([]byte(`{"type":"assistant","message":{"content":[
+		{"type":"tool_use","id":"tu1","name":"Bash","input":{"command":"ls"}},
+		{"type":"tool_use","id":"tu2","name":"mcp__db__query","input":{"sql":"select 1"}}
+	]},"session_id":"s1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := c.Observe(assistant); calls != nil {
+		t.Fatalf("expected no calls from an assistant message, got %+v", calls)
+	}
+
+	user, err := message.ParseMessage([]byte(`{"type":"user","message":{"role":"user","content":[
+		{"type":"tool_result","tool_use_id":"tu1","content":"a.go"}
+	]},"tool_use_result":{"stdout":"a.go","stderr":"","interrupted":false},"session_id":"s1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := c.Observe(user)
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 call, got %d", len(calls))
+	}
+	call := calls[0]
+	if call.Use.ID != "tu1" || call.IsError() {
+		t.Errorf("unexpected call: %+v", call)
+	}
+	if in, ok := call.Input.(*BashInput); !ok || in.Command != "ls" {
+		t.Errorf("unexpected input: %+v", call.Input)
+	}
+	if res, ok := call.Result.(*BashResult); !ok || res.Stdout != "a.go" {
+		t.Errorf("unexpected result: %+v", call.Result)
+	}
+
+	parent := "task1"
+	isError := true
+	calls = c.Observe(&message.UserMessage{
+		Message: message.UserContent{Content: []any{
+			map[string]any{"type": "tool_result", "tool_use_id": "tu2", "content": "denied", "is_error": isError},
+		}},
+		ParentToolUseID: &parent,
+	})
+	if len(calls) != 1 || calls[0].Input != nil || !calls[0].IsError() || *calls[0].ParentToolUseID != "task1" {
+		t.Errorf("unexpected MCP call: %+v", calls)
+	}
+
+	// Results are matched once.
+	if calls := c.Observe(user); len(calls) != 0 {
+		t.Errorf("expected no calls for a repeated result, got %+v", calls)
+	}
+}
@@ -0,0 +1,158 @@
+package tools
+
+import (
+	"sync"
+
+	"claudeagent/message"
+)
+
+// TodoEventKind says how a todo item changed.
+type TodoEventKind string
+
+const (
+	TodoItemAdded     TodoEventKind = "added"
+	TodoItemStarted   TodoEventKind = "started"
+	TodoItemCompleted TodoEventKind = "completed"
+	TodoItemRemoved   TodoEventKind = "removed"
+)
+
+// TodoEvent reports a change to one item of a todo list.
+type TodoEvent struct {
+	Kind TodoEventKind
+	Item Todo
+	// Index is the item's position in the new list, or in the old list for
+	// removed items.
+	Index int
+	// ParentToolUseID is the Task call whose subagent owns the list, or ""
+	// for the main thread.
+	ParentToolUseID string
+}
+
+// TodoTracker keeps the current todo lists of a session from its TodoWrite
+// calls. Every TodoWrite call replaces the whole list; the tracker diffs
+// successive lists into events. Subagents keep their own lists, keyed by the
+// Task call that started them.
+type TodoTracker struct {
+	mu        sync.Mutex
+	lists     map[string][]Todo
+	listeners map[int]func(TodoEvent)
+	nextID    int
+}
+
+// NewTodoTracker creates a tracker with no todos.
+func NewTodoTracker() *TodoTracker {
+	return &TodoTracker{
+		lists:     make(map[string][]Todo),
+		listeners: make(map[int]func(TodoEvent)),
+	}
+}
+
+// OnChange registers fn to be called for every change to a todo list. Items
+// moved back to pending only show in Todos. fn is called on the goroutine
+// calling Observe. The returned function unregisters it.
+func (t *TodoTracker) OnChange(fn func(TodoEvent)) (unsubscribe func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := t.nextID
+	t.nextID++
+	t.listeners[id] = fn
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.listeners, id)
+	}
+}
+
+// Observe updates the lists from the TodoWrite calls of an assistant
+// message. The list is updated when the call is made rather than when its
+// result arrives, so progress shows while the agent works.
+func (t *TodoTracker) Observe(msg message.Message) {
+	assistant, ok := msg.(*message.AssistantMessage)
+	if !ok {
+		return
+	}
+	owner := ""
+	if assistant.ParentToolUseID != nil {
+		owner = *assistant.ParentToolUseID
+	}
+
+	t.mu.Lock()
+	var events []TodoEvent
+	for _, block := range assistant.Message.Content {
+		use, ok := block.(*message.ToolUseBlock)
+		if !ok || use.Name != TodoWrite {
+			continue
+		}
+		in, err := Decode[TodoWriteInput](use.Input)
+		if err != nil {
+			continue
+		}
+		events = append(events, diffTodos(owner, t.lists[owner], in.Todos)...)
+		t.lists[owner] = append([]Todo(nil), in.Todos...)
+	}
+	listeners := make([]func(TodoEvent), 0, len(t.listeners))
+	for _, fn := range t.listeners {
+		listeners = append(listeners, fn)
+	}
+	t.mu.Unlock()
+
+	for _, e := range events {
+		for _, fn := range listeners {
+			fn(e)
+		}
+	}
+}
+
+// diffTodos matches items by content, in order for repeated contents.
+func diffTodos(owner string, old, new []Todo) []TodoEvent {
+	matched := make([]bool, len(old))
+	var events []TodoEvent
+	for i, item := range new {
+		prev := -1
+		for j, o := range old {
+			if !matched[j] && o.Content == item.Content {
+				prev = j
+				break
+			}
+		}
+		if prev < 0 {
+			events = append(events, TodoEvent{Kind: TodoItemAdded, Item: item, Index: i, ParentToolUseID: owner})
+		} else {
+			matched[prev] = true
+			if old[prev].Status == item.Status {
+				continue
+			}
+		}
+		switch item.Status {
+		case TodoInProgress:
+			events = append(events, TodoEvent{Kind: TodoItemStarted, Item: item, Index: i, ParentToolUseID: owner})
+		case TodoCompleted:
+			events = append(events, TodoEvent{Kind: TodoItemCompleted, Item: item, Index: i, ParentToolUseID: owner})
+		}
+	}
+	for j, o := range old {
+		if !matched[j] {
+			events = append(events, TodoEvent{Kind: TodoItemRemoved, Item: o, Index: j, ParentToolUseID: owner})
+		}
+	}
+	return events
+}
+
+// Todos returns a copy of the current list of the main thread, for "", or of
+// the subagent started by the Task call parentToolUseID.
+func (t *TodoTracker) Todos(parentToolUseID string) []Todo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Todo(nil), t.lists[parentToolUseID]...)
+}
+
+// Snapshot returns a copy of every list, keyed like Todos.
+func (t *TodoTracker) Snapshot() map[string][]Todo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lists := make(map[string][]Todo, len(t.lists))
+	for owner, todos := range t.lists {
+		lists[owner] = append([]Todo(nil), todos...)
+	}
+	return lists
+}
@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTodoTracker(t *testing.T) {
+	tracker := NewTodoTracker()
+	var events []string
+	tracker.OnChange(func(e TodoEvent) {
+		events = append(events, e.ParentToolUseID+"/"+string(e.Kind)+":"+e.Item.Content)
+	})
+
+	tracker.Observe(mustParse(t, `{"type":"assistant","message":{"content":[
+		{"type":"tool_use","id":"t1","name":"TodoWrite","input":{"todos":[
+			{"content":"Build","status":"in_progress","activeForm":"Building"},
+			{"content":"Test","status":"pending","activeForm":"Testing"}
+		]}}
+	]}}`))
+	tracker.Observe(mustParse(t, `{"type":"assistant","parent_tool_use_id":"task1","message":{"content":[
+		{"type":"tool_use","id":"t2","name":"TodoWrite","input":{"todos":[
+			{"content":"Search","status":"pending","activeForm":"Searching"}
+		]}}
+	]}}`))
+	tracker.Observe(mustParse(t, `{"type":"assistant","message":{"content":[
+		{"type":"tool_use","id":"t3","name":"TodoWrite","input":{"todos":[
+			{"content":"Build","status":"completed","activeForm":"Building"},
+			{"content":"Lint","status":"pending","activeForm":"Linting"},
+			{"content":"Test","status":"in_progress","activeForm":"Testing"}
+		]}}
+	]}}`))
+	tracker.Observe(mustParse(t, `{"type":"assistant","message":{"content":[
+		{"type":"tool_use","id":"t4","name":"TodoWrite","input":{"todos":[
+			{"content":"Build","status":"completed","activeForm":"Building"},
+			{"content":"Test","status":"in_progress","activeForm":"Testing"}
+		]}}
+	]}}`))
+
+	want := []string{
+		"/added:Build", "/started:Build", "/added:Test",
+		"task1/added:Search",
+		"/completed:Build", "/added:Lint", "/started:Test",
+		"/removed:Lint",
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+
+	todos := tracker.Todos("")
+	if len(todos) != 2 || todos[1].Status != TodoInProgress || todos[1].ActiveForm != "Testing" {
+		t.Errorf("main todos = %+v", todos)
+	}
+	snapshot := tracker.Snapshot()
+	if len(snapshot) != 2 || len(snapshot["task1"]) != 1 {
+		t.Errorf("snapshot = %+v", snapshot)
+	}
+	snapshot[""][0].Status = TodoPending
+	if tracker.Todos("")[0].Status != TodoCompleted {
+		t.Error("snapshot shares state with the tracker")
+	}
+}
+
+func TestDiffTodos_RepeatedContent(t *testing.T) {
+	old := []Todo{{Content: "Fix", Status: TodoCompleted}, {Content: "Fix", Status: TodoPending}}
+	new := []Todo{{Content: "Fix", Status: TodoCompleted}, {Content: "Fix", Status: TodoInProgress}}
+	events := diffTodos("", old, new)
+	if len(events) != 1 || events[0].Kind != TodoItemStarted || events[0].Index != 1 {
+		t.Errorf("events = %+v", events)
+	}
+}
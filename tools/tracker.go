@@ -0,0 +1,291 @@
+package tools
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"claudeagent/message"
+)
+
+// CallStatus is the state of a tracked tool call.
+type CallStatus string
+
+const (
+	// CallPending calls have been requested by the model but have not
+	// reported progress yet.
+	CallPending CallStatus = "pending"
+	// CallRunning calls have reported progress.
+	CallRunning   CallStatus = "running"
+	CallSucceeded CallStatus = "succeeded"
+	CallFailed    CallStatus = "failed"
+	// CallDenied calls were refused by the permission system.
+	CallDenied CallStatus = "denied"
+)
+
+// Done reports whether the call has finished.
+func (s CallStatus) Done() bool {
+	return s == CallSucceeded || s == CallFailed || s == CallDenied
+}
+
+// ToolCall is the tracked state of one tool call.
+type ToolCall struct {
+	ID    string
+	Name  string
+	Input map[string]any
+	// TypedInput is nil for tools without a typed input.
+	TypedInput Input
+	// ParentToolUseID is the Task call whose subagent made this call, or nil
+	// for the main thread.
+	ParentToolUseID *string
+	// Children are the IDs of calls made by the subagent of a Task call, in
+	// order.
+	Children []string
+
+	Status   CallStatus
+	Started  time.Time
+	Finished time.Time
+	// Elapsed is the running time last reported by the CLI's progress
+	// messages; see Duration for the time observed by the tracker.
+	Elapsed time.Duration
+
+	// Output is the content of the tool_result block.
+	Output any
+	Result Result
+	// ResultErr reports a structured result that did not decode.
+	ResultErr error
+	// Error is the error text of failed and denied calls.
+	Error string
+}
+
+// Duration is the call's running time so far, or its total once finished.
+func (c ToolCall) Duration() time.Duration {
+	if c.Finished.IsZero() {
+		return time.Since(c.Started)
+	}
+	return c.Finished.Sub(c.Started)
+}
+
+func (c ToolCall) String() string {
+	return fmt.Sprintf("%s %s (%s): %s", c.Name, c.ID, c.Duration().Round(time.Millisecond), c.Status)
+}
+
+func (c ToolCall) clone() ToolCall {
+	c.Children = append([]string(nil), c.Children...)
+	return c
+}
+
+// ToolCallTracker keeps a live table of the tool calls in a message stream,
+// including calls made by subagents. Feed it every message with Observe.
+type ToolCallTracker struct {
+	mu        sync.Mutex
+	calls     map[string]*ToolCall
+	order     []string
+	listeners map[int]func(ToolCall)
+	nextID    int
+}
+
+// NewToolCallTracker creates an empty tracker.
+func NewToolCallTracker() *ToolCallTracker {
+	return &ToolCallTracker{
+		calls:     make(map[string]*ToolCall),
+		listeners: make(map[int]func(ToolCall)),
+	}
+}
+
+// OnChange registers fn to be called with a copy of every call that starts,
+// progresses or finishes. fn is called on the goroutine calling Observe. The
+// returned function unregisters it.
+func (t *ToolCallTracker) OnChange(fn func(ToolCall)) (unsubscribe func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := t.nextID
+	t.nextID++
+	t.listeners[id] = fn
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.listeners, id)
+	}
+}
+
+// Observe updates the table from a message.
+func (t *ToolCallTracker) Observe(msg message.Message) {
+	now := time.Now()
+	t.mu.Lock()
+	var changed []*ToolCall
+	switch msg := msg.(type) {
+	case *message.AssistantMessage:
+		changed = t.started(msg, now)
+	case *message.ToolProgressMessage:
+		changed = t.progressed(msg)
+	case *message.UserMessage:
+		changed = t.finished(msg, now)
+	case *message.ResultMessage:
+		changed = t.denied(msg.PermissionDenials, now)
+	}
+
+	updates := make([]ToolCall, len(changed))
+	for i, c := range changed {
+		updates[i] = c.clone()
+	}
+	listeners := make([]func(ToolCall), 0, len(t.listeners))
+	for _, fn := range t.listeners {
+		listeners = append(listeners, fn)
+	}
+	t.mu.Unlock()
+
+	for _, c := range updates {
+		for _, fn := range listeners {
+			fn(c)
+		}
+	}
+}
+
+func (t *ToolCallTracker) started(msg *message.AssistantMessage, now time.Time) []*ToolCall {
+	var changed []*ToolCall
+	for _, block := range msg.Message.Content {
+		use, ok := block.(*message.ToolUseBlock)
+		if !ok || t.calls[use.ID] != nil {
+			continue
+		}
+		c := &ToolCall{
+			ID:              use.ID,
+			Name:            use.Name,
+			Input:           use.Input,
+			ParentToolUseID: msg.ParentToolUseID,
+			Status:          CallPending,
+			Started:         now,
+		}
+		c.TypedInput, _ = DecodeInput(use.Name, use.Input)
+		t.calls[use.ID] = c
+		t.order = append(t.order, use.ID)
+		if msg.ParentToolUseID != nil {
+			if parent := t.calls[*msg.ParentToolUseID]; parent != nil {
+				parent.Children = append(parent.Children, use.ID)
+			}
+		}
+		changed = append(changed, c)
+	}
+	return changed
+}
+
+func (t *ToolCallTracker) progressed(msg *message.ToolProgressMessage) []*ToolCall {
+	c := t.calls[msg.ToolUseID]
+	if c == nil || c.Status.Done() {
+		return nil
+	}
+	c.Status = CallRunning
+	c.Elapsed = time.Duration(msg.ElapsedTimeSeconds * float64(time.Second))
+	return []*ToolCall{c}
+}
+
+func (t *ToolCallTracker) finished(msg *message.UserMessage, now time.Time) []*ToolCall {
+	results := toolResults(msg)
+	var changed []*ToolCall
+	for _, r := range results {
+		c := t.calls[r.ToolUseID]
+		if c == nil || c.Status.Done() {
+			continue
+		}
+		c.Finished = now
+		c.Output = r.Content
+		if r.IsError != nil && *r.IsError {
+			c.Status = CallFailed
+			c.Error = ResultText(r.Content)
+		} else {
+			c.Status = CallSucceeded
+		}
+		if len(results) == 1 {
+			c.Result, c.ResultErr = DecodeResult(c.Name, msg.ToolUseResult)
+		}
+		changed = append(changed, c)
+	}
+	return changed
+}
+
+func (t *ToolCallTracker) denied(denials []message.PermissionDenial, now time.Time) []*ToolCall {
+	var changed []*ToolCall
+	for _, d := range denials {
+		c := t.calls[d.ToolUseID]
+		if c == nil || c.Status == CallDenied {
+			continue
+		}
+		if c.Finished.IsZero() {
+			c.Finished = now
+		}
+		c.Status = CallDenied
+		changed = append(changed, c)
+	}
+	return changed
+}
+
+// Call returns a copy of the call with the given tool use ID.
+func (t *ToolCallTracker) Call(id string) (ToolCall, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.calls[id]
+	if !ok {
+		return ToolCall{}, false
+	}
+	return c.clone(), true
+}
+
+// Snapshot returns a copy of every call in the order they started.
+func (t *ToolCallTracker) Snapshot() []ToolCall {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	calls := make([]ToolCall, len(t.order))
+	for i, id := range t.order {
+		calls[i] = t.calls[id].clone()
+	}
+	return calls
+}
+
+// Active returns the calls that have not finished, in the order they started.
+func (t *ToolCallTracker) Active() []ToolCall {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var calls []ToolCall
+	for _, id := range t.order {
+		if c := t.calls[id]; !c.Status.Done() {
+			calls = append(calls, c.clone())
+		}
+	}
+	return calls
+}
+
+// toolResults returns the tool_result blocks of a user message.
+func toolResults(msg *message.UserMessage) []*message.ToolResultBlock {
+	var results []*message.ToolResultBlock
+	for _, block := range msg.Message.Blocks() {
+		if r, ok := block.(*message.ToolResultBlock); ok {
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+// ResultText extracts the text of tool_result content, which is a string or
+// a list of content blocks, joining text blocks with newlines.
+func ResultText(content any) string {
+	switch content := content.(type) {
+	case string:
+		return content
+	case []any:
+		var text string
+		for _, item := range content {
+			if block, ok := item.(map[string]any); ok && block["type"] == "text" {
+				if s, ok := block["text"].(string); ok {
+					if text != "" {
+						text += "\n"
+					}
+					text += s
+				}
+			}
+		}
+		return text
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"claudeagent/message"
+)
+
+func mustParse(t *testing.T, data string) message.Message {
+	t.Helper()
+	msg, err := message.ParseMessage([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestToolCallTracker(t *testing.T) {
+	tracker := NewToolCallTracker()
+	var changes []string
+	unsubscribe := tracker.OnChange(func(c ToolCall) {
+		changes = append(changes, c.ID+":"+string(c.Status))
+	})
+
+	// The main thread starts a Bash call and a Task call in parallel.
+	tracker.Observe(mustParse(t, `{"type":"assistant","message":{"content":[
+		{"type":"tool_use","id":"bash1","name":"Bash","input":{"command":"go build"}},
+		{"type":"tool_use","id":"task1","name":"Task","input":{"description":"d","prompt":"p","subagent_type":"Explore"}}
+	]}}`))
+	// The subagent makes a call of its own.
+	tracker.Observe(mustParse(t, `{"type":"assistant","parent_tool_use_id":"task1","message":{"content":[
+		{"type":"tool_use","id":"read1","name":"Read","input":{"file_path":"/a.go"}}
+	]}}`))
+	tracker.Observe(mustParse(t, `{"type":"tool_progress","tool_use_id":"bash1","tool_name":"Bash","elapsed_time_seconds":1.5}`))
+	tracker.Observe(mustParse(t, `{"type":"user","parent_tool_use_id":"task1","message":{"role":"user","content":[
+		{"type":"tool_result","tool_use_id":"read1","content":"package a"}
+	]},"tool_use_result":{"type":"text","file":{"filePath":"/a.go","content":"package a"}}}`))
+	tracker.Observe(mustParse(t, `{"type":"user","message":{"role":"user","content":[
+		{"type":"tool_result","tool_use_id":"bash1","content":"build failed","is_error":true}
+	]}}`))
+
+	if active := tracker.Active(); len(active) != 1 || active[0].ID != "task1" {
+		t.Errorf("expected task1 to be active, got %v", active)
+	}
+
+	task, ok := tracker.Call("task1")
+	if !ok || !reflect.DeepEqual(task.Children, []string{"read1"}) {
+		t.Errorf("unexpected task call: %+v", task)
+	}
+	if in, ok := task.TypedInput.(*TaskInput); !ok || in.SubagentType != "Explore" {
+		t.Errorf("unexpected task input: %+v", task.TypedInput)
+	}
+
+	bash, _ := tracker.Call("bash1")
+	if bash.Status != CallFailed || bash.Error != "build failed" || bash.Elapsed != 1500*time.Millisecond || bash.Finished.IsZero() {
+		t.Errorf("unexpected bash call: %+v", bash)
+	}
+
+	read, _ := tracker.Call("read1")
+	if read.Status != CallSucceeded || read.ParentToolUseID == nil || *read.ParentToolUseID != "task1" {
+		t.Errorf("unexpected read call: %+v", read)
+	}
+	if res, ok := read.Result.(*ReadResult); !ok || res.File.Content != "package a" {
+		t.Errorf("unexpected read result: %+v", read.Result)
+	}
+
+	want := []string{"bash1:pending", "task1:pending", "read1:pending", "bash1:running", "read1:succeeded", "bash1:failed"}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+
+	unsubscribe()
+	tracker.Observe(&message.ResultMessage{PermissionDenials: []message.PermissionDenial{{ToolName: "Task", ToolUseID: "task1"}}})
+	if len(changes) != len(want) {
+		t.Errorf("listener called after unsubscribe: %v", changes)
+	}
+	task, _ = tracker.Call("task1")
+	if task.Status != CallDenied || task.Finished.IsZero() {
+		t.Errorf("expected task1 to be denied, got %+v", task)
+	}
+
+	var ids []string
+	for _, c := range tracker.Snapshot() {
+		ids = append(ids, c.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"bash1", "task1", "read1"}) {
+		t.Errorf("snapshot order = %v", ids)
+	}
+}
+
+func TestToolCallTracker_SnapshotIsCopy(t *testing.T) {
+	tracker := NewToolCallTracker()
+	tracker.Observe(mustParse(t, `{"type":"assistant","message":{"content":[
+		{"type":"tool_use","id":"task1","name":"Task","input":{}}
+	]}}`))
+	snap := tracker.Snapshot()
+
+	tracker.Observe(mustParse(t, `{"type":"assistant","parent_tool_use_id":"task1","message":{"content":[
+		{"type":"tool_use","id":"child","name":"Glob","input":{"pattern":"*.go"}}
+	]}}`))
+	if snap[0].Status != CallPending || len(snap[0].Children) != 0 {
+		t.Errorf("snapshot changed after Observe: %+v", snap[0])
+	}
+}
+
+func TestResultText(t *testing.T) {
+	content := []any{
+		map[string]any{"type": "text", "text": "first"},
+		map[string]any{"type": "image"},
+		map[string]any{"type": "text", "text": "second"},
+	}
+	if got := ResultText(content); got != "first\nsecond" {
+		t.Errorf("ResultText() = %q", got)
+	}
+}
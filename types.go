@@ -47,6 +47,30 @@ type HookCallbackMatcher = control.HookCallbackMatcher
 type HookInput = control.HookInput
 type HookOutput = control.HookOutput
 
+type PreToolUseHookInput = control.PreToolUseHookInput
+type PostToolUseHookInput = control.PostToolUseHookInput
+type PostToolUseFailureHookInput = control.PostToolUseFailureHookInput
+type NotificationHookInput = control.NotificationHookInput
+type UserPromptSubmitHookInput = control.UserPromptSubmitHookInput
+type SessionStartHookInput = control.SessionStartHookInput
+type SessionEndHookInput = control.SessionEndHookInput
+type StopHookInput = control.StopHookInput
+type SubagentStartHookInput = control.SubagentStartHookInput
+type SubagentStopHookInput = control.SubagentStopHookInput
+type PreCompactHookInput = control.PreCompactHookInput
+type PermissionRequestHookInput = control.PermissionRequestHookInput
+type SetupHookInput = control.SetupHookInput
+
+type HookControl = control.HookControl
+type PreToolUseOutput = control.PreToolUseOutput
+type PostToolUseOutput = control.PostToolUseOutput
+type UserPromptSubmitOutput = control.UserPromptSubmitOutput
+type ContextOutput = control.ContextOutput
+type StopOutput = control.StopOutput
+type PermissionRequestOutput = control.PermissionRequestOutput
+type PermissionRequestDecision = control.PermissionRequestDecision
+type AsyncHook = control.AsyncHook
+
 type McpServerConfig = mcp.ServerConfig
 type McpStdioServerConfig = mcp.StdioServerConfig
 type McpSSEServerConfig = mcp.SSEServerConfig
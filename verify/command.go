@@ -0,0 +1,45 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// commandWaitDelay bounds how long output pipes held open by orphaned
+// grandchildren may delay a killed command.
+const commandWaitDelay = time.Second
+
+// Command returns a verifier that runs a command in the session's working
+// directory. It passes when the command exits with status 0; otherwise its
+// combined output is the failure. It is not run through a shell; use
+// Command("sh", "-c", script) for shell syntax.
+func Command(name string, args ...string) Verifier {
+	display := strings.Join(append([]string{name}, args...), " ")
+	return func(ctx context.Context, cwd string) (Result, error) {
+		var out bytes.Buffer
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Dir = cwd
+		cmd.Stdout = &out
+		cmd.Stderr = &out
+		cmd.WaitDelay = commandWaitDelay
+
+		err := cmd.Run()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return Result{}, fmt.Errorf("%s: %w", display, ctxErr)
+		}
+		var exitErr *exec.ExitError
+		switch {
+		case err == nil:
+			return Result{Passed: true, Output: out.String()}, nil
+		case errors.As(err, &exitErr):
+			return Result{Output: fmt.Sprintf("$ %s\n%s\n[exit status %d]", display, strings.TrimRight(out.String(), "\n"), exitErr.ExitCode())}, nil
+		default:
+			return Result{}, fmt.Errorf("%s: %w", display, err)
+		}
+	}
+}
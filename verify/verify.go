@@ -0,0 +1,302 @@
+// Package verify keeps an agent working until a verifier passes.
+//
+// A Loop runs on the Stop hook: when the agent tries to finish, the verifier
+// runs, and a failure blocks the stop with the verifier output as the reason,
+// so the agent continues and tries to fix it:
+//
+//	loop := verify.New(verify.Command("go", "test", "./..."),
+//	    verify.WithMaxAttempts(5),
+//	    verify.WithMaxCostBetweenTurns(2.00),
+//	    verify.WithOnAttempt(func(a verify.Attempt) { log.Println(a) }),
+//	)
+//	client, err := claudeagent.NewClient(
+//	    claudeagent.WithHooks(claudeagent.HookStop, loop.Matcher()),
+//	)
+//	// ... connect and query ...
+//	for msg := range client.Messages(ctx) {
+//	    loop.Observe(msg) // the cost budget needs the result messages
+//	}
+package verify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"claudeagent/control"
+	"claudeagent/message"
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultTimeout     = 10 * time.Minute
+	defaultOutputLimit = 8 * 1024
+)
+
+// Result is the outcome of one verifier run.
+type Result struct {
+	Passed bool
+	// Output explains a failure to the agent, e.g. the failing test output.
+	Output string
+}
+
+// Verifier checks the agent's work in the session's working directory. An
+// error means the check could not run at all; the stop is then allowed
+// rather than sending the agent after a problem it cannot fix.
+type Verifier func(ctx context.Context, cwd string) (Result, error)
+
+// Outcome says what a Loop did when the agent tried to stop.
+type Outcome string
+
+const (
+	// OutcomePassed allowed the stop because the verifier passed.
+	OutcomePassed Outcome = "passed"
+	// OutcomeBlocked blocked the stop because the verifier failed.
+	OutcomeBlocked Outcome = "blocked"
+	// OutcomeExhausted allowed the stop after a failure because the attempt
+	// limit was reached.
+	OutcomeExhausted Outcome = "exhausted"
+	// OutcomeOverBudget allowed the stop without verifying because the cost
+	// limit was reached.
+	OutcomeOverBudget Outcome = "over_budget"
+	// OutcomeError allowed the stop because the verifier returned an error.
+	OutcomeError Outcome = "error"
+	// OutcomeSkipped allowed the stop without verifying because another
+	// hook had kept the agent going.
+	OutcomeSkipped Outcome = "skipped"
+)
+
+// Attempt reports one stop handled by a Loop.
+type Attempt struct {
+	// Number counts verifier runs since the agent last stopped on its own;
+	// it is zero when the verifier did not run.
+	Number   int
+	Outcome  Outcome
+	Result   Result
+	Err      error
+	Duration time.Duration
+	// CostUSD is the session cost known when the stop was handled.
+	CostUSD float64
+}
+
+func (a Attempt) String() string {
+	switch {
+	case a.Err != nil:
+		return fmt.Sprintf("verification attempt %d: %s: %v", a.Number, a.Outcome, a.Err)
+	case a.Number == 0:
+		return fmt.Sprintf("verification: %s", a.Outcome)
+	default:
+		return fmt.Sprintf("verification attempt %d: %s (%s)", a.Number, a.Outcome, a.Duration.Round(time.Millisecond))
+	}
+}
+
+// Option configures a Loop.
+type Option func(*Loop)
+
+// WithMaxAttempts caps verifier runs per stop sequence. After the last
+// failed attempt the agent is allowed to stop. The default is 5.
+func WithMaxAttempts(n int) Option {
+	return func(l *Loop) {
+		l.maxAttempts = n
+	}
+}
+
+// WithMaxCostBetweenTurns stops verifying once the session has cost usd or
+// more as of the last finished turn. The cost comes from result messages
+// passed to Observe, and a blocked stop continues the same turn, so no new
+// cost is known until the turn ends: the budget applies between turns, and
+// within a turn only WithMaxAttempts bounds the loop. Without Observe the
+// budget never applies.
+func WithMaxCostBetweenTurns(usd float64) Option {
+	return func(l *Loop) {
+		l.maxCost = usd
+	}
+}
+
+// WithTimeout bounds each verifier run and sets the hook timeout sent to the
+// CLI. The default is 10 minutes.
+func WithTimeout(d time.Duration) Option {
+	return func(l *Loop) {
+		l.timeout = d
+	}
+}
+
+// WithOutputLimit caps the verifier output passed to the agent, keeping the
+// end where failures are usually reported. The default is 8 KiB.
+func WithOutputLimit(n int) Option {
+	return func(l *Loop) {
+		l.outputLimit = n
+	}
+}
+
+// WithOnAttempt registers a callback invoked after every stop the Loop
+// handles.
+func WithOnAttempt(fn func(Attempt)) Option {
+	return func(l *Loop) {
+		l.onAttempt = fn
+	}
+}
+
+// Loop blocks the agent from stopping until its verifier passes.
+type Loop struct {
+	verifier    Verifier
+	maxAttempts int
+	maxCost     float64
+	timeout     time.Duration
+	outputLimit int
+	onAttempt   func(Attempt)
+
+	mu          sync.Mutex
+	attempt     int
+	blockedLast bool
+	cost        float64
+	history     []Attempt
+}
+
+// New creates a Loop around verifier.
+func New(verifier Verifier, opts ...Option) *Loop {
+	l := &Loop{
+		verifier:    verifier,
+		maxAttempts: defaultMaxAttempts,
+		timeout:     defaultTimeout,
+		outputLimit: defaultOutputLimit,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Matcher returns the Stop hook to register with WithHooks. It carries the
+// verifier timeout, so the CLI does not give up on slow verifiers.
+func (l *Loop) Matcher() control.HookCallbackMatcher {
+	timeout := int((l.timeout + time.Second - 1) / time.Second)
+	return control.HookCallbackMatcher{
+		Hooks:   []control.HookCallback{l.callback},
+		Timeout: &timeout,
+	}
+}
+
+func (l *Loop) callback(ctx context.Context, input control.HookInput, _ *string) (control.HookOutput, error) {
+	stop, ok := input.(*control.StopHookInput)
+	if !ok {
+		return control.HookOutput{}, fmt.Errorf("verify: unexpected hook input %T", input)
+	}
+	out, err := l.Stop(ctx, stop)
+	return out.ToHookOutput(), err
+}
+
+// Stop handles a Stop hook. It can be registered with OnStop directly.
+func (l *Loop) Stop(ctx context.Context, input *control.StopHookInput) (control.StopOutput, error) {
+	l.mu.Lock()
+	if !input.StopHookActive {
+		// The agent stopped on its own: a new sequence of attempts.
+		l.attempt = 0
+	} else if !l.blockedLast {
+		// Another hook kept the agent going; blocking again could loop
+		// forever between the two.
+		l.mu.Unlock()
+		l.finish(Attempt{Outcome: OutcomeSkipped})
+		return control.StopOutput{}, nil
+	}
+	l.blockedLast = false
+	if l.maxCost > 0 && l.cost >= l.maxCost {
+		l.mu.Unlock()
+		l.finish(Attempt{Outcome: OutcomeOverBudget})
+		return control.StopOutput{}, nil
+	}
+	l.attempt++
+	a := Attempt{Number: l.attempt}
+	l.mu.Unlock()
+
+	// The verifier may run for minutes; it runs without the lock so that
+	// Observe and Attempts are not held up.
+	start := time.Now()
+	vctx := ctx
+	if l.timeout > 0 {
+		var cancel context.CancelFunc
+		vctx, cancel = context.WithTimeout(ctx, l.timeout)
+		defer cancel()
+	}
+	a.Result, a.Err = l.verifier(vctx, input.Cwd)
+	a.Duration = time.Since(start)
+
+	switch {
+	case a.Err != nil:
+		a.Outcome = OutcomeError
+	case a.Result.Passed:
+		a.Outcome = OutcomePassed
+	case l.maxAttempts > 0 && a.Number >= l.maxAttempts:
+		a.Outcome = OutcomeExhausted
+	default:
+		a.Outcome = OutcomeBlocked
+		l.mu.Lock()
+		l.blockedLast = true
+		l.mu.Unlock()
+		l.finish(a)
+		return control.StopOutput{Block: true, Reason: l.reason(a)}, nil
+	}
+	l.finish(a)
+	return control.StopOutput{}, nil
+}
+
+// finish records a and reports it to the WithOnAttempt callback, which runs
+// without the lock so it may call Attempts.
+func (l *Loop) finish(a Attempt) {
+	l.mu.Lock()
+	a.CostUSD = l.cost
+	l.history = append(l.history, a)
+	l.mu.Unlock()
+	if l.onAttempt != nil {
+		l.onAttempt(a)
+	}
+}
+
+func (l *Loop) reason(a Attempt) string {
+	attempts := fmt.Sprintf("attempt %d", a.Number)
+	if l.maxAttempts > 0 {
+		attempts = fmt.Sprintf("attempt %d of %d", a.Number, l.maxAttempts)
+	}
+	output := keepTail(a.Result.Output, l.outputLimit)
+	if output == "" {
+		return fmt.Sprintf("Verification failed (%s). Fix the problem before finishing.", attempts)
+	}
+	return fmt.Sprintf("Verification failed (%s). Fix the problems below before finishing.\n\n%s", attempts, output)
+}
+
+// Observe records the session cost from result messages for
+// WithMaxCostBetweenTurns.
+// Pass every message received from the session.
+func (l *Loop) Observe(msg message.Message) {
+	result, ok := msg.(*message.ResultMessage)
+	if !ok {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if result.TotalCostUSD > l.cost {
+		l.cost = result.TotalCostUSD
+	}
+}
+
+// Attempts returns every stop handled so far, oldest first.
+func (l *Loop) Attempts() []Attempt {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Attempt(nil), l.history...)
+}
+
+// keepTail keeps the last limit bytes of s, where failures are usually
+// reported.
+func keepTail(s string, limit int) string {
+	if limit <= 0 || len(s) <= limit {
+		return s
+	}
+	start := len(s) - limit
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	return "[... output truncated ...]\n" + s[start:]
+}
@@ -0,0 +1,220 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"claudeagent/control"
+	"claudeagent/message"
+)
+
+// scripted returns a verifier that replays results in order.
+func scripted(results ...Result) Verifier {
+	return func(ctx context.Context, cwd string) (Result, error) {
+		r := results[0]
+		results = results[1:]
+		return r, nil
+	}
+}
+
+func stop(active bool) *control.StopHookInput {
+	return &control.StopHookInput{StopHookActive: active}
+}
+
+func outcomes(l *Loop) []Outcome {
+	var got []Outcome
+	for _, a := range l.Attempts() {
+		got = append(got, a.Outcome)
+	}
+	return got
+}
+
+func TestLoop_BlocksUntilPassed(t *testing.T) {
+	l := New(scripted(Result{Output: "FAIL: TestA"}, Result{Passed: true}))
+
+	out, err := l.Stop(context.Background(), stop(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.Block || !strings.Contains(out.Reason, "attempt 1 of 5") || !strings.Contains(out.Reason, "FAIL: TestA") {
+		t.Errorf("expected blocked stop with failure output, got %+v", out)
+	}
+
+	out, err = l.Stop(context.Background(), stop(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Block {
+		t.Errorf("expected stop to be allowed, got %+v", out)
+	}
+
+	want := []Outcome{OutcomeBlocked, OutcomePassed}
+	if got := outcomes(l); !reflect.DeepEqual(got, want) {
+		t.Errorf("outcomes = %v, want %v", got, want)
+	}
+}
+
+func TestLoop_MaxAttempts(t *testing.T) {
+	fail := Result{Output: "still failing"}
+	l := New(scripted(fail, fail, fail), WithMaxAttempts(2))
+
+	if out, _ := l.Stop(context.Background(), stop(false)); !out.Block {
+		t.Fatal("expected first attempt to block")
+	}
+	if out, _ := l.Stop(context.Background(), stop(true)); out.Block {
+		t.Fatal("expected the stop to be allowed after the last attempt")
+	}
+	// A new stop sequence starts counting again.
+	if out, _ := l.Stop(context.Background(), stop(false)); !out.Block {
+		t.Fatal("expected a new sequence to block again")
+	}
+
+	want := []Outcome{OutcomeBlocked, OutcomeExhausted, OutcomeBlocked}
+	if got := outcomes(l); !reflect.DeepEqual(got, want) {
+		t.Errorf("outcomes = %v, want %v", got, want)
+	}
+	if n := l.Attempts()[2].Number; n != 1 {
+		t.Errorf("expected attempt number to reset, got %d", n)
+	}
+}
+
+func TestLoop_SkipsWhenAnotherHookIsActive(t *testing.T) {
+	ran := false
+	l := New(func(ctx context.Context, cwd string) (Result, error) {
+		ran = true
+		return Result{}, nil
+	})
+
+	out, err := l.Stop(context.Background(), stop(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Block || ran {
+		t.Errorf("expected the stop to be allowed without verifying, got %+v (ran %v)", out, ran)
+	}
+	if got := outcomes(l); !reflect.DeepEqual(got, []Outcome{OutcomeSkipped}) {
+		t.Errorf("outcomes = %v", got)
+	}
+}
+
+func TestLoop_MaxCostBetweenTurns(t *testing.T) {
+	l := New(scripted(Result{Output: "fail"}), WithMaxCostBetweenTurns(1.0))
+	l.Observe(&message.ResultMessage{TotalCostUSD: 1.25})
+
+	out, err := l.Stop(context.Background(), stop(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Block {
+		t.Errorf("expected the stop to be allowed over budget, got %+v", out)
+	}
+	attempts := l.Attempts()
+	if len(attempts) != 1 || attempts[0].Outcome != OutcomeOverBudget || attempts[0].CostUSD != 1.25 {
+		t.Errorf("unexpected attempts: %+v", attempts)
+	}
+}
+
+func TestLoop_VerifierError(t *testing.T) {
+	want := errors.New("go not installed")
+	var reported []Attempt
+	l := New(func(ctx context.Context, cwd string) (Result, error) {
+		return Result{}, want
+	}, WithOnAttempt(func(a Attempt) { reported = append(reported, a) }))
+
+	out, err := l.Stop(context.Background(), stop(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Block {
+		t.Errorf("expected the stop to be allowed, got %+v", out)
+	}
+	if len(reported) != 1 || reported[0].Outcome != OutcomeError || !errors.Is(reported[0].Err, want) {
+		t.Errorf("unexpected reported attempts: %+v", reported)
+	}
+}
+
+func TestLoop_UnlockedWhileVerifying(t *testing.T) {
+	var l *Loop
+	var seen []int
+	l = New(func(ctx context.Context, cwd string) (Result, error) {
+		// The message pump keeps running during a slow verifier.
+		l.Observe(&message.ResultMessage{TotalCostUSD: 0.5})
+		return Result{Passed: true}, nil
+	}, WithOnAttempt(func(Attempt) { seen = append(seen, len(l.Attempts())) }))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = l.Stop(context.Background(), stop(false))
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop deadlocked")
+	}
+	if !reflect.DeepEqual(seen, []int{1}) || l.Attempts()[0].CostUSD != 0.5 {
+		t.Errorf("unexpected attempts: %v, %+v", seen, l.Attempts())
+	}
+}
+
+func TestLoop_Matcher(t *testing.T) {
+	l := New(scripted(Result{Output: "fail"}), WithTimeout(90*time.Second))
+	m := l.Matcher()
+	if m.Timeout == nil || *m.Timeout != 90 || len(m.Hooks) != 1 {
+		t.Fatalf("unexpected matcher: %+v", m)
+	}
+
+	out, err := m.Hooks[0](context.Background(), stop(false), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Decision != "block" || !strings.Contains(out.Reason, "fail") {
+		t.Errorf("unexpected hook output: %+v", out)
+	}
+
+	if _, err := m.Hooks[0](context.Background(), &control.PreToolUseHookInput{}, nil); err == nil {
+		t.Error("expected an error for a non-Stop input")
+	}
+}
+
+func TestKeepTail(t *testing.T) {
+	if got := keepTail("short", 10); got != "short" {
+		t.Errorf("got %q", got)
+	}
+	got := keepTail("0123456789é", 3)
+	if !strings.HasSuffix(got, "9é") || !strings.HasPrefix(got, "[... output truncated ...]") {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Command("sh", "-c", "pwd -P")(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Passed || !strings.Contains(res.Output, dir) {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	res, err = Command("sh", "-c", "echo broken >&2; exit 3")(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Passed || !strings.Contains(res.Output, "broken") || !strings.Contains(res.Output, "exit status 3") {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	if _, err := Command("definitely-not-a-command")(context.Background(), dir); err == nil {
+		t.Error("expected an error for a missing command")
+	}
+}
@@ -0,0 +1,161 @@
+package claudeagent
+
+import (
+	"os"
+	"sync"
+
+	"claudeagent/message"
+	"claudeagent/workspace"
+)
+
+// TurnChanges are the workspace files changed during one turn.
+type TurnChanges struct {
+	// Result is the turn's result message. It is delivered by Messages after
+	// the callback returns.
+	Result  *message.ResultMessage
+	Changes []workspace.Change
+	// Err reports a snapshot that failed; Changes is then empty.
+	Err error
+}
+
+// WithWorkspaceSnapshots snapshots the working directory and additional
+// directories, skipping files git ignores, before every turn and after its result,
+// and calls fn with the files added, modified and deleted in between. This
+// includes changes no tool call describes, such as files written by Bash.
+// Snapshots read the whole trees, so this is opt-in.
+func WithWorkspaceSnapshots(fn func(TurnChanges), opts ...workspace.Option) Option {
+	return func(o *Options) {
+		o.OnWorkspaceChanges = fn
+		o.WorkspaceOptions = opts
+	}
+}
+
+// turnSnapshots pairs the snapshot taken when a prompt is sent with the one
+// taken when its result arrives.
+type turnSnapshots struct {
+	ws *workspace.Snapshotter
+	fn func(TurnChanges)
+
+	mu sync.Mutex
+	// pending holds the starting snapshot of every turn sent but not
+	// finished, oldest first.
+	pending []turnStart
+}
+
+type turnStart struct {
+	snap *workspace.Snapshot
+	err  error
+	// skip is set for turns whose changes are not reported, such as
+	// compactions.
+	skip bool
+}
+
+// newTurnSnapshots returns nil unless WithWorkspaceSnapshots is set.
+func newTurnSnapshots(o *Options) *turnSnapshots {
+	if o.OnWorkspaceChanges == nil {
+		return nil
+	}
+	var roots []string
+	if o.Cwd != nil {
+		roots = append(roots, *o.Cwd)
+	} else if cwd, err := os.Getwd(); err == nil {
+		roots = append(roots, cwd)
+	}
+	roots = append(roots, o.AdditionalDirectories...)
+	return &turnSnapshots{ws: workspace.New(roots, o.WorkspaceOptions...), fn: o.OnWorkspaceChanges}
+}
+
+// begin takes the starting snapshot of a turn about to be sent.
+func (s *turnSnapshots) begin() {
+	if s == nil {
+		return
+	}
+	snap, err := s.ws.Snapshot()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, turnStart{snap: snap, err: err})
+}
+
+// skip queues a turn about to be sent whose changes are not reported, so
+// the results after it pair with their own prompts.
+func (s *turnSnapshots) skip() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, turnStart{skip: true})
+}
+
+// observe finishes the oldest turn when msg is its result.
+func (s *turnSnapshots) observe(msg message.Message) {
+	result, ok := msg.(*message.ResultMessage)
+	if s == nil || !ok {
+		return
+	}
+	s.mu.Lock()
+	if len(s.pending) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	start := s.pending[0]
+	s.pending = s.pending[1:]
+	if start.skip {
+		// The next turn starts where the skipped one did.
+		if start.snap != nil && len(s.pending) > 0 {
+			s.pending[0].snap, s.pending[0].err = start.snap, nil
+		}
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	turn := TurnChanges{Result: result, Err: start.err}
+	if turn.Err == nil {
+		var end *workspace.Snapshot
+		end, turn.Err = s.ws.Snapshot()
+		if turn.Err == nil {
+			turn.Changes = workspace.Compare(start.snap, end)
+			s.mu.Lock()
+			// Queued turns only start once this one has finished.
+			if len(s.pending) > 0 {
+				s.pending[0].snap, s.pending[0].err = end, nil
+			}
+			s.mu.Unlock()
+		}
+	}
+	s.fn(turn)
+}
+
+func (s *turnSnapshots) wrap(done <-chan struct{}, in <-chan message.Message) <-chan message.Message {
+	if s == nil {
+		return in
+	}
+	return observeMessages(done, in, s.observe)
+}
+
+// observeMessages runs observe on every message before passing it on, until
+// in is closed or done is, e.g. when the iterator is closed undrained.
+func observeMessages(done <-chan struct{}, in <-chan message.Message, observe func(message.Message)) <-chan message.Message {
+	out := make(chan message.Message, cap(in))
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case msg, ok := <-in:
+				if !ok {
+					return
+				}
+				observe(msg)
+				select {
+				case out <- msg:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,276 @@
+package workspace
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is one pattern of a .gitignore file.
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreRules are the patterns of one .gitignore file, matched against paths
+// relative to its directory.
+type ignoreRules struct {
+	dir string
+	// prefix is the path from the rules' directory down to the snapshot
+	// root, for rules read from above it.
+	prefix string
+	rules  []ignoreRule
+}
+
+func readIgnoreFile(file, dir string) (*ignoreRules, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return parseIgnore(dir, lines), nil
+}
+
+// parseIgnore parses gitignore patterns for the directory dir, a slash
+// separated path relative to the snapshot root.
+func parseIgnore(dir string, lines []string) *ignoreRules {
+	rules := &ignoreRules{dir: dir}
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var r ignoreRule
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		// A slash anywhere but at the end anchors the pattern to dir.
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+		expr := globRegexp(line)
+		if !anchored {
+			expr = "(.*/)?" + expr
+		}
+		re, err := regexp.Compile("^" + expr + "$")
+		if err != nil {
+			continue
+		}
+		r.re = re
+		rules.rules = append(rules.rules, r)
+	}
+	return rules
+}
+
+// globRegexp translates a gitignore glob into a regular expression.
+func globRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// match reports whether rel, relative to the snapshot root, is ignored by
+// these rules and whether any rule decided it.
+func (r *ignoreRules) match(rel string, isDir bool) (ignored, decided bool) {
+	if r.dir != "" {
+		if !strings.HasPrefix(rel, r.dir+"/") {
+			return false, false
+		}
+		rel = rel[len(r.dir)+1:]
+	}
+	if r.prefix != "" {
+		rel = r.prefix + "/" + rel
+	}
+	for i := len(r.rules) - 1; i >= 0; i-- {
+		rule := r.rules[i]
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.re.MatchString(rel) {
+			return !rule.negate, true
+		}
+	}
+	return false, false
+}
+
+// ignoreStack holds the .gitignore rules that apply to a directory, the
+// deepest last.
+type ignoreStack []*ignoreRules
+
+func (s ignoreStack) ignored(rel string, isDir bool) bool {
+	if path.Base(rel) == ".git" {
+		return true
+	}
+	for i := len(s) - 1; i >= 0; i-- {
+		if ignored, decided := s[i].match(rel, isDir); decided {
+			return ignored
+		}
+	}
+	return false
+}
+
+// repoIgnores returns the ignore rules that apply to root from outside it,
+// lowest precedence first: the user's core.excludesFile, the repository's
+// info/exclude and the .gitignore files from the top of the repository down
+// to root's parent. It returns none if root is not in a git repository.
+func repoIgnores(root string) (ignoreStack, error) {
+	top, gitDir, ok := findRepo(root)
+	if !ok {
+		return nil, nil
+	}
+	prefix, err := filepath.Rel(top, root)
+	if err != nil {
+		return nil, err
+	}
+	prefix = filepath.ToSlash(prefix)
+	if prefix == "." {
+		prefix = ""
+	}
+
+	var stack ignoreStack
+	add := func(file, prefix string) error {
+		rules, err := readIgnoreFile(file, "")
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("read %s: %w", file, err)
+		}
+		rules.prefix = prefix
+		stack = append(stack, rules)
+		return nil
+	}
+	if file := excludesFile(top); file != "" {
+		if err := add(file, prefix); err != nil {
+			return nil, err
+		}
+	}
+	if err := add(filepath.Join(gitDir, "info", "exclude"), prefix); err != nil {
+		return nil, err
+	}
+	// root reads its own .gitignore as it is walked.
+	dir, parts := top, strings.Split(prefix, "/")
+	for i := 0; prefix != "" && i < len(parts); i++ {
+		if err := add(filepath.Join(dir, ".gitignore"), strings.Join(parts[i:], "/")); err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(dir, parts[i])
+	}
+	return stack, nil
+}
+
+// findRepo returns the top of the git working tree holding dir and the
+// repository's common git directory, which worktrees share.
+func findRepo(dir string) (top, gitDir string, ok bool) {
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		info, err := os.Lstat(dotGit)
+		if err == nil && info.IsDir() {
+			return dir, dotGit, true
+		}
+		if err == nil {
+			// Worktrees and submodules have a file pointing at their git
+			// directory.
+			data, err := os.ReadFile(dotGit)
+			if err != nil {
+				return "", "", false
+			}
+			gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+			if !ok {
+				return "", "", false
+			}
+			if !filepath.IsAbs(gitDir) {
+				gitDir = filepath.Join(dir, gitDir)
+			}
+			if common, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+				commonDir := strings.TrimSpace(string(common))
+				if !filepath.IsAbs(commonDir) {
+					commonDir = filepath.Join(gitDir, commonDir)
+				}
+				gitDir = commonDir
+			}
+			return dir, gitDir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", false
+		}
+		dir = parent
+	}
+}
+
+// excludesFile returns the user's global ignore file: core.excludesFile if
+// set, else git's default location.
+func excludesFile(top string) string {
+	if out, err := exec.Command("git", "-C", top, "config", "--path", "core.excludesFile").Output(); err == nil {
+		if file := strings.TrimSpace(string(out)); file != "" {
+			return file
+		}
+	}
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", "ignore")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "git", "ignore")
+	}
+	return ""
+}
@@ -0,0 +1,289 @@
+// Package workspace detects the file changes an agent makes, including ones
+// no tool call describes, such as files written by Bash commands.
+//
+// A Snapshotter records the files of one or more directory trees, skipping
+// the files git ignores, by the rules of the repository a tree is in even
+// when the tree is a subdirectory of it. Comparing two snapshots lists the files
+// added, modified and deleted in between, with unified diffs for text
+// files:
+//
+//	ws := workspace.New([]string{cwd})
+//	before, _ := ws.Snapshot()
+//	// ... run a turn ...
+//	after, _ := ws.Snapshot()
+//	for _, c := range workspace.Compare(before, after) {
+//	    fmt.Println(c.Kind, c.Name)
+//	}
+package workspace
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"claudeagent/internal/udiff"
+)
+
+const (
+	defaultMaxTextSize = 1 << 20
+	racyWindow         = 2 * time.Second
+)
+
+// ChangeKind says how a file changed between two snapshots.
+type ChangeKind string
+
+const (
+	Added    ChangeKind = "added"
+	Modified ChangeKind = "modified"
+	Deleted  ChangeKind = "deleted"
+)
+
+// Change is a file that differs between two snapshots.
+type Change struct {
+	Kind ChangeKind
+	Path string
+	// Name is the path relative to the file's root, with forward slashes.
+	Name string
+	// Binary is set for files that are not text or are too large to diff;
+	// their Diff is empty.
+	Binary bool
+	Diff   string
+}
+
+// Snapshot is the state of the files under a Snapshotter's roots.
+type Snapshot struct {
+	Taken time.Time
+	files map[string]*file
+}
+
+// Len returns the number of files in the snapshot.
+func (s *Snapshot) Len() int {
+	return len(s.files)
+}
+
+type file struct {
+	name    string
+	size    int64
+	modTime time.Time
+	hash    [sha256.Size]byte
+	// text is kept for text files up to the size limit, to diff them.
+	text   string
+	isText bool
+}
+
+// Option configures a Snapshotter.
+type Option func(*Snapshotter)
+
+// WithMaxTextSize sets the size up to which text files are kept in
+// snapshots and diffed. Larger files are only hashed. The default is 1 MiB.
+func WithMaxTextSize(n int64) Option {
+	return func(s *Snapshotter) {
+		s.maxTextSize = n
+	}
+}
+
+// WithIgnore adds gitignore patterns that apply to every root, below the
+// ignore files of the roots and their repositories.
+func WithIgnore(patterns ...string) Option {
+	return func(s *Snapshotter) {
+		s.ignore = append(s.ignore, patterns...)
+	}
+}
+
+// Snapshotter takes snapshots of a set of directory trees. Files whose size
+// and modification time match the previous snapshot, and that were not
+// modified shortly before it, are not read again.
+type Snapshotter struct {
+	roots       []string
+	maxTextSize int64
+	ignore      []string
+
+	mu   sync.Mutex
+	last *Snapshot
+}
+
+// New creates a Snapshotter for the given root directories.
+func New(roots []string, opts ...Option) *Snapshotter {
+	s := &Snapshotter{maxTextSize: defaultMaxTextSize}
+	for _, root := range roots {
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+		s.roots = append(s.roots, root)
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Snapshot records the current files under every root.
+func (s *Snapshotter) Snapshot() (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := &Snapshot{Taken: time.Now(), files: make(map[string]*file)}
+	for _, root := range s.roots {
+		if err := s.walk(snap, root); err != nil {
+			return nil, err
+		}
+	}
+	s.last = snap
+	return snap, nil
+}
+
+func (s *Snapshotter) walk(snap *Snapshot, root string) error {
+	repo, err := repoIgnores(root)
+	if err != nil {
+		return err
+	}
+	base := append(ignoreStack{parseIgnore("", s.ignore)}, repo...)
+	return s.walkDir(snap, root, "", base)
+}
+
+func (s *Snapshotter) walkDir(snap *Snapshot, root, rel string, ignore ignoreStack) error {
+	dir := filepath.Join(root, filepath.FromSlash(rel))
+	if rules, err := readIgnoreFile(filepath.Join(dir, ".gitignore"), rel); err == nil {
+		ignore = append(ignore[:len(ignore):len(ignore)], rules)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("read .gitignore in %s: %w", dir, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if rel != "" && errors.Is(err, fs.ErrNotExist) {
+			// Removed while walking.
+			return nil
+		}
+		return fmt.Errorf("read dir %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if rel != "" {
+			name = rel + "/" + name
+		}
+		if ignore.ignored(name, entry.IsDir()) {
+			continue
+		}
+		if entry.IsDir() {
+			if err := s.walkDir(snap, root, name, ignore); err != nil {
+				return err
+			}
+			continue
+		}
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if err := s.addFile(snap, root, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Snapshotter) addFile(snap *Snapshot, root, name string) error {
+	path := filepath.Join(root, filepath.FromSlash(name))
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.last != nil {
+		// Files modified just before the last snapshot may have changed
+		// again within the file system's timestamp resolution.
+		settled := info.ModTime().Before(s.last.Taken.Add(-racyWindow))
+		if prev := s.last.files[path]; prev != nil && settled && prev.size == info.Size() && prev.modTime.Equal(info.ModTime()) {
+			snap.files[path] = prev
+			return nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	f := &file{
+		name:    name,
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		hash:    sha256.Sum256(data),
+	}
+	if int64(len(data)) <= s.maxTextSize && isText(data) {
+		f.text, f.isText = string(data), true
+	}
+	snap.files[path] = f
+	return nil
+}
+
+// isText reports whether data looks like text: valid UTF-8 without NUL
+// bytes in its first 8 KiB.
+func isText(data []byte) bool {
+	head := data
+	if len(head) > 8192 {
+		head = head[:8192]
+	}
+	return bytes.IndexByte(head, 0) < 0 && utf8.Valid(data)
+}
+
+// Compare lists the files added, modified and deleted between two
+// snapshots, sorted by path.
+func Compare(before, after *Snapshot) []Change {
+	var changes []Change
+	for path, a := range after.files {
+		b, ok := before.files[path]
+		switch {
+		case !ok:
+			changes = append(changes, change(Added, path, nil, a))
+		case b.hash != a.hash:
+			changes = append(changes, change(Modified, path, b, a))
+		}
+	}
+	for path, b := range before.files {
+		if _, ok := after.files[path]; !ok {
+			changes = append(changes, change(Deleted, path, b, nil))
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func change(kind ChangeKind, path string, before, after *file) Change {
+	f := after
+	if f == nil {
+		f = before
+	}
+	c := Change{Kind: kind, Path: path, Name: f.name}
+	if (before != nil && !before.isText) || (after != nil && !after.isText) {
+		c.Binary = true
+		return c
+	}
+
+	oldName, newName := "a/"+f.name, "b/"+f.name
+	var oldText, newText string
+	if before != nil {
+		oldText = before.text
+	} else {
+		oldName = "/dev/null"
+	}
+	if after != nil {
+		newText = after.text
+	} else {
+		newName = "/dev/null"
+	}
+	c.Diff = udiff.Unified(oldName, newName, oldText, newText)
+	return c
+}
@@ -0,0 +1,199 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"main.go":       "package main\n",
+		"old.txt":       "bye\n",
+		"logo.png":      "\x89PNG\x00\x01",
+		"build/out.bin": "ignored",
+		".gitignore":    "build/\n",
+	})
+	ws := New([]string{root})
+	before, err := ws.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same size, so only the content hash tells the change apart.
+	writeFiles(t, root, map[string]string{
+		"main.go":       "package mian\n",
+		"gen/types.go":  "package gen\n",
+		"logo.png":      "\x89PNG\x00\x02",
+		"build/out.bin": "still ignored",
+	})
+	if err := os.Remove(filepath.Join(root, "old.txt")); err != nil {
+		t.Fatal(err)
+	}
+	after, err := ws.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := Compare(before, after)
+	var got []string
+	for _, c := range changes {
+		got = append(got, string(c.Kind)+" "+c.Name)
+	}
+	want := []string{"added gen/types.go", "modified logo.png", "modified main.go", "deleted old.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("changes = %v, want %v", got, want)
+	}
+
+	if !changes[1].Binary || changes[1].Diff != "" {
+		t.Errorf("expected a binary change without diff: %+v", changes[1])
+	}
+	wantDiff := "--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-package main\n+package mian\n"
+	if changes[2].Diff != wantDiff {
+		t.Errorf("main.go diff =\n%s", changes[2].Diff)
+	}
+	if changes[0].Diff != "--- /dev/null\n+++ b/gen/types.go\n@@ -0,0 +1 @@\n+package gen\n" {
+		t.Errorf("added diff =\n%s", changes[0].Diff)
+	}
+	if changes[3].Diff != "--- a/old.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-bye\n" {
+		t.Errorf("deleted diff =\n%s", changes[3].Diff)
+	}
+}
+
+func TestSnapshot_Ignore(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".gitignore":          "*.log\n/dist\n!keep.log\nnode_modules/\n",
+		"a.log":               "",
+		"keep.log":            "",
+		"dist/app.js":         "",
+		"src/dist/app.js":     "",
+		"src/.gitignore":      "*.tmp\n!important.log\n",
+		"src/x.tmp":           "",
+		"src/important.log":   "",
+		"src/sub/y.tmp":       "",
+		"node_modules/m/i.js": "",
+		"docs/**.md":          "",
+		".git/HEAD":           "",
+		"tmp.cache":           "",
+	})
+	snap, err := New([]string{root}, WithIgnore("*.cache")).Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, f := range snap.files {
+		got = append(got, f.name)
+	}
+	want := map[string]bool{
+		".gitignore": true, "keep.log": true, "src/dist/app.js": true,
+		"src/.gitignore": true, "src/important.log": true, "docs/**.md": true,
+	}
+	if len(got) != len(want) {
+		t.Errorf("snapshot has %v, want %v", got, want)
+	}
+	for _, name := range got {
+		if !want[name] {
+			t.Errorf("unexpected file %s", name)
+		}
+	}
+}
+
+func TestIgnoreRules(t *testing.T) {
+	rules := parseIgnore("", []string{"**/gen/*.go", "a/**/b", "doc/", "[abc].txt", `\#hash`})
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"gen/x.go", false, true},
+		{"pkg/gen/x.go", false, true},
+		{"pkg/gen/sub/x.go", false, false},
+		{"a/b", false, true},
+		{"a/x/y/b", false, true},
+		{"doc", true, true},
+		{"doc", false, false},
+		{"sub/doc", true, true},
+		{"b.txt", false, true},
+		{"d.txt", false, false},
+		{"#hash", false, true},
+	}
+	for _, tt := range tests {
+		if got, _ := rules.match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("match(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestSnapshot_ReusesSettledFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"a.txt": "one\n"})
+	ws := New([]string{root})
+	first, err := ws.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Recently modified files are read again even with the same size and
+	// modification time.
+	path := filepath.Join(root, "a.txt")
+	info, _ := os.Stat(path)
+	writeFiles(t, root, map[string]string{"a.txt": "two\n"})
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	second, err := ws.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := Compare(first, second); len(changes) != 1 {
+		t.Errorf("expected the racy change to be detected, got %+v", changes)
+	}
+}
+
+func TestSnapshot_RepoIgnores(t *testing.T) {
+	top, config := t.TempDir(), t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", config)
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(config, "gitconfig-none"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	writeFiles(t, config, map[string]string{"git/ignore": "*.tmp\n"})
+	writeFiles(t, top, map[string]string{
+		".git/info/exclude":   "*.log\n",
+		".gitignore":          "build/\n/pkg/sub/gen.txt\n",
+		"pkg/.gitignore":      "*.out\n",
+		"pkg/sub/main.go":     "package sub\n",
+		"pkg/sub/debug.log":   "excluded",
+		"pkg/sub/scratch.tmp": "globally ignored",
+		"pkg/sub/build/o":     "ignored from the top",
+		"pkg/sub/gen.txt":     "anchored at the top",
+		"pkg/sub/a.out":       "ignored from the parent",
+	})
+
+	snap, err := New([]string{filepath.Join(top, "pkg", "sub")}).Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range snap.files {
+		got = append(got, f.name)
+	}
+	if !reflect.DeepEqual(got, []string{"main.go"}) {
+		t.Errorf("snapshot has %v, want only main.go", got)
+	}
+}
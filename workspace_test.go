@@ -0,0 +1,82 @@
+package claudeagent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"claudeagent/message"
+	"claudeagent/workspace"
+)
+
+func TestTurnSnapshots(t *testing.T) {
+	dir, extra := t.TempDir(), t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(dir, "a.txt"), "one\n")
+
+	var turns []TurnChanges
+	opts := applyOptions([]Option{
+		WithCwd(dir),
+		WithAdditionalDirectories(extra),
+		WithWorkspaceSnapshots(func(tc TurnChanges) { turns = append(turns, tc) }),
+	})
+	s := newTurnSnapshots(opts)
+
+	// Two prompts and a compaction between them are queued before the
+	// first result arrives.
+	s.begin()
+	s.skip()
+	s.begin()
+	write(filepath.Join(dir, "a.txt"), "two\n")
+	s.observe(&message.AssistantMessage{})
+	s.observe(&message.ResultMessage{})
+	s.observe(&message.ResultMessage{})
+	write(filepath.Join(extra, "b.txt"), "new\n")
+	s.observe(&message.ResultMessage{})
+	// Results without a pending turn are ignored.
+	s.observe(&message.ResultMessage{})
+
+	if len(turns) != 2 {
+		t.Fatalf("got %d turns, want 2", len(turns))
+	}
+	first, second := turns[0], turns[1]
+	if first.Err != nil || len(first.Changes) != 1 || first.Changes[0].Kind != workspace.Modified || first.Changes[0].Name != "a.txt" {
+		t.Errorf("unexpected first turn: %+v", first)
+	}
+	if second.Err != nil || len(second.Changes) != 1 || second.Changes[0].Kind != workspace.Added || second.Changes[0].Name != "b.txt" {
+		t.Errorf("unexpected second turn: %+v", second)
+	}
+}
+
+func TestTurnSnapshots_Disabled(t *testing.T) {
+	s := newTurnSnapshots(applyOptions(nil))
+	if s != nil {
+		t.Fatal("expected no snapshots without WithWorkspaceSnapshots")
+	}
+	// A nil helper is a no-op.
+	s.begin()
+	s.observe(&message.ResultMessage{})
+	in := make(chan message.Message)
+	if s.wrap(nil, in) != (<-chan message.Message)(in) {
+		t.Error("expected wrap to return the channel unchanged")
+	}
+}
+
+func TestObserveMessages_Done(t *testing.T) {
+	in := make(chan message.Message, 1)
+	done := make(chan struct{})
+	out := observeMessages(done, in, func(message.Message) {})
+
+	in <- &message.ResultMessage{}
+	in <- &message.ResultMessage{}
+	// Closing done stops the forwarding even though out is not drained and
+	// in is never closed.
+	close(done)
+	for range out {
+	}
+}
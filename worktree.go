@@ -0,0 +1,117 @@
+package claudeagent
+
+import (
+	"context"
+	"sync"
+
+	"claudeagent/message"
+	"claudeagent/worktree"
+)
+
+// WithIsolatedWorktree runs the session in a temporary git worktree of the
+// repository at repoPath, on a new branch, and sets Cwd to it. The worktree
+// is created on Connect, or when Query starts, and finished on Disconnect, or
+// when the Query iterator is closed: fn then receives the commits and the
+// uncommitted diff as patches, and the worktree is removed. A session that
+// ends mid-turn, e.g. because the CLI crashed, keeps its worktree unless
+// worktree.WithCleanupOnCrash is given. With worktree.WithAutoCommit, the
+// last result message is the commit message.
+//
+// A turn counts as finished when its result message is read from Messages or
+// the Query iterator, so read them to the end before disconnecting; a
+// session closed with a result unread is treated as crashed.
+func WithIsolatedWorktree(repoPath string, fn func(*worktree.Result, error), opts ...worktree.Option) Option {
+	return func(o *Options) {
+		o.WorktreeRepo = repoPath
+		o.OnWorktreeResult = fn
+		o.WorktreeOptions = opts
+	}
+}
+
+// sessionWorktree is the worktree of one session, tracking whether its last
+// turn finished and what the agent said in the end.
+type sessionWorktree struct {
+	wt *worktree.Worktree
+	fn func(*worktree.Result, error)
+
+	mu sync.Mutex
+	// pending counts turns sent without a result yet.
+	pending  int
+	summary  string
+	finished bool
+}
+
+// prepareWorktree creates the worktree if WithIsolatedWorktree is set and
+// returns the options to start the CLI with.
+func prepareWorktree(ctx context.Context, options *Options) (*sessionWorktree, *Options, error) {
+	if options.WorktreeRepo == "" {
+		return nil, options, nil
+	}
+	wt, err := worktree.Create(ctx, options.WorktreeRepo, options.WorktreeOptions...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	o := *options
+	o.Cwd = &wt.Path
+	if o.Landlock != nil {
+		cfg := *o.Landlock
+		cfg.ReadWrite = append(append([]string(nil), cfg.ReadWrite...), wt.GitDir)
+		o.Landlock = &cfg
+	}
+	return &sessionWorktree{wt: wt, fn: options.OnWorktreeResult}, &o, nil
+}
+
+// begin records a turn about to be sent.
+func (w *sessionWorktree) begin() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending++
+}
+
+func (w *sessionWorktree) observe(msg message.Message) {
+	result, ok := msg.(*message.ResultMessage)
+	if w == nil || !ok {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.pending > 0 {
+		w.pending--
+	}
+	if result.Result != "" {
+		w.summary = result.Result
+	}
+}
+
+func (w *sessionWorktree) wrap(done <-chan struct{}, in <-chan message.Message) <-chan message.Message {
+	if w == nil {
+		return in
+	}
+	return observeMessages(done, in, w.observe)
+}
+
+// finish collects the result, reports it to the callback and removes the
+// worktree. Only the first call does anything.
+func (w *sessionWorktree) finish() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	if w.finished {
+		w.mu.Unlock()
+		return nil
+	}
+	w.finished = true
+	summary, crashed := w.summary, w.pending > 0
+	w.mu.Unlock()
+
+	res, err := w.wt.Finish(context.Background(), summary, crashed)
+	if w.fn != nil {
+		w.fn(res, err)
+	}
+	return err
+}
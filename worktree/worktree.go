@@ -0,0 +1,299 @@
+// Package worktree runs an agent in a throwaway git worktree and collects
+// what it did as a patch.
+//
+// Create checks out a new branch in a temporary directory. When the session
+// is over, Finish optionally commits the remaining changes, reads the
+// branch's commits and uncommitted diff, and removes the worktree:
+//
+//	wt, err := worktree.Create(ctx, repo, worktree.WithAutoCommit(),
+//	    worktree.WithCommitAuthor("CI Agent", "ci@example.com"))
+//	// ... run the agent with wt.Path as its working directory ...
+//	res, err := wt.Finish(ctx, summary, false)
+//	os.WriteFile("agent.patch", []byte(res.Patch), 0o644) // applies with git am
+package worktree
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const defaultCommitMessage = "Apply agent changes"
+
+// Commit is a commit made on the worktree branch.
+type Commit struct {
+	Hash    string
+	Subject string
+}
+
+// Result is what a session left in its worktree.
+type Result struct {
+	Branch string
+	// Base is the commit the branch started from.
+	Base string
+	// Head is the branch's last commit, equal to Base if nothing was
+	// committed.
+	Head    string
+	Commits []Commit
+	// Patch holds Commits in git format-patch form, for git am.
+	Patch string
+	// Diff holds the changes left uncommitted, untracked files included,
+	// against Head, for git apply.
+	Diff string
+	// Kept is the worktree directory when it was not removed.
+	Kept string
+}
+
+// Empty reports whether the session changed nothing.
+func (r *Result) Empty() bool {
+	return len(r.Commits) == 0 && r.Diff == ""
+}
+
+// Option configures a Worktree.
+type Option func(*Worktree)
+
+// WithBranch names the new branch. The default is
+// claude/worktree-<time>-<random>.
+func WithBranch(name string) Option {
+	return func(w *Worktree) {
+		w.Branch = name
+	}
+}
+
+// WithBase starts the branch from rev instead of HEAD.
+func WithBase(rev string) Option {
+	return func(w *Worktree) {
+		w.baseRev = rev
+	}
+}
+
+// WithKeepBranch keeps the branch after the worktree is removed. By default
+// it is deleted, and its commits only survive in Result.Patch.
+func WithKeepBranch() Option {
+	return func(w *Worktree) {
+		w.keepBranch = true
+	}
+}
+
+// WithAutoCommit commits the changes left in the worktree when it is
+// finished, using the agent's summary as the commit message.
+func WithAutoCommit() Option {
+	return func(w *Worktree) {
+		w.autoCommit = true
+	}
+}
+
+// WithCommitAuthor sets the identity to commit with when the repository has
+// none configured, as is common on CI runners. Without it, committing in
+// such a repository fails.
+func WithCommitAuthor(name, email string) Option {
+	return func(w *Worktree) {
+		w.authorName, w.authorEmail = name, email
+	}
+}
+
+// WithSkipHooks commits with --no-verify, skipping the repository's
+// pre-commit and commit-msg hooks. By default they run, and a failing hook
+// fails the commit.
+func WithSkipHooks() Option {
+	return func(w *Worktree) {
+		w.skipHooks = true
+	}
+}
+
+// WithCleanupOnCrash removes the worktree even when the session ended
+// abnormally, e.g. because the CLI crashed mid-turn. By default such a
+// worktree is kept for inspection and reported in Result.Kept.
+func WithCleanupOnCrash() Option {
+	return func(w *Worktree) {
+		w.cleanupOnCrash = true
+	}
+}
+
+// Worktree is a temporary git worktree on its own branch.
+type Worktree struct {
+	Repo   string
+	Path   string
+	Branch string
+	// Base is the commit the branch started from.
+	Base string
+	// GitDir is the repository's git directory, which the worktree shares.
+	// Committing in the worktree writes to it.
+	GitDir string
+
+	baseRev        string
+	keepBranch     bool
+	autoCommit     bool
+	cleanupOnCrash bool
+	skipHooks      bool
+	authorName     string
+	authorEmail    string
+}
+
+// Create adds a worktree of the repository at repo in a new temporary
+// directory, on a new branch.
+func Create(ctx context.Context, repo string, opts ...Option) (*Worktree, error) {
+	w := &Worktree{Repo: repo, baseRev: "HEAD"}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.Branch == "" {
+		w.Branch = defaultBranch()
+	}
+
+	base, err := git(ctx, repo, "rev-parse", "--verify", w.baseRev+"^{commit}")
+	if err != nil {
+		return nil, err
+	}
+	w.Base = strings.TrimSpace(base)
+	gitDir, err := git(ctx, repo, "rev-parse", "--path-format=absolute", "--git-common-dir")
+	if err != nil {
+		return nil, err
+	}
+	w.GitDir = strings.TrimSpace(gitDir)
+
+	dir, err := os.MkdirTemp("", "claude-worktree-*")
+	if err != nil {
+		return nil, fmt.Errorf("create worktree dir: %w", err)
+	}
+	if _, err := git(ctx, repo, "worktree", "add", "-b", w.Branch, dir, w.Base); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	w.Path = dir
+	return w, nil
+}
+
+func defaultBranch() string {
+	var b [3]byte
+	_, _ = rand.Read(b[:])
+	return "claude/worktree-" + time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b[:])
+}
+
+// Commit commits every change in the worktree, untracked files included.
+// It reports false if there was nothing to commit. An empty message is
+// replaced by a generic one.
+func (w *Worktree) Commit(ctx context.Context, message string) (bool, error) {
+	if _, err := git(ctx, w.Path, "add", "-A"); err != nil {
+		return false, err
+	}
+	if _, err := git(ctx, w.Path, "diff", "--cached", "--quiet"); err == nil {
+		return false, nil
+	}
+	message = strings.TrimSpace(message)
+	if message == "" {
+		message = defaultCommitMessage
+	}
+	args := []string{"commit", "-q", "-m", message}
+	if w.skipHooks {
+		args = append(args, "--no-verify")
+	}
+	if w.authorEmail != "" {
+		if email, _ := git(ctx, w.Path, "config", "user.email"); strings.TrimSpace(email) == "" {
+			args = append([]string{"-c", "user.name=" + w.authorName, "-c", "user.email=" + w.authorEmail}, args...)
+		}
+	}
+	if _, err := git(ctx, w.Path, args...); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Result reads the worktree's commits and uncommitted changes.
+func (w *Worktree) Result(ctx context.Context) (*Result, error) {
+	head, err := git(ctx, w.Path, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{Branch: w.Branch, Base: w.Base, Head: strings.TrimSpace(head)}
+
+	log, err := git(ctx, w.Path, "log", "--reverse", "--format=%H %s", w.Base+"..HEAD")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(strings.TrimSpace(log), "\n") {
+		if hash, subject, ok := strings.Cut(line, " "); ok {
+			res.Commits = append(res.Commits, Commit{Hash: hash, Subject: subject})
+		}
+	}
+	if len(res.Commits) > 0 {
+		if res.Patch, err = git(ctx, w.Path, "format-patch", "--stdout", "--binary", w.Base+"..HEAD"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Intent-to-add entries make untracked files show up in the diff
+	// without staging their contents.
+	if _, err := git(ctx, w.Path, "add", "-A", "--intent-to-add"); err != nil {
+		return nil, err
+	}
+	if res.Diff, err = git(ctx, w.Path, "diff", "--binary", "HEAD"); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Remove deletes the worktree directory, and the branch unless
+// WithKeepBranch was given.
+func (w *Worktree) Remove(ctx context.Context) error {
+	_, err := git(ctx, w.Repo, "worktree", "remove", "--force", w.Path)
+	if err != nil {
+		// The directory may be gone already; drop git's record of it.
+		_ = os.RemoveAll(w.Path)
+		if _, pruneErr := git(ctx, w.Repo, "worktree", "prune"); pruneErr == nil {
+			err = nil
+		}
+	}
+	if !w.keepBranch {
+		if _, branchErr := git(ctx, w.Repo, "branch", "-D", w.Branch); err == nil {
+			err = branchErr
+		}
+	}
+	return err
+}
+
+// Finish ends the session in the worktree: it commits the remaining
+// changes with summary as the message if WithAutoCommit was given, collects
+// the Result and removes the worktree. A crashed session's worktree is kept
+// unless WithCleanupOnCrash was given.
+func (w *Worktree) Finish(ctx context.Context, summary string, crashed bool) (*Result, error) {
+	var errs []error
+	if w.autoCommit {
+		if _, err := w.Commit(ctx, summary); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	res, err := w.Result(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if crashed && !w.cleanupOnCrash {
+		if res != nil {
+			res.Kept = w.Path
+		}
+	} else if err := w.Remove(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	return res, errors.Join(errs...)
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %w: %s", args[0], err, msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
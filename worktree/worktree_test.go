@@ -0,0 +1,189 @@
+package worktree
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newRepo creates a repository with one commit.
+func newRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(repo, ".gitconfig-none"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	run(t, repo, "init", "-q", "-b", "main")
+	if err := os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run(t, repo, "add", "-A")
+	run(t, repo, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "Initial commit")
+	return repo
+}
+
+func run(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := git(context.Background(), dir, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestFinish_AutoCommit(t *testing.T) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	wt, err := Create(ctx, repo, WithBranch("agent/task"), WithAutoCommit(), WithCommitAuthor("Agent", "agent@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(wt.Path, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(wt.Path, "new.txt"), []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := wt.Finish(ctx, "Add main function\n\nAnd a greeting.", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Commits) != 1 || res.Commits[0].Subject != "Add main function" || res.Head != res.Commits[0].Hash {
+		t.Errorf("unexpected commits: %+v", res)
+	}
+	if !strings.Contains(res.Patch, "Subject: [PATCH] Add main function") || !strings.Contains(res.Patch, "+hello") {
+		t.Errorf("unexpected patch:\n%s", res.Patch)
+	}
+	if res.Diff != "" || res.Kept != "" {
+		t.Errorf("expected no uncommitted changes and no kept worktree: %+v", res)
+	}
+	if !strings.Contains(res.Patch, "From: Agent <agent@example.com>") {
+		t.Errorf("expected the fallback author in the patch:\n%s", res.Patch)
+	}
+
+	if _, err := os.Stat(wt.Path); !os.IsNotExist(err) {
+		t.Errorf("worktree directory still exists: %v", err)
+	}
+	if branches := run(t, repo, "branch", "--list", "agent/task"); branches != "" {
+		t.Errorf("branch was not deleted: %q", branches)
+	}
+
+	// The patch applies to the original repository.
+	cmd := exec.Command("git", "-C", repo, "-c", "user.name=Test", "-c", "user.email=test@example.com", "am", "-q")
+	cmd.Stdin = strings.NewReader(res.Patch)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git am: %v\n%s", err, out)
+	}
+}
+
+func TestFinish_Diff(t *testing.T) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	wt, err := Create(ctx, repo, WithKeepBranch())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(wt.Path, "new.txt"), []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := wt.Finish(ctx, "ignored", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Commits) != 0 || res.Patch != "" || res.Head != res.Base || res.Empty() {
+		t.Errorf("expected only uncommitted changes: %+v", res)
+	}
+	if !strings.Contains(res.Diff, "+++ b/new.txt") {
+		t.Errorf("untracked file missing from diff:\n%s", res.Diff)
+	}
+	if branches := run(t, repo, "branch", "--list", wt.Branch); branches == "" {
+		t.Error("expected the branch to be kept")
+	}
+
+	cmd := exec.Command("git", "-C", repo, "apply")
+	cmd.Stdin = strings.NewReader(res.Diff)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git apply: %v\n%s", err, out)
+	}
+}
+
+func TestFinish_Crashed(t *testing.T) {
+	ctx := context.Background()
+	repo := newRepo(t)
+
+	wt, err := Create(ctx, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := wt.Finish(ctx, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Kept != wt.Path || !res.Empty() {
+		t.Errorf("expected the crashed worktree to be kept: %+v", res)
+	}
+	if _, err := os.Stat(wt.Path); err != nil {
+		t.Errorf("kept worktree is missing: %v", err)
+	}
+	if err := wt.Remove(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	wt, err = Create(ctx, repo, WithCleanupOnCrash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err = wt.Finish(ctx, "", true); err != nil {
+		t.Fatal(err)
+	}
+	if res.Kept != "" {
+		t.Errorf("expected the worktree to be removed: %+v", res)
+	}
+}
+
+func TestCommit_Hooks(t *testing.T) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	hook := filepath.Join(repo, ".git", "hooks", "pre-commit")
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\necho rejected >&2\nexit 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, skip := range []bool{false, true} {
+		opts := []Option{WithCommitAuthor("Agent", "agent@example.com")}
+		if skip {
+			opts = append(opts, WithSkipHooks())
+		}
+		wt, err := Create(ctx, repo, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(wt.Path, "new.txt"), []byte("hello\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		committed, err := wt.Commit(ctx, "Add new.txt")
+		if skip && (err != nil || !committed) {
+			t.Errorf("expected the commit to skip the hook, got %v, %v", committed, err)
+		}
+		if !skip && (err == nil || !strings.Contains(err.Error(), "rejected")) {
+			t.Errorf("expected the hook to reject the commit, got %v", err)
+		}
+		if err := wt.Remove(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCreate_BadBase(t *testing.T) {
+	repo := newRepo(t)
+	if _, err := Create(context.Background(), repo, WithBase("no-such-rev")); err == nil {
+		t.Fatal("expected an error for an unknown base")
+	}
+}
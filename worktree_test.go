@@ -0,0 +1,84 @@
+package claudeagent
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"claudeagent/message"
+	"claudeagent/sandbox"
+	"claudeagent/worktree"
+)
+
+func TestSessionWorktree(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(repo, ".gitconfig-none"))
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "Initial commit"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	var got *worktree.Result
+	options := applyOptions([]Option{
+		WithCwd("/elsewhere"),
+		WithLandlock(sandbox.Config{ReadWrite: []string{"/cache"}}),
+		WithIsolatedWorktree(repo, func(res *worktree.Result, err error) {
+			if err != nil {
+				t.Error(err)
+			}
+			got = res
+		}, worktree.WithAutoCommit(), worktree.WithCommitAuthor("Agent", "agent@example.com")),
+	})
+	wt, started, err := prepareWorktree(context.Background(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *started.Cwd != wt.wt.Path || *options.Cwd != "/elsewhere" {
+		t.Errorf("Cwd = %s, want the worktree without changing the caller's options", *started.Cwd)
+	}
+	if rw := started.Landlock.ReadWrite; len(rw) != 2 || rw[1] != wt.wt.GitDir || len(options.Landlock.ReadWrite) != 1 {
+		t.Errorf("unexpected Landlock read-write paths: %v", rw)
+	}
+
+	wt.begin()
+	if err := os.WriteFile(filepath.Join(wt.wt.Path, "hello.txt"), []byte("hi\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wt.observe(&message.ResultMessage{Result: "Add hello.txt"})
+	if err := wt.finish(); err != nil {
+		t.Fatal(err)
+	}
+	// Later calls are no-ops.
+	if err := wt.finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got == nil || len(got.Commits) != 1 || got.Commits[0].Subject != "Add hello.txt" || got.Kept != "" {
+		t.Fatalf("unexpected result: %+v", got)
+	}
+	if _, err := os.Stat(wt.wt.Path); !os.IsNotExist(err) {
+		t.Errorf("worktree was not removed: %v", err)
+	}
+}
+
+func TestSessionWorktree_Disabled(t *testing.T) {
+	options := applyOptions(nil)
+	wt, started, err := prepareWorktree(context.Background(), options)
+	if err != nil || wt != nil || started != options {
+		t.Fatalf("expected no worktree, got %v, %v", wt, err)
+	}
+	wt.begin()
+	wt.observe(&message.ResultMessage{})
+	if err := wt.finish(); err != nil {
+		t.Fatal(err)
+	}
+}